@@ -3,6 +3,7 @@ package byzcoin
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -71,7 +72,8 @@ func (c *Client) AddTransaction(tx ClientTransaction) (*AddTxResponse, error) {
 
 // AddTransactionAndWait adds a transaction and will wait for it to be included
 // in the ledger, up to a maximum of wait block intervals. It does not return
-// any feedback on the transaction. The Client's Roster and ID should be
+// any feedback on the transaction, except the acknowledgement of the leader,
+// which is verified if it is present. The Client's Roster and ID should be
 // initialized before calling this method (see NewClientFromConfig).
 func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxResponse, error) {
 	reply := &AddTxResponse{}
@@ -84,6 +86,17 @@ func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxRe
 	if err != nil {
 		return nil, err
 	}
+	if reply.Ack != nil {
+		if err := reply.Ack.Verify(); err != nil {
+			return nil, errors.New("invalid acknowledgement: " + err.Error())
+		}
+		if !inRoster(&c.Roster, reply.Ack.Leader) {
+			return nil, errors.New("acknowledgement from a node outside of the roster")
+		}
+		if !bytes.Equal(reply.Ack.TxHash, tx.Instructions.Hash()) {
+			return nil, errors.New("acknowledgement is for another transaction")
+		}
+	}
 	return reply, nil
 }
 
@@ -125,6 +138,29 @@ func (c *Client) CheckAuthorization(dID darc.ID, ids ...darc.Identity) ([]darc.A
 	return ret, nil
 }
 
+// ExplainAuthorization returns the trace of the evaluation of the rule of the
+// action in the given darc, if the given identities sign. It shows which
+// identities and conditions matched and which delegations have been
+// followed. The conditions on the context of an instruction, like its time,
+// evaluate to false.
+func (c *Client) ExplainAuthorization(dID darc.ID, action darc.Action, ids ...darc.Identity) (*darc.EvalTrace, error) {
+	reply := &CheckAuthorizationResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &CheckAuthorization{
+		Version:    CurrentVersion,
+		ByzCoinID:  c.ID,
+		DarcID:     dID,
+		Identities: ids,
+		Explain:    action,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Trace == nil {
+		return nil, errors.New("no trace in the reply")
+	}
+	return reply.Trace, nil
+}
+
 // GetGenDarc uses the GetProof method to fetch the latest version of the
 // Genesis Darc from ByzCoin and parses it.
 func (c *Client) GetGenDarc() (*darc.Darc, error) {
@@ -330,6 +366,70 @@ func (c *Client) DownloadState(byzcoinID skipchain.SkipBlockID, nonce uint64, le
 	return nil, errors.New("Error while downloading state from nodes")
 }
 
+// GetAllInstanceVersion returns all the state changes of the given
+// instance, which shows how the instance evolved. The Client's Roster and ID
+// should be initialized before calling this method (see NewClientFromConfig).
+func (c *Client) GetAllInstanceVersion(id InstanceID) (*GetAllInstanceVersionResponse, error) {
+	reply := &GetAllInstanceVersionResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetAllInstanceVersion{
+		SkipChainID: c.ID,
+		InstanceID:  id,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetViewChangeStatus returns the state of the view-change controller of the
+// given node: its current view, the pending view-change requests and the
+// reason of the last failed view-change.
+func (c *Client) GetViewChangeStatus(node *network.ServerIdentity) (*GetViewChangeStatusResponse, error) {
+	reply := &GetViewChangeStatusResponse{}
+	err := c.SendProtobuf(node, &GetViewChangeStatus{ByzCoinID: c.ID}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// RequestViewChange asks all the nodes of the latest roster to start a
+// view-change, so that the node at leaderIndex in the current roster becomes
+// the new leader. The signer must satisfy the "invoke:view_change" rule of the
+// genesis darc. An error is returned if less than 2f+1 nodes accepted the
+// request, as the view-change cannot happen in that case.
+func (c *Client) RequestViewChange(signer darc.Signer, leaderIndex int) error {
+	reply, err := c.GetProof(NewInstanceID(nil).Slice())
+	if err != nil {
+		return err
+	}
+	latest := reply.Proof.Latest
+	req := &RequestViewChange{
+		ByzCoinID:   c.ID,
+		LatestID:    latest.Hash,
+		LeaderIndex: leaderIndex,
+	}
+	if err := req.Sign(signer); err != nil {
+		return err
+	}
+
+	var accepted int
+	var lastErr error
+	for _, si := range latest.Roster.List {
+		if err := c.SendProtobuf(si, req, &RequestViewChangeResponse{}); err != nil {
+			log.Warn("Couldn't request view-change from", si.Address, err)
+			lastErr = err
+			continue
+		}
+		accepted++
+	}
+	n := len(latest.Roster.List)
+	if accepted < 2*(n/3)+1 {
+		return fmt.Errorf("only %d out of %d nodes accepted the view-change, last error: %v", accepted, n, lastErr)
+	}
+	return nil
+}
+
 // DefaultGenesisMsg creates the message that is used to for creating the
 // genesis Darc and block.
 func DefaultGenesisMsg(v Version, r *onet.Roster, rules []string, ids ...darc.Identity) (*CreateGenesisBlock, error) {
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	// The contracts of these packages are registered globally, so that
+	// verify can replay the chains that use them.
+	_ "github.com/dedis/cothority/calypso"
+	_ "github.com/dedis/cothority/eventlog"
+	_ "github.com/dedis/cothority/pop/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// chainArchive is the content of the file written by export.
+type chainArchive struct {
+	Blocks []*skipchain.SkipBlock
+}
+
+func export(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+	fn := c.Args().First()
+	if fn == "" {
+		return errors.New("missing archive file")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	pr, err := cl.GetProof(byzcoin.ConfigInstanceID.Slice())
+	if err != nil {
+		return err
+	}
+
+	skcl := skipchain.NewClient()
+	var archive chainArchive
+	for i := 0; i <= pr.Proof.Latest.Index; i++ {
+		reply, err := skcl.GetSingleBlockByIndex(&cfg.Roster, cfg.ByzCoinID, i)
+		if err != nil {
+			return err
+		}
+		archive.Blocks = append(archive.Blocks, reply.SkipBlock)
+	}
+
+	buf, err := protobuf.Encode(&archive)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(fn, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Exported %d blocks of ByzCoin %x to %s\n", len(archive.Blocks), cfg.ByzCoinID, fn)
+	return nil
+}
+
+func verify(c *cli.Context) error {
+	fn := c.Args().First()
+	if fn == "" {
+		return errors.New("missing archive file")
+	}
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	var archive chainArchive
+	err = protobuf.DecodeWithConstructors(buf, &archive, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return err
+	}
+	if len(archive.Blocks) == 0 {
+		return errors.New("archive is empty")
+	}
+	if id := c.String("id"); id != "" {
+		idBuf, err := hex.DecodeString(id)
+		if err != nil {
+			return err
+		}
+		if !archive.Blocks[0].Hash.Equal(idBuf) {
+			return fmt.Errorf("archive holds ByzCoin %x", archive.Blocks[0].Hash)
+		}
+	}
+
+	// The transactions are executed by a ByzCoin service without network
+	// and database, which knows the contracts compiled into bcadmin.
+	err = byzcoin.NewReplayService().ReplayChain(archive.Blocks, func(sb *skipchain.SkipBlock) {
+		fmt.Fprintf(c.App.Writer, "Block %d: %x verified\n", sb.Index, sb.Hash)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Verified %d blocks of ByzCoin %x\n", len(archive.Blocks), archive.Blocks[0].Hash)
+	return nil
+}
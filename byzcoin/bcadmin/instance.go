@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"unicode/utf8"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+func instanceCli(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	arg := c.Args()
+	if len(arg) < 2 {
+		return errors.New("usage: instance get|spawn|invoke|delete <instance ID>")
+	}
+	id, err := parseInstanceID(arg[1])
+	if err != nil {
+		return err
+	}
+
+	switch arg[0] {
+	case "get":
+		return instanceGet(c, cl, id)
+	case "spawn", "invoke", "delete":
+		return instanceSend(c, cfg, cl, arg[0], id)
+	default:
+		return errors.New("Invalid argument for instance command : get, spawn, invoke and delete are the valid options")
+	}
+}
+
+func instanceGet(c *cli.Context, cl *byzcoin.Client, id byzcoin.InstanceID) error {
+	pr, err := cl.GetProof(id.Slice())
+	if err != nil {
+		return err
+	}
+	if err = pr.Proof.Verify(cl.ID); err != nil {
+		return err
+	}
+	if !pr.Proof.InclusionProof.Match(id.Slice()) {
+		return fmt.Errorf("instance %x does not exist", id.Slice())
+	}
+	_, vals := pr.Proof.InclusionProof.KeyValue()
+	var body byzcoin.StateChangeBody
+	if err = protobuf.Decode(vals, &body); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "Instance: %x\n", id.Slice())
+	fmt.Fprintf(c.App.Writer, "Block: %d\n", pr.Proof.Latest.Index)
+	fmt.Fprintf(c.App.Writer, "Contract: %s\n", body.ContractID)
+	fmt.Fprintf(c.App.Writer, "Version: %d\n", body.Version)
+	fmt.Fprintf(c.App.Writer, "Darc: darc:%x\n", body.DarcID)
+
+	if out := c.String("out"); out != "" {
+		return ioutil.WriteFile(out, body.Value, 0644)
+	}
+	if string(body.ContractID) == byzcoin.ContractDarcID {
+		d, err := darc.NewFromProtobuf(body.Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.App.Writer, d.String())
+		return nil
+	}
+	fmt.Fprintf(c.App.Writer, "Value: %x\n", body.Value)
+	if utf8.Valid(body.Value) {
+		fmt.Fprintf(c.App.Writer, "Value as string: %q\n", body.Value)
+	}
+	return nil
+}
+
+func instanceSend(c *cli.Context, cfg lib.Config, cl *byzcoin.Client, action string, id byzcoin.InstanceID) error {
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+	args, err := parseArgs(c.StringSlice("arg"))
+	if err != nil {
+		return err
+	}
+
+	instr := byzcoin.Instruction{InstanceID: id}
+	switch action {
+	case "spawn":
+		contract := c.String("contract")
+		if contract == "" {
+			return errors.New("--contract flag is required")
+		}
+		instr.Spawn = &byzcoin.Spawn{ContractID: contract, Args: args}
+	case "invoke":
+		cmd := c.String("cmd")
+		if cmd == "" {
+			return errors.New("--cmd flag is required")
+		}
+		instr.Invoke = &byzcoin.Invoke{Command: cmd, Args: args}
+	case "delete":
+		instr.Delete = &byzcoin.Delete{}
+	}
+	if err = sendInstr(cl, *signer, &instr); err != nil {
+		return err
+	}
+
+	switch action {
+	case "spawn":
+		fmt.Fprintf(c.App.Writer, "Spawned instance %x\n", instr.DeriveID("").Slice())
+	case "invoke":
+		fmt.Fprintf(c.App.Writer, "Invoked %s on instance %x\n", instr.Invoke.Command, id.Slice())
+	case "delete":
+		fmt.Fprintf(c.App.Writer, "Deleted instance %x\n", id.Slice())
+	}
+	return nil
+}
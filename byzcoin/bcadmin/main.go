@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -96,10 +97,14 @@ var cmds = cli.Commands{
 	},
 	{
 		Name: "darc",
-		Usage: "tool used to manage darcs: it can be used with multiple subcommands (add, show, rule)\n" +
+		Usage: "tool used to manage darcs: it can be used with multiple subcommands (add, show, rule, explain, history, diff, lint)\n" +
 			"add : adds a new DARC with specified characteristics\n" +
 			"show: shows the specified DARC\n" +
-			"rule: allow to add, update or delete a rule of the DARC",
+			"rule: allow to add, update or delete a rule of the DARC\n" +
+			"explain: explains why a rule of the DARC accepts or denies the identities\n" +
+			"history: lists all the versions of the DARC with their block\n" +
+			"diff: shows the rules that changed between two versions of the DARC\n" +
+			"lint: checks the rules of the DARC for unreachable rules, delegation cycles, unknown identities and evolutions by a single key",
 		Aliases: []string{"d"},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -121,11 +126,15 @@ var cmds = cli.Commands{
 			},
 			cli.StringFlag{
 				Name:  "identity",
-				Usage: "the identity of the signer who will be allowed to access the contract (e.g. ed25519:a35020c70b8d735...0357) (always use with rule, except if deleting))",
+				Usage: "the identity of the signer who will be allowed to access the contract (e.g. ed25519:a35020c70b8d735...0357) (always use with rule, except if deleting ; comma separated list of signers with explain))",
 			},
 			cli.StringFlag{
 				Name:  "rule",
-				Usage: "the rule to be added, updated or deleted (always use with rule)",
+				Usage: "the rule to be added, updated or deleted (always use with rule and explain)",
+			},
+			cli.IntFlag{
+				Name:  "threshold",
+				Usage: "number of identities needed, --identity being a comma separated list of identities (eventually use with rule)",
 			},
 			cli.StringFlag{
 				Name:  "out",
@@ -147,9 +156,211 @@ var cmds = cli.Commands{
 				Name:  "delete",
 				Usage: "if this rule already exists, delete the rule (eventually use with rule)",
 			},
+			cli.IntFlag{
+				Name:  "from",
+				Usage: "version of the darc to compare from (eventually use with diff ; default is the version before --to)",
+			},
+			cli.IntFlag{
+				Name:  "to",
+				Usage: "version of the darc to compare to (eventually use with diff ; default is the latest version)",
+			},
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "submit the new rules even if the linter finds severe issues (eventually use with rule)",
+			},
 		},
 		Action: darcCli,
 	},
+	{
+		Name: "nft",
+		Usage: "manage non-fungible assets: it can be used with multiple subcommands (collection, mint, transfer, list)\n" +
+			"collection: creates a new collection of assets\n" +
+			"mint      : creates a new asset in a collection\n" +
+			"transfer  : gives an asset to a new owner\n" +
+			"list      : lists the assets of a collection, or the history of one asset",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (always use)",
+			},
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "public key of the signing entity (eventually use with collection, mint or transfer ; default is admin identity)",
+			},
+			cli.StringFlag{
+				Name:  "darc",
+				Usage: "darc governing the new collection, asset or transferred asset (eventually use with collection, mint or transfer ; default is Genesis DARC for collection and collection DARC for mint, required for transfer)",
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the collection (eventually use with collection)",
+			},
+			cli.StringFlag{
+				Name:  "symbol",
+				Usage: "symbol of the collection (eventually use with collection)",
+			},
+			cli.StringFlag{
+				Name:  "collection",
+				Usage: "instance ID of the collection in hex (always use with mint and list)",
+			},
+			cli.StringFlag{
+				Name:  "asset",
+				Usage: "instance ID of the asset in hex (always use with transfer ; eventually use with list to show its history)",
+			},
+			cli.StringFlag{
+				Name:  "owner",
+				Usage: "identity of the owner of the asset, e.g. ed25519:a35020c70b8d735...0357 (always use with mint and transfer)",
+			},
+			cli.StringFlag{
+				Name:  "metadata",
+				Usage: "metadata of the asset, it cannot be changed later (eventually use with mint)",
+			},
+			cli.StringFlag{
+				Name:  "write",
+				Usage: "instance ID of a calypso write instance in hex holding the content of the asset (eventually use with mint)",
+			},
+		},
+		Action: nftCli,
+	},
+	{
+		Name: "tx",
+		Usage: "build, sign and submit transactions in separate steps: it can be used with multiple subcommands (build, sign, submit)\n" +
+			"build creates an unsigned transaction with one instruction\n" +
+			"sign adds signatures to the transaction, without contacting the ledger\n" +
+			"submit sends the signed transaction to the ledger",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (always use with build and submit)",
+			},
+			cli.StringFlag{
+				Name:  "tx",
+				Usage: "file holding the transaction (always use)",
+			},
+			cli.StringFlag{
+				Name:  "instance",
+				Usage: "instance ID in hex the instruction is sent to (always use with build)",
+			},
+			cli.StringFlag{
+				Name:  "spawn",
+				Usage: "contract ID to spawn (use with build, exclusive with invoke and delete)",
+			},
+			cli.StringFlag{
+				Name:  "invoke",
+				Usage: "command to invoke (use with build, exclusive with spawn and delete)",
+			},
+			cli.BoolFlag{
+				Name:  "delete",
+				Usage: "delete the instance (use with build, exclusive with spawn and invoke)",
+			},
+			cli.StringSliceFlag{
+				Name:  "arg",
+				Usage: "argument of the instruction as name=value, the value can be prefixed with hex:, uint64: or darc: (eventually use with build, can be repeated)",
+			},
+			cli.StringSliceFlag{
+				Name:  "signer",
+				Usage: "identity of a signer of the instruction, e.g. ed25519:a35020c70b8d735...0357 (eventually use with build, can be repeated ; default is admin identity)",
+			},
+			cli.IntFlag{
+				Name:  "expiry",
+				Usage: "number of blocks the transaction stays valid if the ledger uses nonces (eventually use with build ; default is the maximum of the ledger)",
+			},
+			cli.StringSliceFlag{
+				Name:  "key",
+				Usage: "file holding the private key of a signer (use with sign, can be repeated)",
+			},
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "public key of a signer whose private key is in the configuration directory (use with sign)",
+			},
+			cli.IntFlag{
+				Name:  "wait",
+				Usage: "number of block intervals to wait for the inclusion of the transaction (eventually use with submit)",
+				Value: 10,
+			},
+		},
+		Action: txCli,
+	},
+	{
+		Name: "instance",
+		Usage: "read any instance or send any instruction: it can be used with multiple subcommands (get, spawn, invoke, delete) followed by the instance ID\n" +
+			"get prints the verified content of the instance\n" +
+			"spawn, invoke and delete send an instruction to the instance",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (always use)",
+			},
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "public key of the signing entity (eventually use with spawn, invoke or delete ; default is admin identity)",
+			},
+			cli.StringFlag{
+				Name:  "contract",
+				Usage: "contract ID of the new instance (always use with spawn)",
+			},
+			cli.StringFlag{
+				Name:  "cmd",
+				Usage: "command to invoke (always use with invoke)",
+			},
+			cli.StringSliceFlag{
+				Name:  "arg",
+				Usage: "argument of the instruction as name=value, the value can be prefixed with hex:, uint64: or darc: (eventually use with spawn or invoke, can be repeated)",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "output file for the raw value of the instance (eventually use with get)",
+			},
+		},
+		Action: instanceCli,
+	},
+	{
+		Name:      "export",
+		Usage:     "write all the blocks of the ledger to an archive file",
+		ArgsUsage: "archive",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use",
+			},
+		},
+		Action: export,
+	},
+	{
+		Name:      "verify",
+		Usage:     "verify the links of an archive and replay all its transactions offline",
+		ArgsUsage: "archive",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "id",
+				Usage: "ID of the ByzCoin in hex the archive must hold",
+			},
+		},
+		Action: verify,
+	},
+	{
+		Name: "roster",
+		Usage: "change the roster of the ledger: it can be used with multiple subcommands (add, remove, leader)\n" +
+			"add adds the nodes of the given roster files, one node at a time\n" +
+			"remove removes the nodes given by their address or public key, one node at a time\n" +
+			"leader makes the node given by its address or public key the leader",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (always use)",
+			},
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "public key of the signing entity (default is admin identity)",
+			},
+		},
+		Action: rosterCli,
+	},
 }
 
 var cliApp = cli.NewApp()
@@ -431,8 +642,16 @@ func darcCli(c *cli.Context) error {
 		return darcAdd(c, d, cfg, cl)
 	case "rule":
 		return darcRule(c, d, c.Bool("replace"), c.Bool("delete"), cfg, cl)
+	case "explain":
+		return darcExplain(c, d, cl)
+	case "history":
+		return darcHistory(c, d, cl)
+	case "diff":
+		return darcDiff(c, d, cl)
+	case "lint":
+		return darcLint(c, d, cl)
 	default:
-		return errors.New("Invalid argument for darc command : add, show and rule are the valid options")
+		return errors.New("Invalid argument for darc command : add, show, rule, explain, history, diff and lint are the valid options")
 	}
 }
 
@@ -568,6 +787,172 @@ func darcShow(c *cli.Context, d *darc.Darc) error {
 	return nil
 }
 
+func darcExplain(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) error {
+	action := c.String("rule")
+	if action == "" {
+		return errors.New("--rule flag is required")
+	}
+	if c.String("identity") == "" {
+		return errors.New("--identity flag is required")
+	}
+
+	var ids []darc.Identity
+	for _, str := range strings.Split(c.String("identity"), ",") {
+		str = strings.TrimSpace(str)
+		if strings.HasPrefix(str, "darc:") {
+			id, err := parseDarcID(str)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, darc.NewIdentityDarc(id))
+			continue
+		}
+		id, err := parseIdentity(str)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	trace, err := cl.ExplainAuthorization(d.GetBaseID(), darc.Action(action), ids...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "%s: ", action)
+	printTrace(c.App.Writer, trace, "")
+	return nil
+}
+
+// printTrace prints the trace of an expression, followed by its terms. The
+// sign expressions of the delegated darcs are indented below their term.
+func printTrace(w io.Writer, trace *darc.EvalTrace, indent string) {
+	fmt.Fprintf(w, "%s -> %v\n", trace.Expr, trace.Result)
+	if trace.Error != "" {
+		fmt.Fprintf(w, "%s  error: %s\n", indent, trace.Error)
+	}
+	for _, term := range trace.Terms {
+		fmt.Fprintf(w, "%s  %s: %v\n", indent, term.Term, term.Match)
+		del := term.Delegation
+		if del == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s    version %d: ", indent, del.Version)
+		if del.Trace != nil {
+			printTrace(w, del.Trace, indent+"    ")
+		} else {
+			fmt.Fprintln(w, del.Error)
+		}
+	}
+	if trace.Failed != "" {
+		fmt.Fprintf(w, "%s  failed at: %s\n", indent, trace.Failed)
+	}
+}
+
+// getDarcHistory returns the versions of the darc that are still stored by
+// the nodes, and the versions that have been pruned.
+func getDarcHistory(d *darc.Darc, cl *byzcoin.Client) ([]byzcoin.DarcVersion, []uint64, error) {
+	versions, err := cl.GetDarcHistory(d.GetBaseID())
+	if pruned, ok := err.(*byzcoin.PrunedVersionsError); ok {
+		return versions, pruned.Missing, nil
+	}
+	return versions, nil, err
+}
+
+func darcHistory(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) error {
+	versions, missing, err := getDarcHistory(d, cl)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(c.App.Writer, "versions %v have been pruned by the nodes\n", missing)
+	}
+	for _, v := range versions {
+		fmt.Fprintf(c.App.Writer, "version %d: block %d id: %x description: %q\n", v.Darc.Version,
+			v.BlockIndex, v.Darc.GetID(), v.Darc.Description)
+	}
+	return nil
+}
+
+func darcDiff(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) error {
+	versions, _, err := getDarcHistory(d, cl)
+	if err != nil {
+		return err
+	}
+	to := int(d.Version)
+	if c.IsSet("to") {
+		to = c.Int("to")
+	}
+	from := to - 1
+	if c.IsSet("from") {
+		from = c.Int("from")
+	}
+	if from < 0 || to > int(d.Version) || from >= to {
+		return fmt.Errorf("invalid versions %d to %d, the latest version is %d", from, to, d.Version)
+	}
+	fromVersion, err := byzcoin.FindDarcVersion(versions, uint64(from))
+	if err != nil {
+		return err
+	}
+	toVersion, err := byzcoin.FindDarcVersion(versions, uint64(to))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "version %d (block %d) -> version %d (block %d)\n", from, fromVersion.BlockIndex,
+		to, toVersion.BlockIndex)
+	for _, diff := range darc.DiffRules(fromVersion.Darc.Rules, toVersion.Darc.Rules) {
+		fmt.Fprintln(c.App.Writer, diff)
+	}
+	return nil
+}
+
+func darcLint(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) error {
+	issues := printLint(c, d, cl)
+	if len(issues) == 0 {
+		fmt.Fprintln(c.App.Writer, "no issues found")
+	}
+	if n := severeIssues(issues); n > 0 {
+		return fmt.Errorf("found %d severe issues", n)
+	}
+	return nil
+}
+
+// lintDarc checks the new version of a darc before it is submitted. It
+// returns an error if the linter finds severe issues, unless --force is set.
+func lintDarc(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) error {
+	if n := severeIssues(printLint(c, d, cl)); n > 0 && !c.Bool("force") {
+		return fmt.Errorf("found %d severe issues, use --force to submit the darc anyway", n)
+	}
+	return nil
+}
+
+// printLint prints the issues found in the rules of d, resolving the
+// delegated darcs from the ledger.
+func printLint(c *cli.Context, d *darc.Darc, cl *byzcoin.Client) []darc.LintIssue {
+	issues := darc.Lint(d, func(s string, latest bool) *darc.Darc {
+		dd, err := getDarcByString(cl, s)
+		// The proof of a missing darc holds a neighbouring key.
+		if err != nil || darc.NewIdentityDarc(dd.GetBaseID()).String() != s {
+			return nil
+		}
+		return dd
+	})
+	for _, issue := range issues {
+		fmt.Fprintln(c.App.Writer, issue)
+	}
+	return issues
+}
+
+func severeIssues(issues []darc.LintIssue) int {
+	var n int
+	for _, issue := range issues {
+		if issue.Severe() {
+			n++
+		}
+	}
+	return n
+}
+
 func darcRule(c *cli.Context, d *darc.Darc, update bool, delete bool, cfg lib.Config, cl *byzcoin.Client) error {
 	var signer *darc.Signer
 	var err error
@@ -599,19 +984,35 @@ func darcRule(c *cli.Context, d *darc.Darc, update bool, delete bool, cfg lib.Co
 		return errors.New("--identity flag is required")
 	}
 
+	expr := expression.Expr(identity)
+	if k := c.Int("threshold"); k > 0 {
+		ids := strings.Split(identity, ",")
+		for i := range ids {
+			ids[i] = strings.TrimSpace(ids[i])
+		}
+		expr = expression.InitThresholdExpr(k, ids...)
+		if _, err = expression.DefaultParser(expr); err != nil {
+			return fmt.Errorf("invalid threshold expression %s: %v", expr, err)
+		}
+	}
+
 	d2 := d.Copy()
 	d2.EvolveFrom(d)
 
 	if update {
-		err = d2.Rules.UpdateRule(darc.Action(action), []byte(identity))
+		err = d2.Rules.UpdateRule(darc.Action(action), expr)
 	} else {
-		err = d2.Rules.AddRule(darc.Action(action), []byte(identity))
+		err = d2.Rules.AddRule(darc.Action(action), expr)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	if err = lintDarc(c, d2, cl); err != nil {
+		return err
+	}
+
 	d2Buf, err := d2.ToProto()
 	if err != nil {
 		return err
@@ -657,6 +1058,10 @@ func darcRuleDel(c *cli.Context, d *darc.Darc, action string, signer *darc.Signe
 		return err
 	}
 
+	if err = lintDarc(c, d2, cl); err != nil {
+		return err
+	}
+
 	d2Buf, err := d2.ToProto()
 	if err != nil {
 		return err
@@ -756,3 +1161,96 @@ func combineInstrsAndSign(signer darc.Signer, instrs ...byzcoin.Instruction) (by
 	}
 	return t, nil
 }
+
+// getSigner returns the signer given in the --sign flag, or the admin
+// signer if the flag is missing.
+func getSigner(c *cli.Context, cfg lib.Config) (*darc.Signer, error) {
+	sstr := c.String("sign")
+	if sstr == "" {
+		return lib.LoadKey(cfg.AdminIdentity)
+	}
+	return lib.LoadKeyFromString(sstr)
+}
+
+// sendInstr sets the counter or the nonce of the instruction, signs it and
+// waits for the transaction to be included. The instruction is updated with
+// the signature, so that DeriveID returns the ID of the spawned instance.
+func sendInstr(cl *byzcoin.Client, signer darc.Signer, instr *byzcoin.Instruction) error {
+	if err := setReplayProtection(cl, instr, 0, signer.Identity().String()); err != nil {
+		return err
+	}
+	ctx, err := combineInstrsAndSign(signer, *instr)
+	if err != nil {
+		return err
+	}
+	*instr = ctx.Instructions[0]
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	return err
+}
+
+// setReplayProtection sets the counters of the signers in the instruction,
+// or a nonce if the ledger uses nonces. The expiry of the nonce is the
+// number of blocks the instruction stays valid, 0 for the maximum of the
+// ledger.
+func setReplayProtection(cl *byzcoin.Client, instr *byzcoin.Instruction, expiry uint64, signers ...string) error {
+	config, err := cl.GetChainConfig()
+	if err != nil {
+		return err
+	}
+	if config.ReplayProtection == byzcoin.ReplayNonce {
+		pr, err := cl.GetProof(byzcoin.ConfigInstanceID.Slice())
+		if err != nil {
+			return err
+		}
+		if expiry == 0 || expiry > config.NonceMaxExpiry {
+			expiry = config.NonceMaxExpiry
+		}
+		instr.SetNonce(uint64(pr.Proof.Latest.Index) + 1 + expiry)
+		return nil
+	}
+
+	counters, err := cl.GetSignerCounters(signers...)
+	if err != nil {
+		return err
+	}
+	if len(counters.Counters) != len(signers) {
+		return errors.New("invalid result from GetSignerCounters")
+	}
+	instr.SignerCounter = nil
+	for _, ctr := range counters.Counters {
+		instr.SignerCounter = append(instr.SignerCounter, ctr+1)
+	}
+	return nil
+}
+
+// instanceIDFlag parses a flag holding an instance ID in hex.
+func instanceIDFlag(c *cli.Context, name string) (byzcoin.InstanceID, error) {
+	str := c.String(name)
+	if str == "" {
+		return byzcoin.InstanceID{}, fmt.Errorf("--%s flag is required", name)
+	}
+	return parseInstanceID(str)
+}
+
+// parseInstanceID parses an instance ID in hex. The ID of a darc instance
+// can also be given as darc:<hex>.
+func parseInstanceID(str string) (byzcoin.InstanceID, error) {
+	buf, err := hex.DecodeString(strings.TrimPrefix(str, "darc:"))
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	if len(buf) != len(byzcoin.InstanceID{}) {
+		return byzcoin.InstanceID{}, fmt.Errorf("%s is not an instance ID", str)
+	}
+	return byzcoin.NewInstanceID(buf), nil
+}
+
+// parseDarcID parses a darc ID given as darc:<hex>, like the darc command
+// prints it.
+func parseDarcID(str string) (darc.ID, error) {
+	buf, err := hex.DecodeString(strings.TrimPrefix(str, "darc:"))
+	if err != nil {
+		return nil, err
+	}
+	return darc.ID(buf), nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/byzcoin/contracts"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+func nftCli(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	arg := c.Args()
+	if len(arg) == 0 {
+		return errors.New("missing subcommand: collection, mint, transfer or list")
+	}
+
+	switch arg[0] {
+	case "collection":
+		return nftCollection(c, cfg, cl)
+	case "mint":
+		return nftMint(c, cfg, cl)
+	case "transfer":
+		return nftTransfer(c, cfg, cl)
+	case "list":
+		return nftList(c, cl)
+	default:
+		return errors.New("Invalid argument for nft command : collection, mint, transfer and list are the valid options")
+	}
+}
+
+func nftCollection(c *cli.Context, cfg lib.Config, cl *byzcoin.Client) error {
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	d, err := cl.GetGenDarc()
+	if err != nil {
+		return err
+	}
+	darcID := d.GetBaseID()
+	if dstr := c.String("darc"); dstr != "" {
+		darcID, err = parseDarcID(dstr)
+		if err != nil {
+			return err
+		}
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractNFTCollectionID,
+			Args: byzcoin.Arguments{
+				{Name: "name", Value: []byte(c.String("name"))},
+				{Name: "symbol", Value: []byte(c.String("symbol"))},
+			},
+		},
+	}
+	if err := sendInstr(cl, *signer, &instr); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "Created collection %x\n", instr.DeriveID("").Slice())
+	return nil
+}
+
+func nftMint(c *cli.Context, cfg lib.Config, cl *byzcoin.Client) error {
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	collID, err := instanceIDFlag(c, "collection")
+	if err != nil {
+		return err
+	}
+	owner := c.String("owner")
+	if owner == "" {
+		return errors.New("--owner flag is required")
+	}
+	coll, err := getNFTCollection(cl, collID)
+	if err != nil {
+		return err
+	}
+
+	args := byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner)},
+		{Name: "metadata", Value: []byte(c.String("metadata"))},
+	}
+	if c.String("write") != "" {
+		write, err := instanceIDFlag(c, "write")
+		if err != nil {
+			return err
+		}
+		args = append(args, byzcoin.Argument{Name: "write", Value: write.Slice()})
+	}
+	if dstr := c.String("darc"); dstr != "" {
+		darcID, err := parseDarcID(dstr)
+		if err != nil {
+			return err
+		}
+		args = append(args, byzcoin.Argument{Name: "darc", Value: darcID})
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: collID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractNFTID,
+			Args:       args,
+		},
+	}
+	if err := sendInstr(cl, *signer, &instr); err != nil {
+		return err
+	}
+
+	// The index is only a guess, as another asset might have been minted
+	// in the meantime.
+	assetID := contracts.NFTAssetID(collID, coll.Count)
+	pr, err := cl.GetProof(assetID.Slice())
+	if err != nil {
+		return err
+	}
+	if !pr.Proof.InclusionProof.Match(assetID.Slice()) {
+		return errors.New("asset has been minted, but not at the expected index - use list to find it")
+	}
+	fmt.Fprintf(c.App.Writer, "Minted asset %x\n", assetID.Slice())
+	return nil
+}
+
+func nftTransfer(c *cli.Context, cfg lib.Config, cl *byzcoin.Client) error {
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	assetID, err := instanceIDFlag(c, "asset")
+	if err != nil {
+		return err
+	}
+	owner := c.String("owner")
+	if owner == "" {
+		return errors.New("--owner flag is required")
+	}
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		return errors.New("--darc flag is required")
+	}
+	darcID, err := parseDarcID(dstr)
+	if err != nil {
+		return err
+	}
+	args := byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner)},
+		{Name: "darc", Value: darcID},
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: assetID,
+		Invoke: &byzcoin.Invoke{
+			Command: "transfer",
+			Args:    args,
+		},
+	}
+	if err := sendInstr(cl, *signer, &instr); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "Transferred asset %x to %s\n", assetID.Slice(), owner)
+	return nil
+}
+
+func nftList(c *cli.Context, cl *byzcoin.Client) error {
+	if c.String("asset") != "" {
+		assetID, err := instanceIDFlag(c, "asset")
+		if err != nil {
+			return err
+		}
+		return nftHistory(c, cl, assetID)
+	}
+
+	collID, err := instanceIDFlag(c, "collection")
+	if err != nil {
+		return err
+	}
+	coll, err := getNFTCollection(cl, collID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "Collection %s (%s) with %d assets\n", coll.Name, coll.Symbol, coll.Count)
+	for i := uint64(0); i < coll.Count; i++ {
+		assetID := contracts.NFTAssetID(collID, i)
+		pr, err := cl.GetProof(assetID.Slice())
+		if err != nil {
+			return err
+		}
+		if !pr.Proof.InclusionProof.Match(assetID.Slice()) {
+			fmt.Fprintf(c.App.Writer, "%d: %x deleted\n", i, assetID.Slice())
+			continue
+		}
+		_, v, _, _, err := pr.Proof.KeyValue()
+		if err != nil {
+			return err
+		}
+		var asset contracts.NFTAsset
+		if err := protobuf.Decode(v, &asset); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "%d: %x owner: %s metadata: %q\n", i, assetID.Slice(), asset.Owner, asset.Metadata)
+	}
+	return nil
+}
+
+func nftHistory(c *cli.Context, cl *byzcoin.Client, assetID byzcoin.InstanceID) error {
+	resp, err := cl.GetAllInstanceVersion(assetID)
+	if err != nil {
+		return err
+	}
+	for _, sc := range resp.StateChanges {
+		if sc.StateChange.StateAction == byzcoin.Remove {
+			fmt.Fprintf(c.App.Writer, "block %d: deleted\n", sc.BlockIndex)
+			continue
+		}
+		var asset contracts.NFTAsset
+		if err := protobuf.Decode(sc.StateChange.Value, &asset); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "block %d: version %d owner: %s darc: %x\n", sc.BlockIndex,
+			sc.StateChange.Version, asset.Owner, sc.StateChange.DarcID)
+	}
+	return nil
+}
+
+func getNFTCollection(cl *byzcoin.Client, id byzcoin.InstanceID) (*contracts.NFTCollection, error) {
+	pr, err := cl.GetProof(id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	_, v, cid, _, err := pr.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if cid != contracts.ContractNFTCollectionID {
+		return nil, errors.New("instance is not a collection")
+	}
+	coll := &contracts.NFTCollection{}
+	if err := protobuf.Decode(v, coll); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// The roster command changes the roster of the ledger with update_config
+// instructions. As the ledger only accepts one node to be added or removed
+// per change, adding or removing several nodes is done with one transaction
+// per node. After every change, the roster of the bcadmin config is updated.
+
+func rosterCli(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	arg := c.Args()
+	if len(arg) < 2 {
+		return errors.New("usage: roster add <roster.toml>... | remove <node>... | leader <node>")
+	}
+
+	switch arg[0] {
+	case "add":
+		return rosterAdd(c, &cfg, cl, arg[1:])
+	case "remove":
+		return rosterRemove(c, &cfg, cl, arg[1:])
+	case "leader":
+		return rosterLeader(c, &cfg, cl, arg[1])
+	default:
+		return errors.New("Invalid argument for roster command : add, remove and leader are the valid options")
+	}
+}
+
+func rosterAdd(c *cli.Context, cfg *lib.Config, cl *byzcoin.Client, files []string) error {
+	var nodes []*network.ServerIdentity
+	for _, fn := range files {
+		r, err := lib.ReadRoster(fn)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, r.List...)
+	}
+
+	for _, node := range nodes {
+		config, err := cl.GetChainConfig()
+		if err != nil {
+			return err
+		}
+		if i, _ := config.Roster.Search(node.ID); i >= 0 {
+			fmt.Fprintf(c.App.Writer, "%s is already in the roster\n", node.Address)
+			continue
+		}
+		list := append(append([]*network.ServerIdentity{}, config.Roster.List...), node)
+		if err = rosterUpdate(c, cfg, cl, config, onet.NewRoster(list)); err != nil {
+			return err
+		}
+		// The next change can only be done once the new node is up to
+		// date, else it might not be able to sign the blocks.
+		if err = waitNode(cl, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rosterRemove(c *cli.Context, cfg *lib.Config, cl *byzcoin.Client, nodes []string) error {
+	for _, node := range nodes {
+		config, err := cl.GetChainConfig()
+		if err != nil {
+			return err
+		}
+		i := searchNode(config.Roster, node)
+		if i < 0 {
+			return fmt.Errorf("%s is not in the roster", node)
+		}
+		list := append([]*network.ServerIdentity{}, config.Roster.List[:i]...)
+		list = append(list, config.Roster.List[i+1:]...)
+		if err = rosterUpdate(c, cfg, cl, config, onet.NewRoster(list)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rosterLeader(c *cli.Context, cfg *lib.Config, cl *byzcoin.Client, node string) error {
+	config, err := cl.GetChainConfig()
+	if err != nil {
+		return err
+	}
+	i := searchNode(config.Roster, node)
+	if i < 0 {
+		return fmt.Errorf("%s is not in the roster", node)
+	}
+	if i == 0 {
+		fmt.Fprintf(c.App.Writer, "%s is already the leader\n", node)
+		return nil
+	}
+	list := []*network.ServerIdentity{config.Roster.List[i]}
+	list = append(list, config.Roster.List[:i]...)
+	list = append(list, config.Roster.List[i+1:]...)
+	return rosterUpdate(c, cfg, cl, config, onet.NewRoster(list))
+}
+
+// rosterUpdate validates the new roster, sends the update_config
+// instruction and waits for it to be included.
+func rosterUpdate(c *cli.Context, cfg *lib.Config, cl *byzcoin.Client, config *byzcoin.ChainConfig, roster *onet.Roster) error {
+	newConfig := *config
+	newConfig.Roster = *roster
+	if err := config.CheckUpdate(newConfig); err != nil {
+		return err
+	}
+	configBuf, err := protobuf.Encode(&newConfig)
+	if err != nil {
+		return err
+	}
+
+	signer, err := getSigner(c, *cfg)
+	if err != nil {
+		return err
+	}
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.ConfigInstanceID,
+		Invoke: &byzcoin.Invoke{
+			Command: "update_config",
+			Args:    byzcoin.Arguments{{Name: "config", Value: configBuf}},
+		},
+	}
+	if err = sendInstr(cl, *signer, &instr); err != nil {
+		return err
+	}
+
+	cl.Roster = *roster
+	cfg.Roster = *roster
+	if _, err = lib.SaveConfig(*cfg); err != nil {
+		return err
+	}
+	var addresses []string
+	for _, si := range roster.List {
+		addresses = append(addresses, string(si.Address))
+	}
+	fmt.Fprintln(c.App.Writer, "New roster:", strings.Join(addresses, ", "))
+	return nil
+}
+
+// searchNode returns the index of the node given by its address or its
+// public key, or -1 if it is not in the roster.
+func searchNode(roster onet.Roster, node string) int {
+	for i, si := range roster.List {
+		if string(si.Address) == node || si.Public.String() == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitNode waits until the node returns the latest config.
+func waitNode(cl *byzcoin.Client, node *network.ServerIdentity) error {
+	latest, err := cl.GetProof(byzcoin.ConfigInstanceID.Slice())
+	if err != nil {
+		return err
+	}
+	nodeCl := byzcoin.NewClient(cl.ID, *onet.NewRoster([]*network.ServerIdentity{node}))
+	for i := 0; i < 10; i++ {
+		pr, err := nodeCl.GetProof(byzcoin.ConfigInstanceID.Slice())
+		if err == nil && pr.Proof.Latest.Index >= latest.Proof.Latest.Index {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("%s didn't catch up with the ledger", node.Address)
+}
@@ -3,20 +3,28 @@
 DBG_TEST=1
 DBG_SRV=0
 
-NBR_SERVERS=3
+NBR_SERVERS=4
 NBR_SERVERS_GROUP=3
 
 . "$(go env GOPATH)/src/github.com/dedis/cothority/libtest.sh"
 
 main(){
     startTest
-    buildConode github.com/dedis/cothority/byzcoin
+    buildConode github.com/dedis/cothority/byzcoin github.com/dedis/cothority/byzcoin/contracts
     run testCreateStoreRead
     run testAddDarc
     run testRuleDarc
+    run testExplainDarc
+    run testHistoryDarc
+    run testLintDarc
     run testAddDarcFromOtherOne
     run testAddDarcWithOwner
     run testExpression
+    run testNFT
+    run testTx
+    run testInstance
+    run testExport
+    run testRoster
     stopTest
 }
 
@@ -58,12 +66,70 @@ testRuleDarc(){
   testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
   ID=`cat ./darc_id.txt`
   KEY=`cat ./darc_key.txt`
-  testOK ./"$APP" darc rule -rule spawn:xxx -identity ed25519:foo -darc "$ID" -sign "$KEY"
+  testOK ./"$APP" darc rule -force -rule spawn:xxx -identity ed25519:foo -darc "$ID" -sign "$KEY"
   testGrep "spawn:xxx - \"ed25519:foo\"" ./"$APP" darc show -darc "$ID"
-  testOK ./"$APP" darc rule -replace -rule spawn:xxx -identity "ed25519:foo | ed25519:oof" -darc "$ID" -sign "$KEY"
+  testOK ./"$APP" darc rule -force -replace -rule spawn:xxx -identity "ed25519:foo | ed25519:oof" -darc "$ID" -sign "$KEY"
   testGrep "spawn:xxx - \"ed25519:foo | ed25519:oof\"" ./"$APP" darc show -darc "$ID"
   testOK ./"$APP" darc rule -delete -rule spawn:xxx -darc "$ID" -sign "$KEY"
   testNGrep "spawn:xxx" ./"$APP" darc show -darc "$ID"
+  testOK ./"$APP" darc rule -force -rule spawn:xxx -threshold 2 -identity "ed25519:aa, ed25519:bb, darc:cc" -darc "$ID" -sign "$KEY"
+  testGrep "spawn:xxx - \"\[ed25519:aa, ed25519:bb, darc:cc\]/2\"" ./"$APP" darc show -darc "$ID"
+  testFail ./"$APP" darc rule -replace -rule spawn:xxx -threshold 3 -identity "ed25519:aa, ed25519:bb" -darc "$ID" -sign "$KEY"
+  testFail ./"$APP" darc rule -replace -rule spawn:xxx -threshold 1 -identity "ed25519:aa, ed25519:aa" -darc "$ID" -sign "$KEY"
+}
+
+testExplainDarc(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
+  ID=`cat ./darc_id.txt`
+  KEY=`cat ./darc_key.txt`
+  testOK ./"$APP" key -save ./key.txt
+  OTHER=`cat ./key.txt`
+  testGrep "_sign: $KEY -> true" ./"$APP" darc explain -rule _sign -identity "$KEY" -darc "$ID"
+  testGrep "failed at: $KEY" ./"$APP" darc explain -rule _sign -identity "$OTHER" -darc "$ID"
+  testGrep "_sign: $KEY -> true" ./"$APP" darc explain -rule _sign -identity "$OTHER, $KEY" -darc "$ID"
+  testFail ./"$APP" darc explain -rule spawn:xxx -identity "$KEY" -darc "$ID"
+  testFail ./"$APP" darc explain -rule _sign -darc "$ID"
+}
+
+testLintDarc(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
+  ID=`cat ./darc_id.txt`
+  KEY=`cat ./darc_key.txt`
+  testGrep "invoke:evolve: single key: $KEY can evolve the darc alone" ./"$APP" darc lint -darc "$ID"
+  testOK ./"$APP" darc lint -darc "$ID"
+  testFail ./"$APP" darc rule -rule spawn:xxx -identity rsa:abcd -darc "$ID" -sign "$KEY"
+  testFail ./"$APP" darc rule -rule spawn:xxx -identity "$KEY & darc:abcd" -darc "$ID" -sign "$KEY"
+  testNGrep "spawn:xxx" ./"$APP" darc show -darc "$ID"
+  testOK ./"$APP" darc rule -force -rule spawn:xxx -identity rsa:abcd -darc "$ID" -sign "$KEY"
+  testGrep "spawn:xxx: unreachable" ./"$APP" darc lint -darc "$ID"
+  testFail ./"$APP" darc lint -darc "$ID"
+}
+
+testHistoryDarc(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
+  ID=`cat ./darc_id.txt`
+  KEY=`cat ./darc_key.txt`
+  testOK ./"$APP" darc rule -force -rule spawn:xxx -identity ed25519:foo -darc "$ID" -sign "$KEY"
+  testOK ./"$APP" darc rule -force -replace -rule spawn:xxx -identity ed25519:bar -darc "$ID" -sign "$KEY"
+  testGrep "version 2: block" ./"$APP" darc history -darc "$ID"
+  testGrep "~ spawn:xxx: ed25519:foo -> ed25519:bar" ./"$APP" darc diff -darc "$ID"
+  testGrep "+ spawn:xxx: ed25519:bar" ./"$APP" darc diff -from 0 -darc "$ID"
+  testFail ./"$APP" darc diff -from 2 -to 1 -darc "$ID"
 }
 
 testAddDarcFromOtherOne(){
@@ -114,4 +180,112 @@ testExpression(){
   testFail ./"$APP" darc add -darc "$ID" -sign "$KEY2"
 }
 
+testNFT(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" key -save ./key.txt
+  KEY=`cat ./key.txt`
+  testOK ./"$APP" add spawn:nftCollection -identity "$KEY"
+  testOK ./"$APP" add spawn:nft -identity "$KEY"
+  testOK ./"$APP" add invoke:transfer -identity "$KEY"
+  testFail ./"$APP" nft collection -name art -symbol ART
+  runGrepSed "Created collection" "s/.* //" ./"$APP" nft collection -name art -symbol ART -sign "$KEY"
+  COLL=$SED
+  [ -z "$COLL" ] && exit 1
+  testFail ./"$APP" nft mint -collection "$COLL" -sign "$KEY"
+  runGrepSed "Minted asset" "s/.* //" ./"$APP" nft mint -collection "$COLL" -owner "$KEY" -metadata first -sign "$KEY"
+  ASSET=$SED
+  [ -z "$ASSET" ] && exit 1
+  testGrep "0: $ASSET owner: $KEY" ./"$APP" nft list -collection "$COLL"
+  testOK ./"$APP" darc add -out_id ./darc_id.txt
+  ID=`cat ./darc_id.txt`
+  testFail ./"$APP" nft transfer -asset "$ASSET" -owner ed25519:aa -sign "$KEY"
+  testOK ./"$APP" nft transfer -asset "$ASSET" -owner ed25519:aa -darc "$ID" -sign "$KEY"
+  testGrep "0: $ASSET owner: ed25519:aa" ./"$APP" nft list -collection "$COLL"
+  testGrep "version 1 owner: ed25519:aa" ./"$APP" nft list -asset "$ASSET"
+}
+
+testTx(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
+  ID=`cat ./darc_id.txt`
+  DKEY=`cat ./darc_key.txt`
+  testOK ./"$APP" key -save ./key1.txt
+  KEY1=`cat ./key1.txt`
+  testOK ./"$APP" key -save ./key2.txt
+  KEY2=`cat ./key2.txt`
+  testOK ./"$APP" darc rule -rule spawn:value -identity "$KEY1 & $KEY2" -darc "$ID" -sign "$DKEY"
+
+  testOK ./"$APP" tx build -tx tx.bin -instance "${ID:5}" -spawn value -arg value=hello -signer "$KEY1" -signer "$KEY2"
+  testFail ./"$APP" tx submit -tx tx.bin
+  testOK ./"$APP" tx sign -tx tx.bin -sign "$KEY1"
+  testFail ./"$APP" tx sign -tx tx.bin -sign "$DKEY"
+  testFail ./"$APP" tx submit -tx tx.bin
+  testOK ./"$APP" tx sign -tx tx.bin -sign "$KEY2"
+  testGrep "Spawned instance" ./"$APP" tx submit -tx tx.bin
+}
+
+testInstance(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add -out_id ./darc_id.txt -out_key ./darc_key.txt
+  ID=`cat ./darc_id.txt`
+  KEY=`cat ./darc_key.txt`
+  testOK ./"$APP" darc rule -rule spawn:value -identity "$KEY" -darc "$ID" -sign "$KEY"
+  testOK ./"$APP" darc rule -rule invoke:update -identity "$KEY" -darc "$ID" -sign "$KEY"
+  testOK ./"$APP" darc rule -rule delete -identity "$KEY" -darc "$ID" -sign "$KEY"
+
+  testGrep "Contract: darc" ./"$APP" instance get "$ID"
+  testFail ./"$APP" instance spawn "$ID" -arg value=hello -sign "$KEY"
+  runGrepSed "Spawned instance" "s/.* //" ./"$APP" instance spawn "$ID" -contract value -arg value=hello -sign "$KEY"
+  VALUE=$SED
+  [ -z "$VALUE" ] && exit 1
+  testGrep "Value as string: \"hello\"" ./"$APP" instance get "$VALUE"
+  testOK ./"$APP" instance invoke "$VALUE" -cmd update -arg value=world -sign "$KEY"
+  testGrep "Version: 1" ./"$APP" instance get "$VALUE"
+  testOK ./"$APP" instance delete "$VALUE" -sign "$KEY"
+  testFail ./"$APP" instance get "$VALUE"
+}
+
+testExport(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK ./"$APP" darc add
+  testOK ./"$APP" darc add
+  testOK ./"$APP" export chain.bin
+  testGrep "Block 2" ./"$APP" verify chain.bin
+  testFail ./"$APP" verify -id 0000 chain.bin
+}
+
+testRoster(){
+  runCoBG 1 2 3 4
+  runGrepSed "export BC=" "" ./"$APP" create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  ADDR1=`grep Address co1/public.toml | sed -e 's/.*"\(.*\)"/\1/'`
+  ADDR2=`grep Address co2/public.toml | sed -e 's/.*"\(.*\)"/\1/'`
+  ADDR4=`grep Address co4/public.toml | sed -e 's/.*"\(.*\)"/\1/'`
+  # A roster needs at least 3 nodes.
+  testFail ./"$APP" roster remove "$ADDR2"
+  testGrep "New roster: $ADDR1, .*$ADDR4" ./"$APP" roster add co4/public.toml
+  testGrep "New roster: $ADDR2, $ADDR1" ./"$APP" roster leader "$ADDR2"
+  testOK ./"$APP" roster remove "$ADDR1"
+  testGrep "Roster: $ADDR2, " ./"$APP" show
+  testNGrep "$ADDR1" ./"$APP" show
+}
+
 main
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// The tx command splits the creation of a transaction in three steps, so
+// that the signing can happen on a machine that is not connected:
+//  - build creates an unsigned transaction with one instruction. It needs
+//    the ledger to fetch the counters of the signers.
+//  - sign adds the signatures of one or more signers to the transaction.
+//    It works offline, and can be repeated on different machines until all
+//    the signers have signed.
+//  - submit sends the signed transaction to the ledger.
+// The transaction is stored as a protobuf-encoded ClientTransaction.
+
+func txCli(c *cli.Context) error {
+	arg := c.Args()
+	if len(arg) == 0 {
+		return errors.New("missing subcommand: build, sign or submit")
+	}
+
+	switch arg[0] {
+	case "build":
+		return txBuild(c)
+	case "sign":
+		return txSign(c)
+	case "submit":
+		return txSubmit(c)
+	default:
+		return errors.New("Invalid argument for tx command : build, sign and submit are the valid options")
+	}
+}
+
+func txBuild(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instr, err := instructionFlags(c)
+	if err != nil {
+		return err
+	}
+
+	signers := c.StringSlice("signer")
+	if len(signers) == 0 {
+		signers = []string{cfg.AdminIdentity.String()}
+	}
+	for _, s := range signers {
+		id, err := parseIdentity(s)
+		if err != nil {
+			return err
+		}
+		instr.Signatures = append(instr.Signatures, darc.Signature{Signer: id})
+	}
+
+	expiry := c.Int("expiry")
+	if expiry < 0 {
+		return errors.New("--expiry must be positive")
+	}
+	if err = setReplayProtection(cl, instr, uint64(expiry), signers...); err != nil {
+		return err
+	}
+
+	ctx := byzcoin.ClientTransaction{Instructions: []byzcoin.Instruction{*instr}}
+	if err = writeTx(c.String("tx"), ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Wrote unsigned transaction %x to %s\n", ctx.Instructions.Hash(), c.String("tx"))
+	return nil
+}
+
+func txSign(c *cli.Context) error {
+	ctx, err := readTx(c.String("tx"))
+	if err != nil {
+		return err
+	}
+
+	var signers []*darc.Signer
+	for _, fn := range c.StringSlice("key") {
+		signer, err := lib.LoadSigner(fn)
+		if err != nil {
+			return err
+		}
+		signers = append(signers, signer)
+	}
+	if sstr := c.String("sign"); sstr != "" {
+		signer, err := lib.LoadKeyFromString(sstr)
+		if err != nil {
+			return err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return errors.New("--key or --sign flag is required")
+	}
+
+	h := ctx.Instructions.Hash()
+	for _, signer := range signers {
+		id := signer.Identity()
+		found := false
+		for i := range ctx.Instructions {
+			for j, sig := range ctx.Instructions[i].Signatures {
+				if !sig.Signer.Equal(&id) {
+					continue
+				}
+				ctx.Instructions[i].Signatures[j].Signature, err = signer.Sign(h)
+				if err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not a signer of the transaction", id.String())
+		}
+		fmt.Fprintf(c.App.Writer, "Signed by %s\n", id.String())
+	}
+
+	return writeTx(c.String("tx"), ctx)
+}
+
+func txSubmit(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := readTx(c.String("tx"))
+	if err != nil {
+		return err
+	}
+	h := ctx.Instructions.Hash()
+	for _, instr := range ctx.Instructions {
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) == 0 {
+				return fmt.Errorf("missing signature of %s", sig.Signer.String())
+			}
+			if err := sig.Signer.Verify(h, sig.Signature); err != nil {
+				return fmt.Errorf("invalid signature of %s: %s", sig.Signer.String(), err)
+			}
+		}
+	}
+
+	if _, err = cl.AddTransactionAndWait(ctx, c.Int("wait")); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Submitted transaction %x\n", h)
+	for _, instr := range ctx.Instructions {
+		if instr.Spawn != nil {
+			fmt.Fprintf(c.App.Writer, "Spawned instance %x\n", instr.DeriveID("").Slice())
+		}
+	}
+	return nil
+}
+
+// instructionFlags returns the instruction given by the --instance, --spawn,
+// --invoke, --delete and --arg flags.
+func instructionFlags(c *cli.Context) (*byzcoin.Instruction, error) {
+	id, err := instanceIDFlag(c, "instance")
+	if err != nil {
+		return nil, err
+	}
+	args, err := parseArgs(c.StringSlice("arg"))
+	if err != nil {
+		return nil, err
+	}
+
+	instr := &byzcoin.Instruction{InstanceID: id}
+	n := 0
+	if contract := c.String("spawn"); contract != "" {
+		instr.Spawn = &byzcoin.Spawn{ContractID: contract, Args: args}
+		n++
+	}
+	if cmd := c.String("invoke"); cmd != "" {
+		instr.Invoke = &byzcoin.Invoke{Command: cmd, Args: args}
+		n++
+	}
+	if c.Bool("delete") {
+		instr.Delete = &byzcoin.Delete{}
+		n++
+	}
+	if n != 1 {
+		return nil, errors.New("need exactly one of --spawn, --invoke or --delete")
+	}
+	return instr, nil
+}
+
+// parseArgs parses arguments of the form name=value. The value is taken as
+// a string, except if it is prefixed by:
+//   - hex: for binary values given in hex
+//   - uint64: for 64-bit uints in LittleEndian, as used by the coin contract
+//   - darc: for darc IDs
+func parseArgs(strs []string) (byzcoin.Arguments, error) {
+	var args byzcoin.Arguments
+	for _, str := range strs {
+		kv := strings.SplitN(str, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("argument %s is not of the form name=value", str)
+		}
+		value, err := parseArgValue(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %s", kv[0], err)
+		}
+		args = append(args, byzcoin.Argument{Name: kv[0], Value: value})
+	}
+	return args, nil
+}
+
+func parseArgValue(str string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(str, "hex:"):
+		return hex.DecodeString(str[4:])
+	case strings.HasPrefix(str, "uint64:"):
+		v, err := strconv.ParseUint(str[7:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, v)
+		return buf, nil
+	case strings.HasPrefix(str, "darc:"):
+		return parseDarcID(str)
+	}
+	return []byte(str), nil
+}
+
+// parseIdentity parses the string representation of a primary identity,
+// as it is printed by the key command.
+func parseIdentity(str string) (darc.Identity, error) {
+	kv := strings.SplitN(str, ":", 2)
+	if len(kv) != 2 {
+		return darc.Identity{}, fmt.Errorf("%s is not an identity", str)
+	}
+	buf, err := hex.DecodeString(kv[1])
+	if err != nil {
+		return darc.Identity{}, err
+	}
+	switch kv[0] {
+	case "ed25519":
+		point := cothority.Suite.Point()
+		if err := point.UnmarshalBinary(buf); err != nil {
+			return darc.Identity{}, err
+		}
+		return darc.NewIdentityEd25519(point), nil
+	case "x509ec":
+		return darc.NewIdentityX509EC(buf), nil
+	case "bls":
+		return darc.Identity{BLS: &darc.IdentityBLS{Public: buf}}, nil
+	case "secp256k1":
+		id := darc.NewIdentitySecp256k1(buf)
+		if id.Type() == -1 {
+			return darc.Identity{}, fmt.Errorf("%s is not a secp256k1 public key", str)
+		}
+		return id, nil
+	default:
+		return darc.Identity{}, fmt.Errorf("cannot sign offline with %s identities", kv[0])
+	}
+}
+
+func readTx(fn string) (ctx byzcoin.ClientTransaction, err error) {
+	if fn == "" {
+		return ctx, errors.New("--tx flag is required")
+	}
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return
+	}
+	err = protobuf.DecodeWithConstructors(buf, &ctx, network.DefaultConstructors(cothority.Suite))
+	return
+}
+
+func writeTx(fn string, ctx byzcoin.ClientTransaction) error {
+	if fn == "" {
+		return errors.New("--tx flag is required")
+	}
+	buf, err := protobuf.Encode(&ctx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, buf, 0644)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dedis/cothority"
@@ -47,6 +48,38 @@ func RegisterContract(s skipchain.GetService, kind string, f ContractFn) error {
 	return scs.(*Service).registerContract(kind, f)
 }
 
+var globalContracts = make(map[string]ContractFn)
+var globalContractsMut sync.Mutex
+
+// RegisterGlobalContract stores the contract for all the ByzCoin services,
+// including the ones that are not attached to a conode. It must be called
+// before the services are created, usually in the init function of the
+// package of the contract.
+func RegisterGlobalContract(kind string, f ContractFn) error {
+	globalContractsMut.Lock()
+	defer globalContractsMut.Unlock()
+	if _, exists := globalContracts[kind]; exists {
+		return errors.New("contract already registered: " + kind)
+	}
+	globalContracts[kind] = f
+	return nil
+}
+
+// registerGlobalContracts adds the contracts registered with
+// RegisterGlobalContract and RegisterGlobalContractVersion to the service.
+func (s *Service) registerGlobalContracts() {
+	globalContractsMut.Lock()
+	defer globalContractsMut.Unlock()
+	for kind, f := range globalContracts {
+		s.registerContract(kind, f)
+	}
+	for kind, versions := range globalContractVersions {
+		for version, cv := range versions {
+			s.registerContractVersion(kind, version, cv.fn, cv.migrate)
+		}
+	}
+}
+
 // BasicContract is a type that contracts may choose to embed in order to provide
 // default implementations for the Contract interface.
 type BasicContract struct{}
@@ -104,12 +137,13 @@ var CmdDarcEvolve = "evolve"
 type contractConfig struct {
 	BasicContract
 	ChainConfig
+	s *Service
 }
 
 var _ Contract = (*contractConfig)(nil)
 
-func contractConfigFromBytes(in []byte) (Contract, error) {
-	c := &contractConfig{}
+func (s *Service) contractConfigFromBytes(in []byte) (Contract, error) {
+	c := &contractConfig{s: s}
 	err := protobuf.DecodeWithConstructors(in, &c.ChainConfig, network.DefaultConstructors(cothority.Suite))
 	if err != nil {
 		return nil, err
@@ -156,6 +190,9 @@ func (c *contractConfig) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []
 	interval, _ := binary.Varint(intervalBuf)
 	bsBuf := inst.Spawn.Args.Search("max_block_size")
 	maxsz, _ := binary.Varint(bsBuf)
+	// The replay protection is missing in older genesis transactions.
+	rp, _ := binary.Varint(inst.Spawn.Args.Search("replay_protection"))
+	maxExpiry, _ := binary.Uvarint(inst.Spawn.Args.Search("nonce_max_expiry"))
 
 	rosterBuf := inst.Spawn.Args.Search("roster")
 	roster := onet.Roster{}
@@ -168,6 +205,8 @@ func (c *contractConfig) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []
 	c.BlockInterval = time.Duration(interval)
 	c.Roster = roster
 	c.MaxBlockSize = int(maxsz)
+	c.ReplayProtection = ReplayProtection(rp)
+	c.NonceMaxExpiry = maxExpiry
 	if err = c.sanityCheck(nil); err != nil {
 		return
 	}
@@ -260,6 +299,24 @@ func (c *contractConfig) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 
 		sc, err = updateRosterScs(rst, darcID, req.Roster)
 		return
+	case CmdConfigUpgradeContract:
+		var config *ChainConfig
+		config, err = loadConfigFromTrie(rst)
+		if err != nil {
+			return
+		}
+		if err = c.s.addContractUpgrade(rst, config, inst.Invoke.Args); err != nil {
+			return
+		}
+		var configBuf []byte
+		configBuf, err = protobuf.Encode(config)
+		if err != nil {
+			return
+		}
+		sc = []StateChange{
+			NewStateChange(Update, NewInstanceID(nil), ContractConfigID, configBuf, darcID),
+		}
+		return
 	default:
 		err = errors.New("invalid invoke command: " + inst.Invoke.Command)
 		return
@@ -317,7 +374,7 @@ func (c *contractDarc) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []Co
 	// If we got here this is a spawn:XXX in order to spawn
 	// a new instance of contract XXX, so do that.
 
-	cfact, found := c.s.contracts[inst.Spawn.ContractID]
+	cfact, found := c.s.getContractFn(rst, inst.Spawn.ContractID)
 	if !found {
 		return nil, nil, errors.New("couldn't find this contract type: " + inst.Spawn.ContractID)
 	}
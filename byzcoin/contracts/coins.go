@@ -32,6 +32,12 @@ var CoinName = iid("byzCoin")
 //    parameter for the next instruction to interpret.
 //  - store puts the coins given to the instance back into the account.
 // You can only delete a contractCoin instance if the account is empty.
+//
+// The "type" of a coin instance cannot be the instance ID of a token of
+// ContractToken, else minting would create tokens outside of the supply of
+// the token. For the same reason, coins named after a token cannot be fetched
+// from a coin instance, in case the instance has been spawned before the
+// token.
 
 func contractCoinFromBytes(in []byte) (byzcoin.Contract, error) {
 	c := &contractCoin{}
@@ -64,6 +70,9 @@ func (c *contractCoin) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 			return nil, nil, errors.New("type needs to be an InstanceID")
 		}
 		c.Name = byzcoin.NewInstanceID(t)
+		if isToken(rst, c.Name) {
+			return nil, nil, errors.New("type cannot be a token")
+		}
 	} else {
 		c.Name = CoinName
 	}
@@ -145,6 +154,9 @@ func (c *contractCoin) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instru
 	case "fetch":
 		// fetch removes coins from the account and passes it on to the next
 		// instruction.
+		if isToken(rst, c.Name) {
+			return nil, nil, errors.New("cannot fetch coins named after a token")
+		}
 		err = c.SafeSub(coinsArg)
 		if err != nil {
 			return
@@ -242,6 +242,7 @@ type cvTest struct {
 	contractIDs map[string]string
 	darcIDs     map[string]darc.ID
 	index       int
+	timestamp   int64
 }
 
 var gdarc *darc.Darc
@@ -253,6 +254,7 @@ func newCT(rStr ...string) *cvTest {
 		make(map[string]string),
 		make(map[string]darc.ID),
 		0,
+		0,
 	}
 	gsigner = darc.NewSignerEd25519(nil, nil)
 	rules := darc.InitRules([]darc.Identity{gsigner.Identity()},
@@ -291,6 +293,10 @@ func (ct cvTest) GetIndex() int {
 	return ct.index
 }
 
+func (ct cvTest) GetTimestamp() int64 {
+	return ct.timestamp
+}
+
 func (ct cvTest) setSignatureCounter(id string, v uint64) {
 	key := sha256.Sum256([]byte("signercounter_" + id))
 	verBuf := make([]byte, 8)
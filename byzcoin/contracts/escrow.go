@@ -0,0 +1,267 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// ContractEscrowID denotes a contract that locks coins until they are
+// released to a beneficiary or refunded.
+var ContractEscrowID = "escrow"
+
+// The escrow contract locks the coins given as input to the spawn
+// instruction, typically the output of a "fetch" on a coin instance. It is
+// spawned from a darc with the following arguments:
+//  - "beneficiary" is the coin instance that gets the coins on release
+//  - "refund" is the coin instance that gets the coins back on refund
+//  - "hash" is an optional sha256 hash. If it is given, the coins can only
+//    be released with its preimage.
+//  - "unlock" is an optional block index, as a 64-bit uint in LittleEndian,
+//    before which the coins cannot be released
+//  - "deadline" is an optional block index, as a 64-bit uint in
+//    LittleEndian, from which the coins cannot be released anymore, but can
+//    be refunded
+// The following methods are available:
+//  - release sends the coins to the beneficiary. If the escrow has a hash,
+//    the argument "preimage" must be given, and it is stored in the escrow,
+//    so that the other party of an atomic swap can read it.
+//  - refund sends the coins back to the refund account once the deadline
+//    is reached.
+// Who can release and refund is given by the "invoke:release" and
+// "invoke:refund" rules of the darc of the escrow, e.g. a threshold of
+// signers. An escrow can only be deleted once it is released or refunded.
+//
+// Two escrows on different coin types with the same hash allow for an atomic
+// swap: the party that knows the preimage releases the escrow of the other
+// party, which reveals the preimage, so that the other party can release the
+// first escrow. The escrow of the party knowing the preimage must have a
+// later deadline.
+
+// EscrowState is the state of an escrow.
+type EscrowState int
+
+const (
+	// EscrowLocked means the coins are in the escrow.
+	EscrowLocked EscrowState = iota
+	// EscrowReleased means the coins have been sent to the beneficiary.
+	EscrowReleased
+	// EscrowRefunded means the coins have been sent back.
+	EscrowRefunded
+)
+
+// Escrow is the data of an escrow instance.
+type Escrow struct {
+	State EscrowState
+	// Coin holds the locked coins.
+	Coin        byzcoin.Coin
+	Beneficiary byzcoin.InstanceID
+	Refund      byzcoin.InstanceID
+	// Hash is the sha256 hash of the preimage, or empty.
+	Hash []byte
+	// Preimage is set when the escrow is released with a hash.
+	Preimage []byte
+	// Unlock is the first block where the coins can be released, 0 if
+	// there is no time-lock.
+	Unlock uint64
+	// Deadline is the first block where the coins can be refunded, 0 if
+	// the coins cannot be refunded.
+	Deadline uint64
+}
+
+type contractEscrow struct {
+	byzcoin.BasicContract
+	Escrow
+}
+
+func contractEscrowFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractEscrow{}
+	err := protobuf.Decode(in, &c.Escrow)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractEscrow) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	// Lock all the input coins, which must be of the same type.
+	if len(coins) == 0 {
+		return nil, nil, errors.New("no coins to lock")
+	}
+	c.Coin = byzcoin.Coin{Name: coins[0].Name}
+	for _, co := range coins {
+		if !co.Name.Equal(c.Coin.Name) {
+			return nil, nil, errors.New("can only lock one type of coins")
+		}
+		if err = c.Coin.SafeAdd(co.Value); err != nil {
+			return
+		}
+	}
+
+	args := inst.Spawn.Args
+	c.Beneficiary = byzcoin.NewInstanceID(args.Search("beneficiary"))
+	c.Refund = byzcoin.NewInstanceID(args.Search("refund"))
+	for _, id := range []byzcoin.InstanceID{c.Beneficiary, c.Refund} {
+		if _, _, err = loadCoinAccount(rst, id, c.Coin.Name); err != nil {
+			return
+		}
+	}
+	if h := args.Search("hash"); h != nil {
+		if len(h) != sha256.Size {
+			return nil, nil, errors.New("hash must be a sha256 hash")
+		}
+		c.Hash = h
+	}
+	if buf := args.Search("unlock"); buf != nil {
+		if c.Unlock, err = uint64Arg(buf, "unlock"); err != nil {
+			return
+		}
+	}
+	if buf := args.Search("deadline"); buf != nil {
+		if c.Deadline, err = uint64Arg(buf, "deadline"); err != nil {
+			return
+		}
+		if c.Deadline <= c.Unlock {
+			return nil, nil, errors.New("deadline must be after unlock")
+		}
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Escrow)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode escrow: " + err.Error())
+	}
+	cout = []byzcoin.Coin{}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractEscrowID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractEscrow) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.State != EscrowLocked {
+		return nil, nil, errors.New("escrow is not locked anymore")
+	}
+	// The instruction is executed in the block after the last one of the
+	// trie.
+	current := uint64(rst.GetIndex() + 1)
+
+	var target byzcoin.InstanceID
+	switch inst.Invoke.Command {
+	case "release":
+		if current < c.Unlock {
+			return nil, nil, errors.New("escrow is still time-locked")
+		}
+		if c.Deadline > 0 && current >= c.Deadline {
+			return nil, nil, errors.New("deadline has passed")
+		}
+		if len(c.Hash) > 0 {
+			preimage := inst.Invoke.Args.Search("preimage")
+			h := sha256.Sum256(preimage)
+			if !bytes.Equal(h[:], c.Hash) {
+				return nil, nil, errors.New("wrong preimage")
+			}
+			c.Preimage = preimage
+		}
+		c.State = EscrowReleased
+		target = c.Beneficiary
+	case "refund":
+		if c.Deadline == 0 {
+			return nil, nil, errors.New("escrow has no deadline")
+		}
+		if current < c.Deadline {
+			return nil, nil, errors.New("deadline not reached")
+		}
+		c.State = EscrowRefunded
+		target = c.Refund
+	default:
+		return nil, nil, errors.New("escrow contract can only release and refund")
+	}
+
+	account, accountDarc, err := loadCoinAccount(rst, target, c.Coin.Name)
+	if err != nil {
+		return
+	}
+	if err = account.SafeAdd(c.Coin.Value); err != nil {
+		return
+	}
+	log.Lvlf2("%s of %d coins to %x", inst.Invoke.Command, c.Coin.Value, target.Slice())
+	c.Coin.Value = 0
+
+	var accountBuf, buf []byte
+	accountBuf, err = protobuf.Encode(&account)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode coin account: " + err.Error())
+	}
+	buf, err = protobuf.Encode(&c.Escrow)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode escrow: " + err.Error())
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, target, ContractCoinID, accountBuf, accountDarc),
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractEscrowID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractEscrow) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.State == EscrowLocked {
+		err = errors.New("cannot delete an escrow that still holds coins")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractEscrowID, nil, darcID),
+	}
+	return
+}
+
+// loadCoinAccount returns the coin instance, after checking it holds coins
+// of the given type.
+func loadCoinAccount(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID, name byzcoin.InstanceID) (account byzcoin.Coin, darcID darc.ID, err error) {
+	var v []byte
+	var cid string
+	v, _, cid, darcID, err = rst.GetValues(id.Slice())
+	if err == nil && cid != ContractCoinID {
+		err = errors.New("account is not a coin instance")
+	}
+	if err != nil {
+		return
+	}
+	if err = protobuf.Decode(v, &account); err != nil {
+		err = errors.New("couldn't unmarshal coin account: " + err.Error())
+		return
+	}
+	if !account.Name.Equal(name) {
+		err = errors.New("account holds another type of coins")
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscrow_HashLock(t *testing.T) {
+	ct := newCT()
+	alice, bob := newCoinAccounts(t, ct, CoinName)
+	preimage := []byte("secret")
+	hash := sha256.Sum256(preimage)
+
+	escrowID := spawnEscrow(t, ct, []byzcoin.Coin{{Name: CoinName, Value: 10}}, byzcoin.Arguments{
+		{Name: "beneficiary", Value: bob.Slice()},
+		{Name: "refund", Value: alice.Slice()},
+		{Name: "hash", Value: hash[:]},
+	})
+
+	_, err := invokeEscrow(ct, escrowID, "release", []byte("wrong"))
+	require.Error(t, err)
+	// There is no deadline, so no refund.
+	_, err = invokeEscrow(ct, escrowID, "refund", nil)
+	require.Error(t, err)
+
+	sc, err := invokeEscrow(ct, escrowID, "release", preimage)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(10), getCoin(t, ct, bob).Value)
+
+	// The preimage can be read by the other party.
+	var escrow Escrow
+	require.NoError(t, protobuf.Decode(ct.values[string(escrowID.Slice())], &escrow))
+	require.Equal(t, EscrowReleased, escrow.State)
+	require.Equal(t, preimage, escrow.Preimage)
+	require.Equal(t, uint64(0), escrow.Coin.Value)
+
+	_, err = invokeEscrow(ct, escrowID, "release", preimage)
+	require.Error(t, err)
+}
+
+func TestEscrow_TimeLock(t *testing.T) {
+	ct := newCT()
+	alice, bob := newCoinAccounts(t, ct, CoinName)
+
+	// Coins of another type cannot be locked for these accounts.
+	c, _ := contractEscrowFromBytes(nil)
+	_, _, err := c.Spawn(ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractEscrowID,
+			Args: byzcoin.Arguments{
+				{Name: "beneficiary", Value: bob.Slice()},
+				{Name: "refund", Value: alice.Slice()},
+			},
+		},
+	}, []byzcoin.Coin{{Name: byzcoin.NewInstanceID([]byte("other")), Value: 10}})
+	require.Error(t, err)
+
+	ct.index = 0
+	escrowID := spawnEscrow(t, ct, []byzcoin.Coin{{Name: CoinName, Value: 10}}, byzcoin.Arguments{
+		{Name: "beneficiary", Value: bob.Slice()},
+		{Name: "refund", Value: alice.Slice()},
+		{Name: "unlock", Value: uint64Buf(20)},
+		{Name: "deadline", Value: uint64Buf(30)},
+	})
+
+	ct.index = 10
+	_, err = invokeEscrow(ct, escrowID, "release", nil)
+	require.Error(t, err)
+	_, err = invokeEscrow(ct, escrowID, "refund", nil)
+	require.Error(t, err)
+
+	// After the deadline, only a refund is possible.
+	ct.index = 29
+	_, err = invokeEscrow(ct, escrowID, "release", nil)
+	require.Error(t, err)
+	sc, err := invokeEscrow(ct, escrowID, "refund", nil)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(10), getCoin(t, ct, alice).Value)
+	require.Equal(t, uint64(0), getCoin(t, ct, bob).Value)
+}
+
+func TestEscrow_AtomicSwap(t *testing.T) {
+	ct := newCT()
+	otherCoin := byzcoin.NewInstanceID([]byte("otherCoin"))
+	alice1, bob1 := newCoinAccounts(t, ct, CoinName)
+	alice2, bob2 := newCoinAccounts(t, ct, otherCoin)
+	preimage := []byte("alice's secret")
+	hash := sha256.Sum256(preimage)
+
+	// Alice locks her coins for Bob, Bob locks his other coins for Alice
+	// with the same hash and an earlier deadline.
+	ct.index = 0
+	escrowAlice := spawnEscrow(t, ct, []byzcoin.Coin{{Name: CoinName, Value: 5}}, byzcoin.Arguments{
+		{Name: "beneficiary", Value: bob1.Slice()},
+		{Name: "refund", Value: alice1.Slice()},
+		{Name: "hash", Value: hash[:]},
+		{Name: "deadline", Value: uint64Buf(100)},
+	})
+	escrowBob := spawnEscrow(t, ct, []byzcoin.Coin{{Name: otherCoin, Value: 7}}, byzcoin.Arguments{
+		{Name: "beneficiary", Value: alice2.Slice()},
+		{Name: "refund", Value: bob2.Slice()},
+		{Name: "hash", Value: hash[:]},
+		{Name: "deadline", Value: uint64Buf(50)},
+	})
+
+	// Alice releases Bob's escrow, revealing the preimage.
+	sc, err := invokeEscrow(ct, escrowBob, "release", preimage)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	var escrow Escrow
+	require.NoError(t, protobuf.Decode(ct.values[string(escrowBob.Slice())], &escrow))
+
+	// Bob uses it to release Alice's escrow.
+	sc, err = invokeEscrow(ct, escrowAlice, "release", escrow.Preimage)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+
+	require.Equal(t, uint64(7), getCoin(t, ct, alice2).Value)
+	require.Equal(t, uint64(5), getCoin(t, ct, bob1).Value)
+}
+
+// newCoinAccounts creates two empty coin accounts of the given type.
+func newCoinAccounts(t *testing.T, ct *cvTest, name byzcoin.InstanceID) (byzcoin.InstanceID, byzcoin.InstanceID) {
+	var ids []byzcoin.InstanceID
+	for _, n := range []string{"alice", "bob"} {
+		id := byzcoin.NewInstanceID([]byte(n + string(name.Slice())))
+		buf, err := protobuf.Encode(&byzcoin.Coin{Name: name})
+		require.NoError(t, err)
+		ct.Store(id, buf, ContractCoinID, gdarc.GetBaseID())
+		ids = append(ids, id)
+	}
+	return ids[0], ids[1]
+}
+
+func spawnEscrow(t *testing.T, ct *cvTest, coins []byzcoin.Coin, args byzcoin.Arguments) byzcoin.InstanceID {
+	c, _ := contractEscrowFromBytes(nil)
+	sc, cout, err := c.Spawn(ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractEscrowID,
+			Args:       args,
+		},
+	}, coins)
+	require.NoError(t, err)
+	require.Empty(t, cout)
+	require.Equal(t, 1, len(sc))
+	storeSC(ct, sc)
+	return byzcoin.NewInstanceID(sc[0].InstanceID)
+}
+
+func invokeEscrow(ct *cvTest, id byzcoin.InstanceID, cmd string, preimage []byte) ([]byzcoin.StateChange, error) {
+	c, err := contractEscrowFromBytes(ct.values[string(id.Slice())])
+	if err != nil {
+		return nil, err
+	}
+	sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			Command: cmd,
+			Args:    byzcoin.Arguments{{Name: "preimage", Value: preimage}},
+		},
+	}, nil)
+	return sc, err
+}
+
+func getCoin(t *testing.T, ct *cvTest, id byzcoin.InstanceID) byzcoin.Coin {
+	var coin byzcoin.Coin
+	require.NoError(t, protobuf.Decode(ct.values[string(id.Slice())], &coin))
+	return coin
+}
@@ -0,0 +1,343 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// ContractKVID denotes a contract that stores named fields.
+var ContractKVID = "kv"
+
+// ContractKVFieldID is the contract ID of the instances holding the fields
+// of a kv instance. There is no contract registered for it, so the fields
+// can only be changed through their kv instance.
+var ContractKVFieldID = "kvField"
+
+// The kv contract stores a map of named fields. Every field is stored in its
+// own instance, with the ID given by KVFieldID, so that a single field can be
+// read with a proof that doesn't contain the other fields. The kv instance
+// itself holds the optional schema and the names of the fields.
+//
+// It is spawned from a darc. The argument "schema" is an optional
+// protobuf-encoded KVSchema, which cannot be changed afterwards. All other
+// arguments are the initial fields.
+// The following methods are available:
+//  - set sets every argument as a field
+//  - delete removes the fields named by the arguments, the values are
+//    ignored
+//  - batch takes a protobuf-encoded KVBatch in the argument "batch", to set
+//    and delete fields in one instruction
+// Deleting a kv instance deletes all its fields.
+
+// The types of the fields in a KVSchema.
+const (
+	// KVTypeBytes accepts any value.
+	KVTypeBytes = "bytes"
+	// KVTypeString accepts utf-8 strings.
+	KVTypeString = "string"
+	// KVTypeUint64 accepts 64-bit uints in LittleEndian.
+	KVTypeUint64 = "uint64"
+	// KVTypeBool accepts a single byte of 0 or 1.
+	KVTypeBool = "bool"
+)
+
+// KVSchema restricts the fields of a kv instance.
+type KVSchema struct {
+	Fields []KVFieldSchema
+	// Strict rejects fields that are not in the schema.
+	Strict bool
+}
+
+// KVFieldSchema describes one field of a KVSchema.
+type KVFieldSchema struct {
+	Name string
+	// Type is one of the KVType constants, or empty for KVTypeBytes.
+	Type string
+	// Required fields must be given at spawn time and cannot be deleted.
+	Required bool
+	// MaxSize is the maximum length of the value, 0 for no limit.
+	MaxSize uint64
+}
+
+// KVStore is the data of a kv instance.
+type KVStore struct {
+	Schema *KVSchema `protobuf:"opt"`
+	// Fields holds the sorted names of the fields that are set.
+	Fields []string
+}
+
+// KVField is a named value.
+type KVField struct {
+	Name  string
+	Value []byte
+}
+
+// KVBatch holds the changes of a batch command.
+type KVBatch struct {
+	Set    []KVField
+	Delete []string
+}
+
+// KVFieldID returns the instance ID where the field of the kv instance is
+// stored.
+func KVFieldID(id byzcoin.InstanceID, name string) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write(id.Slice())
+	h.Write([]byte(name))
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// GetKVField returns the value of a field of a kv instance, together with
+// the proof of this value, after verifying the proof.
+func GetKVField(cl *byzcoin.Client, id byzcoin.InstanceID, name string) ([]byte, *byzcoin.Proof, error) {
+	key := KVFieldID(id, name).Slice()
+	pr, err := cl.GetProof(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = pr.Proof.Verify(cl.ID); err != nil {
+		return nil, nil, err
+	}
+	if !pr.Proof.InclusionProof.Match(key) {
+		return nil, nil, fmt.Errorf("field %s is not set", name)
+	}
+	v, cid, _, err := pr.Proof.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cid != ContractKVFieldID {
+		return nil, nil, errors.New("instance is not a kv field")
+	}
+	return v, &pr.Proof, nil
+}
+
+// field returns the schema of the given field, or nil.
+func (s *KVSchema) field(name string) *KVFieldSchema {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (s *KVSchema) verify() error {
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return errors.New("schema has a field without name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("field %s is twice in the schema", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case "", KVTypeBytes, KVTypeString, KVTypeUint64, KVTypeBool:
+		default:
+			return fmt.Errorf("unknown type %s for field %s", f.Type, f.Name)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the value is not valid for the field.
+func (s *KVSchema) check(name string, value []byte) error {
+	f := s.field(name)
+	if f == nil {
+		if s.Strict {
+			return fmt.Errorf("field %s is not in the schema", name)
+		}
+		return nil
+	}
+	if f.MaxSize > 0 && uint64(len(value)) > f.MaxSize {
+		return fmt.Errorf("field %s is longer than %d bytes", name, f.MaxSize)
+	}
+	switch f.Type {
+	case KVTypeString:
+		if !utf8.Valid(value) {
+			return fmt.Errorf("field %s is not a valid string", name)
+		}
+	case KVTypeUint64:
+		if len(value) != 8 {
+			return fmt.Errorf("field %s is not a 64-bit uint", name)
+		}
+	case KVTypeBool:
+		if len(value) != 1 || value[0] > 1 {
+			return fmt.Errorf("field %s is not a bool", name)
+		}
+	}
+	return nil
+}
+
+type contractKV struct {
+	byzcoin.BasicContract
+	KVStore
+}
+
+func contractKVFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractKV{}
+	err := protobuf.Decode(in, &c.KVStore)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractKV) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	var set []KVField
+	for _, arg := range inst.Spawn.Args {
+		if arg.Name == "schema" {
+			c.Schema = &KVSchema{}
+			if err = protobuf.Decode(arg.Value, c.Schema); err != nil {
+				return nil, nil, errors.New("couldn't decode schema: " + err.Error())
+			}
+			if err = c.Schema.verify(); err != nil {
+				return
+			}
+			continue
+		}
+		set = append(set, KVField{Name: arg.Name, Value: arg.Value})
+	}
+
+	sc, err = c.apply(inst.DeriveID(""), byzcoin.Create, set, nil, darcID)
+	return
+}
+
+func (c *contractKV) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	var batch KVBatch
+	switch inst.Invoke.Command {
+	case "set":
+		for _, arg := range inst.Invoke.Args {
+			batch.Set = append(batch.Set, KVField{Name: arg.Name, Value: arg.Value})
+		}
+	case "delete":
+		for _, arg := range inst.Invoke.Args {
+			batch.Delete = append(batch.Delete, arg.Name)
+		}
+	case "batch":
+		if err = protobuf.Decode(inst.Invoke.Args.Search("batch"), &batch); err != nil {
+			return nil, nil, errors.New("couldn't decode batch: " + err.Error())
+		}
+	default:
+		return nil, nil, errors.New("kv contract can only set, delete and batch")
+	}
+	if len(batch.Set) == 0 && len(batch.Delete) == 0 {
+		return nil, nil, errors.New("nothing to change")
+	}
+
+	sc, err = c.apply(inst.InstanceID, byzcoin.Update, batch.Set, batch.Delete, darcID)
+	return
+}
+
+func (c *contractKV) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractKVID, nil, darcID),
+	}
+	for _, name := range c.Fields {
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Remove, KVFieldID(inst.InstanceID, name),
+			ContractKVFieldID, nil, darcID))
+	}
+	return
+}
+
+// apply returns the state changes that set and delete the given fields of
+// the instance id. The first state change is the kv instance itself, with
+// the given action.
+func (c *contractKV) apply(id byzcoin.InstanceID, action byzcoin.StateAction, set []KVField, del []string, darcID darc.ID) (sc []byzcoin.StateChange, err error) {
+	fields := make(map[string]bool)
+	for _, name := range c.Fields {
+		fields[name] = true
+	}
+	changed := make(map[string]bool)
+
+	var fieldSC []byzcoin.StateChange
+	for _, f := range set {
+		if f.Name == "" {
+			return nil, errors.New("field without name")
+		}
+		if changed[f.Name] {
+			return nil, fmt.Errorf("field %s is changed twice", f.Name)
+		}
+		changed[f.Name] = true
+		if c.Schema != nil {
+			if err = c.Schema.check(f.Name, f.Value); err != nil {
+				return
+			}
+		}
+		fieldAction := byzcoin.Create
+		if fields[f.Name] {
+			fieldAction = byzcoin.Update
+		}
+		fields[f.Name] = true
+		fieldSC = append(fieldSC, byzcoin.NewStateChange(fieldAction, KVFieldID(id, f.Name),
+			ContractKVFieldID, f.Value, darcID))
+	}
+	for _, name := range del {
+		if changed[name] {
+			return nil, fmt.Errorf("field %s is changed twice", name)
+		}
+		changed[name] = true
+		if !fields[name] {
+			return nil, fmt.Errorf("field %s is not set", name)
+		}
+		delete(fields, name)
+		fieldSC = append(fieldSC, byzcoin.NewStateChange(byzcoin.Remove, KVFieldID(id, name),
+			ContractKVFieldID, nil, darcID))
+	}
+	if c.Schema != nil {
+		for _, f := range c.Schema.Fields {
+			if f.Required && !fields[f.Name] {
+				return nil, fmt.Errorf("field %s is required", f.Name)
+			}
+		}
+	}
+
+	c.Fields = make([]string, 0, len(fields))
+	for name := range fields {
+		c.Fields = append(c.Fields, name)
+	}
+	sort.Strings(c.Fields)
+	log.Lvlf2("kv %x: %d fields set, %d deleted", id.Slice(), len(set), len(del))
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.KVStore)
+	if err != nil {
+		return nil, errors.New("couldn't encode kv: " + err.Error())
+	}
+	sc = append([]byzcoin.StateChange{
+		byzcoin.NewStateChange(action, id, ContractKVID, buf, darcID),
+	}, fieldSC...)
+	return
+}
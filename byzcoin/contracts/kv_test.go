@@ -0,0 +1,187 @@
+package contracts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKV_Schema(t *testing.T) {
+	ct := newCT()
+	schema, err := protobuf.Encode(&KVSchema{
+		Fields: []KVFieldSchema{
+			{Name: "name", Type: KVTypeString, Required: true, MaxSize: 8},
+			{Name: "age", Type: KVTypeUint64},
+			{Name: "admin", Type: KVTypeBool},
+		},
+		Strict: true,
+	})
+	require.NoError(t, err)
+
+	spawn := func(args byzcoin.Arguments) ([]byzcoin.StateChange, error) {
+		c, _ := contractKVFromBytes(nil)
+		sc, _, err := c.Spawn(ct, byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractKVID,
+				Args:       append(byzcoin.Arguments{{Name: "schema", Value: schema}}, args...),
+			},
+		}, nil)
+		return sc, err
+	}
+
+	// Missing required field.
+	_, err = spawn(byzcoin.Arguments{{Name: "age", Value: uint64Buf(20)}})
+	require.Error(t, err)
+	// Field not in the schema.
+	_, err = spawn(byzcoin.Arguments{{Name: "name", Value: []byte("alice")}, {Name: "other"}})
+	require.Error(t, err)
+	// Too long.
+	_, err = spawn(byzcoin.Arguments{{Name: "name", Value: []byte("alice and bob")}})
+	require.Error(t, err)
+	// Wrong types.
+	_, err = spawn(byzcoin.Arguments{{Name: "name", Value: []byte("alice")}, {Name: "age", Value: []byte{1}}})
+	require.Error(t, err)
+	_, err = spawn(byzcoin.Arguments{{Name: "name", Value: []byte("alice")}, {Name: "admin", Value: []byte{2}}})
+	require.Error(t, err)
+
+	sc, err := spawn(byzcoin.Arguments{{Name: "name", Value: []byte("alice")}, {Name: "age", Value: uint64Buf(20)}})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(sc))
+	storeSC(ct, sc)
+	id := byzcoin.NewInstanceID(sc[0].InstanceID)
+	require.Equal(t, []byte("alice"), ct.values[string(KVFieldID(id, "name").Slice())])
+
+	// The required field cannot be deleted.
+	_, err = invokeKV(ct, id, "delete", byzcoin.Arguments{{Name: "name"}})
+	require.Error(t, err)
+	_, err = invokeKV(ct, id, "set", byzcoin.Arguments{{Name: "age", Value: []byte("old")}})
+	require.Error(t, err)
+}
+
+func TestKV_SetDelete(t *testing.T) {
+	ct := newCT()
+	c, _ := contractKVFromBytes(nil)
+	sc, _, err := c.Spawn(ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractKVID,
+			Args:       byzcoin.Arguments{{Name: "a", Value: []byte("1")}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	id := byzcoin.NewInstanceID(sc[0].InstanceID)
+
+	sc, err = invokeKV(ct, id, "set", byzcoin.Arguments{
+		{Name: "a", Value: []byte("2")},
+		{Name: "b", Value: []byte("3")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(sc))
+	require.Equal(t, byzcoin.Update, sc[1].StateAction)
+	require.Equal(t, byzcoin.Create, sc[2].StateAction)
+	storeSC(ct, sc)
+
+	_, err = invokeKV(ct, id, "delete", byzcoin.Arguments{{Name: "c"}})
+	require.Error(t, err)
+	sc, err = invokeKV(ct, id, "delete", byzcoin.Arguments{{Name: "a"}})
+	require.NoError(t, err)
+	require.Equal(t, byzcoin.Remove, sc[1].StateAction)
+	storeSC(ct, sc)
+
+	// A field cannot be set and deleted in the same batch.
+	batch, err := protobuf.Encode(&KVBatch{
+		Set:    []KVField{{Name: "b", Value: []byte("4")}},
+		Delete: []string{"b"},
+	})
+	require.NoError(t, err)
+	_, err = invokeKV(ct, id, "batch", byzcoin.Arguments{{Name: "batch", Value: batch}})
+	require.Error(t, err)
+
+	batch, err = protobuf.Encode(&KVBatch{
+		Set:    []KVField{{Name: "c", Value: []byte("5")}},
+		Delete: []string{"b"},
+	})
+	require.NoError(t, err)
+	sc, err = invokeKV(ct, id, "batch", byzcoin.Arguments{{Name: "batch", Value: batch}})
+	require.NoError(t, err)
+	storeSC(ct, sc)
+
+	var kv KVStore
+	require.NoError(t, protobuf.Decode(ct.values[string(id.Slice())], &kv))
+	require.Equal(t, []string{"c"}, kv.Fields)
+
+	// Deleting the instance removes its fields.
+	c, err = contractKVFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	sc, _, err = c.Delete(ct, byzcoin.Instruction{InstanceID: id, Delete: &byzcoin.Delete{}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sc))
+	require.Equal(t, KVFieldID(id, "c").Slice(), sc[1].InstanceID)
+}
+
+func TestKV_GetField(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:kv"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractKVID,
+				Args: byzcoin.Arguments{
+					{Name: "name", Value: []byte("alice")},
+					{Name: "secret", Value: []byte("not in the proof")},
+				},
+			},
+			SignerCounter: []uint64{1},
+		}},
+	}
+	require.Nil(t, ctx.SignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Nil(t, err)
+
+	id := ctx.Instructions[0].DeriveID("")
+	v, _, err := GetKVField(cl, id, "name")
+	require.Nil(t, err)
+	require.Equal(t, []byte("alice"), v)
+
+	_, _, err = GetKVField(cl, id, "unknown")
+	require.NotNil(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
+
+func invokeKV(ct *cvTest, id byzcoin.InstanceID, cmd string, args byzcoin.Arguments) ([]byzcoin.StateChange, error) {
+	c, err := contractKVFromBytes(ct.values[string(id.Slice())])
+	if err != nil {
+		return nil, err
+	}
+	sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			Command: cmd,
+			Args:    args,
+		},
+	}, nil)
+	return sc, err
+}
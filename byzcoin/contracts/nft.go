@@ -0,0 +1,274 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// ContractNFTCollectionID denotes a contract that groups non-fungible assets.
+var ContractNFTCollectionID = "nftCollection"
+
+// ContractNFTID denotes a contract that holds one non-fungible asset.
+var ContractNFTID = "nft"
+
+// contractCalypsoWriteID is the ID of the calypso write contract. It is
+// copied here so that the contracts don't depend on the calypso service.
+const contractCalypsoWriteID = "calypsoWrite"
+
+// The nft contracts implement unique assets. A collection is spawned from a
+// darc with the arguments "name" and "symbol". The assets are then spawned
+// on the collection instance with the following arguments:
+//  - "owner" is the identity of the owner of the asset, e.g.
+//    ed25519:a35020c70b8d735...0357, it is mandatory
+//  - "metadata" can hold any data describing the asset. It cannot be
+//    changed once the asset exists.
+//  - "write" is an optional instance ID of a calypso write instance that
+//    holds the encrypted content of the asset
+//  - "darc" is the ID of the darc that governs the asset. If it is missing,
+//    the darc of the collection is used.
+// The instance ID of an asset is given by NFTAssetID, so all the assets of a
+// collection can be found from its number of assets.
+//
+// The only method of an asset is transfer, which sets the owner to the
+// argument "owner" and puts the asset under the darc of the mandatory
+// argument "darc", so that only the new owner can transfer it further. As all
+// changes are state changes of the asset instance, the history of the
+// owners can be read with GetAllInstanceVersion. Deleting an asset destroys
+// it.
+
+// NFTCollection is the data of a collection instance.
+type NFTCollection struct {
+	Name   string
+	Symbol string
+	// Count is the number of assets spawned in the collection.
+	Count uint64
+}
+
+// NFTAsset is the data of an asset instance.
+type NFTAsset struct {
+	// Collection is the instance ID of the collection of the asset.
+	Collection byzcoin.InstanceID
+	// Index is the position of the asset in the collection.
+	Index uint64
+	// Owner is the identity string of the owner.
+	Owner    string
+	Metadata []byte
+	// Write is the instance ID of a calypso write instance, or empty.
+	Write []byte
+}
+
+// NFTAssetID returns the instance ID of the asset at the given index in the
+// collection.
+func NFTAssetID(collection byzcoin.InstanceID, index uint64) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write(collection.Slice())
+	idx := make([]byte, 8)
+	binary.LittleEndian.PutUint64(idx, index)
+	h.Write(idx)
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+type contractNFTCollection struct {
+	byzcoin.BasicContract
+	NFTCollection
+}
+
+func contractNFTCollectionFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractNFTCollection{}
+	err := protobuf.Decode(in, &c.NFTCollection)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractNFTCollection) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Spawn.ContractID {
+	case ContractNFTCollectionID:
+		// Spawning a new collection from a darc.
+		c.NFTCollection = NFTCollection{
+			Name:   string(inst.Spawn.Args.Search("name")),
+			Symbol: string(inst.Spawn.Args.Search("symbol")),
+		}
+		var buf []byte
+		buf, err = protobuf.Encode(&c.NFTCollection)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode collection: " + err.Error())
+		}
+		sc = []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""),
+				ContractNFTCollectionID, buf, darcID),
+		}
+	case ContractNFTID:
+		// Spawning a new asset in this collection.
+		var asset NFTAsset
+		var assetDarc darc.ID
+		asset, assetDarc, err = c.newAsset(rst, inst, darcID)
+		if err != nil {
+			return
+		}
+		var assetBuf, buf []byte
+		assetBuf, err = protobuf.Encode(&asset)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode asset: " + err.Error())
+		}
+		c.Count++
+		buf, err = protobuf.Encode(&c.NFTCollection)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode collection: " + err.Error())
+		}
+		log.Lvlf2("minting asset %d of collection %x", asset.Index, inst.InstanceID.Slice())
+		sc = []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Create, NFTAssetID(inst.InstanceID, asset.Index),
+				ContractNFTID, assetBuf, assetDarc),
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractNFTCollectionID, buf, darcID),
+		}
+	default:
+		err = errors.New("can only spawn collections and assets")
+	}
+	return
+}
+
+func (c *contractNFTCollection) newAsset(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, darcID darc.ID) (asset NFTAsset, assetDarc darc.ID, err error) {
+	args := inst.Spawn.Args
+	asset = NFTAsset{
+		Collection: inst.InstanceID,
+		Index:      c.Count,
+		Metadata:   args.Search("metadata"),
+	}
+	asset.Owner, err = ownerArg(args)
+	if err != nil {
+		return
+	}
+	if w := args.Search("write"); w != nil {
+		if len(w) != len(byzcoin.InstanceID{}) {
+			err = errors.New("write needs to be an InstanceID")
+			return
+		}
+		var cid string
+		_, _, cid, _, err = rst.GetValues(w)
+		if err == nil && cid != contractCalypsoWriteID {
+			err = errors.New("write is not a calypso write instance")
+		}
+		if err != nil {
+			return
+		}
+		asset.Write = w
+	}
+	assetDarc, err = darcArg(rst, args, darcID)
+	return
+}
+
+type contractNFT struct {
+	byzcoin.BasicContract
+	NFTAsset
+}
+
+func contractNFTFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractNFT{}
+	err := protobuf.Decode(in, &c.NFTAsset)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractNFT) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "transfer":
+		c.Owner, err = ownerArg(inst.Invoke.Args)
+		if err != nil {
+			return
+		}
+		// The asset is only transferred if the darc of the previous
+		// owner stops governing it.
+		if inst.Invoke.Args.Search("darc") == nil {
+			return nil, nil, errors.New("argument \"darc\" is missing")
+		}
+		darcID, err = darcArg(rst, inst.Invoke.Args, nil)
+		if err != nil {
+			return
+		}
+		log.Lvlf2("transferring asset %x to %s", inst.InstanceID.Slice(), c.Owner)
+	default:
+		return nil, nil, errors.New("nft contract can only transfer")
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.NFTAsset)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode asset: " + err.Error())
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractNFTID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractNFT) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractNFTID, nil, darcID),
+	}
+	return
+}
+
+// ownerArg returns the identity string in the argument "owner".
+func ownerArg(args byzcoin.Arguments) (string, error) {
+	owner := string(args.Search("owner"))
+	if owner == "" {
+		return "", errors.New("argument \"owner\" is missing")
+	}
+	if !strings.Contains(owner, ":") {
+		return "", errors.New("owner must be an identity string")
+	}
+	return owner, nil
+}
+
+// darcArg returns the darc ID in the argument "darc", after checking that
+// this darc exists. If the argument is missing, def is returned.
+func darcArg(rst byzcoin.ReadOnlyStateTrie, args byzcoin.Arguments, def darc.ID) (darc.ID, error) {
+	id := args.Search("darc")
+	if id == nil {
+		return def, nil
+	}
+	_, _, cid, _, err := rst.GetValues(id)
+	if err == nil && cid != byzcoin.ContractDarcID {
+		err = errors.New("darc argument doesn't point to a darc")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return darc.ID(id), nil
+}
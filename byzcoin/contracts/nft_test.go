@@ -0,0 +1,126 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFT_Mint(t *testing.T) {
+	ct := newCT("spawn:nftCollection", "spawn:nft")
+
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractNFTCollectionID,
+			Args:       byzcoin.Arguments{{Name: "name", Value: []byte("art")}},
+		},
+	}
+	c, _ := contractNFTCollectionFromBytes(nil)
+	sc, _, err := c.Spawn(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	storeSC(ct, sc)
+	collID := byzcoin.NewInstanceID(sc[0].InstanceID)
+
+	mint := func(args byzcoin.Arguments) ([]byzcoin.StateChange, error) {
+		c, err := contractNFTCollectionFromBytes(ct.values[string(collID.Slice())])
+		require.NoError(t, err)
+		sc, _, err := c.Spawn(ct, byzcoin.Instruction{
+			InstanceID: collID,
+			Spawn:      &byzcoin.Spawn{ContractID: ContractNFTID, Args: args},
+		}, nil)
+		return sc, err
+	}
+
+	// The owner is mandatory.
+	_, err = mint(byzcoin.Arguments{{Name: "metadata", Value: []byte("first")}})
+	require.Error(t, err)
+	// The write instance must exist.
+	_, err = mint(byzcoin.Arguments{
+		{Name: "owner", Value: []byte("ed25519:aa")},
+		{Name: "write", Value: make([]byte, 32)},
+	})
+	require.Error(t, err)
+
+	for i := uint64(0); i < 2; i++ {
+		sc, err = mint(byzcoin.Arguments{
+			{Name: "owner", Value: []byte("ed25519:aa")},
+			{Name: "metadata", Value: []byte("asset")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(sc))
+		require.Equal(t, NFTAssetID(collID, i).Slice(), sc[0].InstanceID)
+		storeSC(ct, sc)
+	}
+
+	var coll NFTCollection
+	require.NoError(t, protobuf.Decode(ct.values[string(collID.Slice())], &coll))
+	require.Equal(t, NFTCollection{Name: "art", Count: 2}, coll)
+
+	var asset NFTAsset
+	require.NoError(t, protobuf.Decode(ct.values[string(NFTAssetID(collID, 1).Slice())], &asset))
+	require.Equal(t, uint64(1), asset.Index)
+	require.Equal(t, collID, asset.Collection)
+	require.Equal(t, []byte("asset"), asset.Metadata)
+}
+
+func TestNFT_Transfer(t *testing.T) {
+	ct := newCT("invoke:transfer")
+
+	assetID := NFTAssetID(byzcoin.NewInstanceID([]byte("collection")), 0)
+	buf, err := protobuf.Encode(&NFTAsset{Owner: "ed25519:aa", Metadata: []byte("asset")})
+	require.NoError(t, err)
+	ct.Store(assetID, buf, ContractNFTID, gdarc.GetBaseID())
+
+	// The darc of the new owner.
+	owner := darc.NewSignerEd25519(nil, nil)
+	rules := darc.InitRules([]darc.Identity{owner.Identity()}, []darc.Identity{owner.Identity()})
+	rules.AddRule("invoke:transfer", expression.Expr(owner.Identity().String()))
+	d := darc.NewDarc(rules, []byte("owner"))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+	ct.Store(byzcoin.NewInstanceID(d.GetBaseID()), dBuf, byzcoin.ContractDarcID, d.GetBaseID())
+
+	transfer := func(args byzcoin.Arguments) ([]byzcoin.StateChange, error) {
+		c, err := contractNFTFromBytes(ct.values[string(assetID.Slice())])
+		require.NoError(t, err)
+		sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+			InstanceID: assetID,
+			Invoke:     &byzcoin.Invoke{Command: "transfer", Args: args},
+		}, nil)
+		return sc, err
+	}
+
+	// The new darc is needed, the previous one would still govern the
+	// asset.
+	_, err = transfer(byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner.Identity().String())},
+	})
+	require.Error(t, err)
+
+	// The new darc must exist.
+	_, err = transfer(byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner.Identity().String())},
+		{Name: "darc", Value: []byte("unknown")},
+	})
+	require.Error(t, err)
+
+	sc, err := transfer(byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner.Identity().String())},
+		{Name: "darc", Value: d.GetBaseID()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	require.Equal(t, d.GetBaseID(), sc[0].DarcID)
+
+	var asset NFTAsset
+	require.NoError(t, protobuf.Decode(sc[0].Value, &asset))
+	require.Equal(t, owner.Identity().String(), asset.Owner)
+	// The metadata cannot change.
+	require.Equal(t, []byte("asset"), asset.Metadata)
+}
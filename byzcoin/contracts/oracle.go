@@ -0,0 +1,404 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ContractOracleID denotes a contract that aggregates the observations of a
+// set of oracles.
+var ContractOracleID = "oracle"
+
+// The oracle contract holds a data feed, like a price or a timestamp, that
+// is posted by a set of oracles. The oracles sign their observations for a
+// given round, and once the threshold of observations for a round is
+// reached, they are aggregated into the value of the feed. Other contracts
+// can read this value with GetOracleValue.
+//
+// It is spawned from a darc with the protobuf-encoded OracleConfig in the
+// argument "config". The darc decides who can send instructions, while the
+// signatures of the observations decide which oracles they come from.
+// The following methods are available:
+//  - post takes a protobuf-encoded OracleObservation in the argument
+//    "observation"
+//  - configure replaces the config with the one in the argument "config",
+//    which drops the pending observations
+// Deleting the instance removes the feed.
+
+// The aggregations of an OracleConfig.
+const (
+	// OracleAggregateEqual takes the value that has been observed by the
+	// threshold of oracles.
+	OracleAggregateEqual = "equal"
+	// OracleAggregateMedian takes the median of the observations, which
+	// must be 64-bit uints in LittleEndian, once the threshold of oracles
+	// posted them.
+	OracleAggregateMedian = "median"
+)
+
+// oracleMaxPending is the maximum number of pending observations of one
+// oracle, so that an oracle cannot fill the instance with future rounds.
+const oracleMaxPending = 16
+
+// OracleConfig defines the oracles of a feed.
+type OracleConfig struct {
+	Oracles   []darc.Identity
+	Threshold uint32
+	// Aggregation is one of the OracleAggregate constants.
+	Aggregation string
+}
+
+// OracleObservation is the value observed by an oracle for a round. The
+// signature is on OracleMessage.
+type OracleObservation struct {
+	Round     uint64
+	Value     []byte
+	Oracle    darc.Identity
+	Signature []byte
+}
+
+// OracleFeed is the data of an oracle instance.
+type OracleFeed struct {
+	Config OracleConfig
+	// Round is the round of Value, 0 if no value has been aggregated yet.
+	Round uint64
+	Value []byte
+	// Pending holds the observations of the rounds after Round.
+	Pending []OracleObservation
+}
+
+// OracleMessage returns the message an oracle signs for its observation of
+// a round of the instance id.
+func OracleMessage(id byzcoin.InstanceID, round uint64, value []byte) []byte {
+	h := sha256.New()
+	h.Write(id.Slice())
+	roundBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(roundBuf, round)
+	h.Write(roundBuf)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// NewOracleObservation returns the observation of the value for the round
+// of the instance id, signed by the oracle.
+func NewOracleObservation(id byzcoin.InstanceID, round uint64, value []byte, oracle darc.Signer) (*OracleObservation, error) {
+	sig, err := oracle.Sign(OracleMessage(id, round, value))
+	if err != nil {
+		return nil, err
+	}
+	return &OracleObservation{
+		Round:     round,
+		Value:     value,
+		Oracle:    oracle.Identity(),
+		Signature: sig,
+	}, nil
+}
+
+// GetOracleValue returns the latest aggregated value of an oracle instance
+// and its round. Contracts can use it to read a feed.
+func GetOracleValue(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) ([]byte, uint64, error) {
+	value, _, cid, _, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, 0, err
+	}
+	if cid != ContractOracleID {
+		return nil, 0, errors.New("instance is not an oracle")
+	}
+	var feed OracleFeed
+	if err = decodeOracleFeed(value, &feed); err != nil {
+		return nil, 0, err
+	}
+	if feed.Round == 0 {
+		return nil, 0, errors.New("oracle has no value yet")
+	}
+	return feed.Value, feed.Round, nil
+}
+
+func decodeOracleFeed(buf []byte, feed *OracleFeed) error {
+	return protobuf.DecodeWithConstructors(buf, feed, network.DefaultConstructors(cothority.Suite))
+}
+
+func (c *OracleConfig) verify() error {
+	if len(c.Oracles) == 0 {
+		return errors.New("need at least one oracle")
+	}
+	if c.Threshold == 0 || int(c.Threshold) > len(c.Oracles) {
+		return fmt.Errorf("threshold must be between 1 and %d", len(c.Oracles))
+	}
+	for i := range c.Oracles {
+		for j := i + 1; j < len(c.Oracles); j++ {
+			if c.Oracles[i].Equal(&c.Oracles[j]) {
+				return fmt.Errorf("oracle %s is twice in the config", c.Oracles[i].String())
+			}
+		}
+	}
+	switch c.Aggregation {
+	case OracleAggregateEqual, OracleAggregateMedian:
+	default:
+		return fmt.Errorf("unknown aggregation %s", c.Aggregation)
+	}
+	return nil
+}
+
+func (c *OracleConfig) isOracle(id darc.Identity) bool {
+	for i := range c.Oracles {
+		if c.Oracles[i].Equal(&id) {
+			return true
+		}
+	}
+	return false
+}
+
+type contractOracle struct {
+	byzcoin.BasicContract
+	OracleFeed
+}
+
+func contractOracleFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractOracle{}
+	err := decodeOracleFeed(in, &c.OracleFeed)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractOracle) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if err = c.setConfig(inst.Spawn.Args.Search("config")); err != nil {
+		return
+	}
+	var buf []byte
+	buf, err = protobuf.Encode(&c.OracleFeed)
+	if err != nil {
+		return
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractOracleID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractOracle) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "post":
+		var obs OracleObservation
+		err = protobuf.DecodeWithConstructors(inst.Invoke.Args.Search("observation"), &obs,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode observation: " + err.Error())
+		}
+		if err = c.post(inst.InstanceID, obs); err != nil {
+			return
+		}
+	case "configure":
+		if err = c.setConfig(inst.Invoke.Args.Search("config")); err != nil {
+			return
+		}
+	default:
+		return nil, nil, errors.New("oracle contract can only post and configure")
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.OracleFeed)
+	if err != nil {
+		return
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractOracleID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractOracle) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractOracleID, nil, darcID),
+	}
+	return
+}
+
+// setConfig decodes and verifies the config, and drops the pending
+// observations.
+func (c *contractOracle) setConfig(buf []byte) error {
+	var config OracleConfig
+	err := protobuf.DecodeWithConstructors(buf, &config, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return errors.New("couldn't decode config: " + err.Error())
+	}
+	if err = config.verify(); err != nil {
+		return err
+	}
+	c.Config = config
+	c.Pending = nil
+	return nil
+}
+
+// post verifies the observation, adds it to the pending ones and aggregates
+// its round if the threshold is reached.
+func (c *contractOracle) post(id byzcoin.InstanceID, obs OracleObservation) error {
+	if obs.Round <= c.Round {
+		return fmt.Errorf("round %d is already aggregated", obs.Round)
+	}
+	if !c.Config.isOracle(obs.Oracle) {
+		return fmt.Errorf("%s is not an oracle", obs.Oracle.String())
+	}
+	if err := obs.Oracle.Verify(OracleMessage(id, obs.Round, obs.Value), obs.Signature); err != nil {
+		return errors.New("wrong signature of the observation: " + err.Error())
+	}
+	if c.Config.Aggregation == OracleAggregateMedian && len(obs.Value) != 8 {
+		return errors.New("the observation is not a 64-bit uint")
+	}
+
+	var pending int
+	var round []OracleObservation
+	for _, o := range c.Pending {
+		if !o.Oracle.Equal(&obs.Oracle) {
+			if o.Round == obs.Round {
+				round = append(round, o)
+			}
+			continue
+		}
+		if o.Round == obs.Round {
+			return fmt.Errorf("%s already posted for round %d", obs.Oracle.String(), obs.Round)
+		}
+		pending++
+	}
+	if pending >= oracleMaxPending {
+		return fmt.Errorf("%s has too many pending observations", obs.Oracle.String())
+	}
+	c.Pending = append(c.Pending, obs)
+	round = append(round, obs)
+
+	value, ok := c.aggregate(round)
+	if !ok {
+		return nil
+	}
+	c.Round = obs.Round
+	c.Value = value
+	var later []OracleObservation
+	for _, o := range c.Pending {
+		if o.Round > c.Round {
+			later = append(later, o)
+		}
+	}
+	c.Pending = later
+	return nil
+}
+
+// aggregate returns the value of the round if the threshold is reached.
+func (c *contractOracle) aggregate(round []OracleObservation) ([]byte, bool) {
+	threshold := int(c.Config.Threshold)
+	if len(round) < threshold {
+		return nil, false
+	}
+	switch c.Config.Aggregation {
+	case OracleAggregateEqual:
+		count := make(map[string]int)
+		for _, o := range round {
+			count[string(o.Value)]++
+			if count[string(o.Value)] >= threshold {
+				return o.Value, true
+			}
+		}
+	case OracleAggregateMedian:
+		values := make([]uint64, len(round))
+		for i, o := range round {
+			values[i] = binary.LittleEndian.Uint64(o.Value)
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, values[(len(values)-1)/2])
+		return buf, true
+	}
+	return nil, false
+}
+
+// OracleClient posts the observations of one oracle to an oracle instance.
+// The instructions are signed by the oracle, so the darc of the instance
+// must allow it to invoke post.
+type OracleClient struct {
+	cl     *byzcoin.Client
+	id     byzcoin.InstanceID
+	oracle darc.Signer
+}
+
+// NewOracleClient returns a client for the oracle instance id.
+func NewOracleClient(cl *byzcoin.Client, id byzcoin.InstanceID, oracle darc.Signer) *OracleClient {
+	return &OracleClient{cl: cl, id: id, oracle: oracle}
+}
+
+// Post sends the observation of the value for the round, and waits up to
+// wait blocks for its inclusion.
+func (oc *OracleClient) Post(round uint64, value []byte, wait int) error {
+	obs, err := NewOracleObservation(oc.id, round, value, oc.oracle)
+	if err != nil {
+		return err
+	}
+	buf, err := protobuf.Encode(obs)
+	if err != nil {
+		return err
+	}
+	b := oc.cl.NewTxBuilder(oc.oracle)
+	b.Invoke(byzcoin.ExistingInstance(oc.id), "post", byzcoin.Arguments{{Name: "observation", Value: buf}})
+	_, err = b.Send(wait)
+	return err
+}
+
+// Latest returns the feed of the oracle instance, after verifying its
+// proof.
+func (oc *OracleClient) Latest() (*OracleFeed, error) {
+	pr, err := oc.cl.GetProof(oc.id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if err = pr.Proof.Verify(oc.cl.ID); err != nil {
+		return nil, err
+	}
+	if !pr.Proof.InclusionProof.Match(oc.id.Slice()) {
+		return nil, errors.New("oracle instance doesn't exist")
+	}
+	v, cid, _, err := pr.Proof.Get(oc.id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if cid != ContractOracleID {
+		return nil, errors.New("instance is not an oracle")
+	}
+	var feed OracleFeed
+	if err = decodeOracleFeed(v, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
@@ -0,0 +1,196 @@
+package contracts
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/dedis/onet"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOracle_Median(t *testing.T) {
+	ct := newCT()
+	oracles := []darc.Signer{darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil)}
+	config := func(threshold uint32, aggregation string, oracles ...darc.Signer) []byte {
+		var ids []darc.Identity
+		for _, o := range oracles {
+			ids = append(ids, o.Identity())
+		}
+		buf, err := protobuf.Encode(&OracleConfig{Oracles: ids, Threshold: threshold, Aggregation: aggregation})
+		require.NoError(t, err)
+		return buf
+	}
+
+	spawn := func(config []byte) ([]byzcoin.StateChange, error) {
+		c, _ := contractOracleFromBytes(nil)
+		sc, _, err := c.Spawn(ct, byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractOracleID,
+				Args:       byzcoin.Arguments{{Name: "config", Value: config}},
+			},
+		}, nil)
+		return sc, err
+	}
+	_, err := spawn(config(0, OracleAggregateMedian, oracles...))
+	require.Error(t, err)
+	_, err = spawn(config(4, OracleAggregateMedian, oracles...))
+	require.Error(t, err)
+	_, err = spawn(config(2, "mean", oracles...))
+	require.Error(t, err)
+	_, err = spawn(config(2, OracleAggregateMedian, oracles[0], oracles[0]))
+	require.Error(t, err)
+	sc, err := spawn(config(2, OracleAggregateMedian, oracles...))
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	id := byzcoin.NewInstanceID(sc[0].InstanceID)
+
+	invoke := func(cmd string, args byzcoin.Arguments) error {
+		c, err := contractOracleFromBytes(ct.values[string(id.Slice())])
+		require.NoError(t, err)
+		sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+			InstanceID: id,
+			Invoke:     &byzcoin.Invoke{Command: cmd, Args: args},
+		}, nil)
+		if err == nil {
+			storeSC(ct, sc)
+		}
+		return err
+	}
+	post := func(oracle darc.Signer, round uint64, value []byte) error {
+		obs, err := NewOracleObservation(id, round, value, oracle)
+		require.NoError(t, err)
+		buf, err := protobuf.Encode(obs)
+		require.NoError(t, err)
+		return invoke("post", byzcoin.Arguments{{Name: "observation", Value: buf}})
+	}
+
+	_, _, err = GetOracleValue(ct, id)
+	require.Error(t, err)
+
+	// Not an oracle, not a number, wrong signature.
+	require.Error(t, post(gsigner, 1, uint64Buf(10)))
+	require.Error(t, post(oracles[0], 1, []byte("ten")))
+	obs, err := NewOracleObservation(id, 1, uint64Buf(10), oracles[0])
+	require.NoError(t, err)
+	obs.Value = uint64Buf(11)
+	buf, err := protobuf.Encode(obs)
+	require.NoError(t, err)
+	require.Error(t, invoke("post", byzcoin.Arguments{{Name: "observation", Value: buf}}))
+
+	// An observation of a later round is kept while round 1 is
+	// aggregated.
+	require.NoError(t, post(oracles[0], 1, uint64Buf(10)))
+	require.Error(t, post(oracles[0], 1, uint64Buf(10)))
+	require.NoError(t, post(oracles[0], 2, uint64Buf(20)))
+	require.NoError(t, post(oracles[2], 1, uint64Buf(14)))
+	v, round, err := GetOracleValue(ct, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), round)
+	require.Equal(t, uint64Buf(10), v)
+
+	// Round 1 is done.
+	require.Error(t, post(oracles[1], 1, uint64Buf(12)))
+	require.NoError(t, post(oracles[1], 2, uint64Buf(22)))
+	v, round, err = GetOracleValue(ct, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), round)
+	require.Equal(t, uint64Buf(20), v)
+
+	// Configure drops the pending observations.
+	require.NoError(t, post(oracles[0], 3, uint64Buf(30)))
+	require.NoError(t, invoke("configure", byzcoin.Arguments{{Name: "config",
+		Value: config(1, OracleAggregateEqual, oracles[1])}}))
+	var feed OracleFeed
+	require.NoError(t, decodeOracleFeed(ct.values[string(id.Slice())], &feed))
+	require.Equal(t, 0, len(feed.Pending))
+	require.Error(t, post(oracles[0], 3, uint64Buf(30)))
+	require.NoError(t, post(oracles[1], 3, []byte("thirty")))
+	v, round, err = GetOracleValue(ct, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), round)
+	require.Equal(t, []byte("thirty"), v)
+}
+
+func TestOracle_Client(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:darc"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.Nil(t, err)
+
+	// The darc of the oracle instance lets the oracles post.
+	var oracles []darc.Signer
+	var ids []darc.Identity
+	var idStrs []string
+	for i := 0; i < 4; i++ {
+		o := darc.NewSignerEd25519(nil, nil)
+		oracles = append(oracles, o)
+		ids = append(ids, o.Identity())
+		idStrs = append(idStrs, o.Identity().String())
+	}
+	oracleDarc := darc.NewDarc(darc.InitRules([]darc.Identity{signer.Identity()},
+		[]darc.Identity{signer.Identity()}), []byte("oracles"))
+	require.Nil(t, oracleDarc.Rules.AddRule(darc.Action("spawn:"+ContractOracleID), oracleDarc.Rules.GetSignExpr()))
+	require.Nil(t, oracleDarc.Rules.AddRule("invoke:post", expression.InitOrExpr(idStrs...)))
+	oracleDarcBuf, err := oracleDarc.ToProto()
+	require.Nil(t, err)
+	configBuf, err := protobuf.Encode(&OracleConfig{Oracles: ids, Threshold: 3, Aggregation: OracleAggregateEqual})
+	require.Nil(t, err)
+
+	// The darc and the oracle are spawned in the same transaction.
+	b := cl.NewTxBuilder(signer)
+	b.Spawn(byzcoin.ExistingInstance(byzcoin.NewInstanceID(gDarc.GetBaseID())), byzcoin.ContractDarcID,
+		byzcoin.Arguments{{Name: "darc", Value: oracleDarcBuf}})
+	b.Spawn(byzcoin.ExistingInstance(byzcoin.NewInstanceID(oracleDarc.GetBaseID())), ContractOracleID,
+		byzcoin.Arguments{{Name: "config", Value: configBuf}})
+	results, err := b.Send(10)
+	require.Nil(t, err)
+	id := results[1].InstanceID
+
+	// All the oracles post concurrently. The last one might come after
+	// the aggregation of the round, and be refused.
+	var wg sync.WaitGroup
+	errs := make([]error, len(oracles))
+	for i, o := range oracles {
+		wg.Add(1)
+		go func(i int, o darc.Signer) {
+			defer wg.Done()
+			errs[i] = NewOracleClient(cl, id, o).Post(1, []byte("2018-10-18"), 10)
+		}(i, o)
+	}
+	wg.Wait()
+	var refused int
+	for _, err := range errs {
+		if err != nil {
+			refused++
+		}
+	}
+	require.True(t, refused <= 1)
+
+	feed, err := NewOracleClient(cl, id, oracles[0]).Latest()
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), feed.Round)
+	require.Equal(t, []byte("2018-10-18"), feed.Value)
+
+	// The admin is not an oracle.
+	require.NotNil(t, NewOracleClient(cl, id, signer).Post(2, []byte("2018-10-19"), 10))
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -6,11 +6,21 @@ import (
 	"github.com/dedis/onet/log"
 )
 
-// This service is only used because we need to register our contracts to
-// the ByzCoin service. So we create this stub and add contracts to it
-// from the `contracts` directory.
+// The contracts of this package are registered for all the ByzCoin
+// services, including the ones that are not attached to a conode. The stub
+// service is kept so that the applications that refer to it still find it.
 
 func init() {
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractValueID, contractValueFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractCoinID, contractCoinFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractTokenID, contractTokenFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractTokenAccountID, contractTokenAccountFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractNFTCollectionID, contractNFTCollectionFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractNFTID, contractNFTFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractEscrowID, contractEscrowFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractKVID, contractKVFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractOracleID, contractOracleFromBytes))
+
 	_, err := onet.RegisterNewService("contracts", newService)
 	log.ErrFatal(err)
 }
@@ -26,7 +36,5 @@ func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 	}
-	byzcoin.RegisterContract(c, ContractValueID, contractValueFromBytes)
-	byzcoin.RegisterContract(c, ContractCoinID, contractCoinFromBytes)
 	return s, nil
 }
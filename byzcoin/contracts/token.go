@@ -0,0 +1,577 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// ContractTokenID denotes a contract that defines a fungible token.
+var ContractTokenID = "token"
+
+// ContractTokenAccountID denotes a contract that holds the tokens of one
+// owner.
+var ContractTokenAccountID = "tokenAccount"
+
+// maxTokenDecimals is the highest number of decimals a token can have.
+const maxTokenDecimals = 18
+
+// The token contracts implement fungible tokens with metadata, a cap on the
+// total supply and allowances. A token is defined by an instance of
+// ContractToken, and the tokens are held in instances of
+// ContractTokenAccount. The instance ID of the token definition is used as
+// the Name of the byzcoin.Coin, so that tokens can be passed between
+// instructions like the coins of ContractCoin.
+//
+// ContractToken is spawned from a darc with the following arguments:
+//  - "symbol" is the short name of the token, it is mandatory
+//  - "name" is a longer description of the token
+//  - "decimals" is the number of decimals used to display the token as a
+//    64-bit uint in LittleEndian, it must not be bigger than 18
+//  - "cap" is the maximum total supply as a 64-bit uint in LittleEndian. If
+//    it is missing or 0, the supply is not limited.
+// The following methods are available on a token:
+//  - mint creates "coins" new tokens in the account given in "destination".
+//    As minting is an invoke on the token, it is governed by the
+//    "invoke:mint" rule of the darc of the token.
+// A token can only be deleted if its supply is 0.
+//
+// ContractTokenAccount is spawned from a darc with the argument "token" that
+// holds the instance ID of the token. Accounts have the following methods:
+//  - transfer sends "coins" tokens to the account in "destination"
+//  - batchTransfer sends tokens to many accounts at once. The argument
+//    "transfers" is a protobuf encoded TokenTransfers.
+//  - approve allows the account in "spender" to transfer up to "coins"
+//    tokens from this account. An approve of 0 removes the allowance.
+//  - transferFrom is invoked by the spender on its own account and sends
+//    "coins" tokens from the account in "from" to the account in
+//    "destination", using the allowance given by "from".
+//  - burn destroys "coins" tokens of the account and reduces the supply of
+//    the token
+//  - fetch takes "coins" tokens out of the account and returns them as an
+//    output parameter for the next instruction to interpret.
+//  - store puts the tokens given to the instance back into the account.
+//    ContractCoin refuses to create coins named after a token, so the only
+//    coins of a token come from fetch.
+// An account can only be deleted if it is empty.
+//
+// All values are given in the smallest unit of the token.
+
+// Token holds the definition of a token.
+type Token struct {
+	Symbol   string
+	Name     string
+	Decimals uint32
+	// Cap is the maximum supply, 0 means no limit.
+	Cap uint64
+	// Supply is the number of tokens that have been minted and not
+	// burnt.
+	Supply uint64
+}
+
+// TokenAccount holds the tokens of one owner.
+type TokenAccount struct {
+	// Token is the instance ID of the token definition.
+	Token   byzcoin.InstanceID
+	Balance uint64
+	// Allowances are the tokens other accounts may transfer from this
+	// account.
+	Allowances []TokenAllowance
+}
+
+// TokenAllowance is the number of tokens the spender may transfer.
+type TokenAllowance struct {
+	Spender byzcoin.InstanceID
+	Value   uint64
+}
+
+// TokenTransfer is one destination of a batchTransfer.
+type TokenTransfer struct {
+	Destination byzcoin.InstanceID
+	Value       uint64
+}
+
+// TokenTransfers is the argument of a batchTransfer.
+type TokenTransfers struct {
+	Transfers []TokenTransfer
+}
+
+type contractToken struct {
+	byzcoin.BasicContract
+	Token
+}
+
+func contractTokenFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractToken{}
+	err := protobuf.Decode(in, &c.Token)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractToken) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	args := inst.Spawn.Args
+	c.Symbol = string(args.Search("symbol"))
+	if c.Symbol == "" {
+		return nil, nil, errors.New("argument \"symbol\" is missing")
+	}
+	c.Name = string(args.Search("name"))
+	if buf := args.Search("decimals"); buf != nil {
+		var decimals uint64
+		decimals, err = uint64Arg(buf, "decimals")
+		if err != nil {
+			return
+		}
+		if decimals > maxTokenDecimals {
+			return nil, nil, errors.New("too many decimals")
+		}
+		c.Decimals = uint32(decimals)
+	}
+	if buf := args.Search("cap"); buf != nil {
+		c.Cap, err = uint64Arg(buf, "cap")
+		if err != nil {
+			return
+		}
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode token: " + err.Error())
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractTokenID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractToken) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "mint":
+		var value uint64
+		value, err = uint64Arg(inst.Invoke.Args.Search("coins"), "coins")
+		if err != nil {
+			return
+		}
+		c.Supply, err = safeAdd(c.Supply, value)
+		if err != nil {
+			return
+		}
+		if c.Cap > 0 && c.Supply > c.Cap {
+			return nil, nil, errors.New("minting would exceed the cap of the token")
+		}
+		accounts := newTokenAccounts(rst, inst.InstanceID)
+		var dest *TokenAccount
+		dest, err = accounts.get(byzcoin.NewInstanceID(inst.Invoke.Args.Search("destination")))
+		if err != nil {
+			return
+		}
+		dest.Balance, err = safeAdd(dest.Balance, value)
+		if err != nil {
+			return
+		}
+		log.Lvlf2("minting %d %s", value, c.Symbol)
+		sc, err = accounts.stateChanges()
+		if err != nil {
+			return
+		}
+	default:
+		return nil, nil, errors.New("token contract can only mint")
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode token: " + err.Error())
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractTokenID, buf, darcID))
+	return
+}
+
+func (c *contractToken) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Supply > 0 {
+		err = errors.New("cannot delete a token that still has a supply")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractTokenID, nil, darcID),
+	}
+	return
+}
+
+type contractTokenAccount struct {
+	byzcoin.BasicContract
+	TokenAccount
+}
+
+func contractTokenAccountFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractTokenAccount{}
+	err := protobuf.Decode(in, &c.TokenAccount)
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+	}
+	return c, nil
+}
+
+func (c *contractTokenAccount) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	tokenBuf := inst.Spawn.Args.Search("token")
+	if len(tokenBuf) != len(byzcoin.InstanceID{}) {
+		return nil, nil, errors.New("token needs to be an InstanceID")
+	}
+	var cid string
+	_, _, cid, _, err = rst.GetValues(tokenBuf)
+	if err == nil && cid != ContractTokenID {
+		err = errors.New("token is not a token contract")
+	}
+	if err != nil {
+		return
+	}
+	c.TokenAccount = TokenAccount{Token: byzcoin.NewInstanceID(tokenBuf)}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.TokenAccount)
+	if err != nil {
+		return nil, nil, errors.New("couldn't encode token account: " + err.Error())
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractTokenAccountID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractTokenAccount) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	accounts := newTokenAccounts(rst, c.Token)
+	if err = accounts.add(inst.InstanceID, &c.TokenAccount); err != nil {
+		return
+	}
+
+	args := inst.Invoke.Args
+	var value uint64
+	switch inst.Invoke.Command {
+	case "batchTransfer", "store":
+	default:
+		value, err = uint64Arg(args.Search("coins"), "coins")
+		if err != nil {
+			return
+		}
+	}
+
+	switch inst.Invoke.Command {
+	case "transfer":
+		err = accounts.transfer(inst.InstanceID, byzcoin.NewInstanceID(args.Search("destination")), value)
+	case "batchTransfer":
+		var transfers TokenTransfers
+		err = protobuf.Decode(args.Search("transfers"), &transfers)
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode transfers: " + err.Error())
+		}
+		if len(transfers.Transfers) == 0 {
+			return nil, nil, errors.New("no transfers given")
+		}
+		for _, t := range transfers.Transfers {
+			if err = accounts.transfer(inst.InstanceID, t.Destination, t.Value); err != nil {
+				return
+			}
+		}
+	case "approve":
+		spender := byzcoin.NewInstanceID(args.Search("spender"))
+		if spender.Equal(inst.InstanceID) {
+			return nil, nil, errors.New("cannot approve own account")
+		}
+		c.setAllowance(spender, value)
+	case "transferFrom":
+		from := byzcoin.NewInstanceID(args.Search("from"))
+		if from.Equal(inst.InstanceID) {
+			return nil, nil, errors.New("use transfer to send from own account")
+		}
+		var owner *TokenAccount
+		owner, err = accounts.get(from)
+		if err != nil {
+			return
+		}
+		allowance := owner.allowance(inst.InstanceID)
+		if allowance < value {
+			return nil, nil, errors.New("allowance is too small")
+		}
+		owner.setAllowance(inst.InstanceID, allowance-value)
+		err = accounts.transfer(from, byzcoin.NewInstanceID(args.Search("destination")), value)
+	case "burn":
+		c.Balance, err = safeSub(c.Balance, value)
+		if err != nil {
+			return
+		}
+		var token Token
+		var tokenDarc darc.ID
+		token, tokenDarc, err = loadToken(rst, c.Token)
+		if err != nil {
+			return
+		}
+		token.Supply, err = safeSub(token.Supply, value)
+		if err != nil {
+			return
+		}
+		var buf []byte
+		buf, err = protobuf.Encode(&token)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode token: " + err.Error())
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, c.Token,
+			ContractTokenID, buf, tokenDarc))
+	case "fetch":
+		c.Balance, err = safeSub(c.Balance, value)
+		if err != nil {
+			return
+		}
+		cout = append(cout, byzcoin.Coin{Name: c.Token, Value: value})
+	case "store":
+		cout = []byzcoin.Coin{}
+		for _, co := range coins {
+			if c.Token.Equal(co.Name) {
+				c.Balance, err = safeAdd(c.Balance, co.Value)
+				if err != nil {
+					return
+				}
+			} else {
+				cout = append(cout, co)
+			}
+		}
+	default:
+		err = errors.New("unknown command for token account: " + inst.Invoke.Command)
+	}
+	if err != nil {
+		return
+	}
+
+	var accountsSC []byzcoin.StateChange
+	accountsSC, err = accounts.stateChanges()
+	if err != nil {
+		return
+	}
+	sc = append(accountsSC, sc...)
+	return
+}
+
+func (c *contractTokenAccount) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Balance > 0 {
+		err = errors.New("cannot delete a token account that still has tokens in it")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractTokenAccountID, nil, darcID),
+	}
+	return
+}
+
+func (a *TokenAccount) allowance(spender byzcoin.InstanceID) uint64 {
+	for _, al := range a.Allowances {
+		if al.Spender.Equal(spender) {
+			return al.Value
+		}
+	}
+	return 0
+}
+
+// setAllowance sets the allowance of the spender, a value of 0 removes it.
+func (a *TokenAccount) setAllowance(spender byzcoin.InstanceID, value uint64) {
+	for i, al := range a.Allowances {
+		if al.Spender.Equal(spender) {
+			if value == 0 {
+				a.Allowances = append(a.Allowances[:i], a.Allowances[i+1:]...)
+			} else {
+				a.Allowances[i].Value = value
+			}
+			return
+		}
+	}
+	if value > 0 {
+		a.Allowances = append(a.Allowances, TokenAllowance{Spender: spender, Value: value})
+	}
+}
+
+// tokenAccounts holds all accounts of one token that are modified by an
+// instruction, so that an account appearing more than once gets only one
+// state change.
+type tokenAccounts struct {
+	rst      byzcoin.ReadOnlyStateTrie
+	token    byzcoin.InstanceID
+	ids      []byzcoin.InstanceID
+	accounts map[string]*TokenAccount
+	darcIDs  map[string]darc.ID
+}
+
+func newTokenAccounts(rst byzcoin.ReadOnlyStateTrie, token byzcoin.InstanceID) *tokenAccounts {
+	return &tokenAccounts{
+		rst:      rst,
+		token:    token,
+		accounts: make(map[string]*TokenAccount),
+		darcIDs:  make(map[string]darc.ID),
+	}
+}
+
+// add stores an account that is already loaded.
+func (ta *tokenAccounts) add(id byzcoin.InstanceID, account *TokenAccount) error {
+	_, _, _, darcID, err := ta.rst.GetValues(id.Slice())
+	if err != nil {
+		return err
+	}
+	ta.ids = append(ta.ids, id)
+	ta.accounts[string(id.Slice())] = account
+	ta.darcIDs[string(id.Slice())] = darcID
+	return nil
+}
+
+// get returns the account, loading it from the trie if necessary.
+func (ta *tokenAccounts) get(id byzcoin.InstanceID) (*TokenAccount, error) {
+	if a, ok := ta.accounts[string(id.Slice())]; ok {
+		return a, nil
+	}
+	v, _, cid, darcID, err := ta.rst.GetValues(id.Slice())
+	if err == nil && cid != ContractTokenAccountID {
+		err = errors.New("instance is not a token account")
+	}
+	if err != nil {
+		return nil, err
+	}
+	a := &TokenAccount{}
+	if err := protobuf.Decode(v, a); err != nil {
+		return nil, errors.New("couldn't unmarshal token account: " + err.Error())
+	}
+	if !a.Token.Equal(ta.token) {
+		return nil, errors.New("account holds another token")
+	}
+	ta.ids = append(ta.ids, id)
+	ta.accounts[string(id.Slice())] = a
+	ta.darcIDs[string(id.Slice())] = darcID
+	return a, nil
+}
+
+func (ta *tokenAccounts) transfer(from, to byzcoin.InstanceID, value uint64) error {
+	if from.Equal(to) {
+		return errors.New("cannot transfer to the same account")
+	}
+	src, err := ta.get(from)
+	if err != nil {
+		return err
+	}
+	dst, err := ta.get(to)
+	if err != nil {
+		return err
+	}
+	if src.Balance, err = safeSub(src.Balance, value); err != nil {
+		return err
+	}
+	if dst.Balance, err = safeAdd(dst.Balance, value); err != nil {
+		return err
+	}
+	log.Lvlf2("transferring %d from %x to %x", value, from.Slice(), to.Slice())
+	return nil
+}
+
+// stateChanges returns the updates of all accounts, in the order they have
+// been added.
+func (ta *tokenAccounts) stateChanges() ([]byzcoin.StateChange, error) {
+	var sc []byzcoin.StateChange
+	for _, id := range ta.ids {
+		buf, err := protobuf.Encode(ta.accounts[string(id.Slice())])
+		if err != nil {
+			return nil, errors.New("couldn't encode token account: " + err.Error())
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, id,
+			ContractTokenAccountID, buf, ta.darcIDs[string(id.Slice())]))
+	}
+	return sc, nil
+}
+
+func loadToken(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) (token Token, darcID darc.ID, err error) {
+	var v []byte
+	var cid string
+	v, _, cid, darcID, err = rst.GetValues(id.Slice())
+	if err == nil && cid != ContractTokenID {
+		err = errors.New("not a token contract")
+	}
+	if err != nil {
+		return
+	}
+	err = protobuf.Decode(v, &token)
+	return
+}
+
+// isToken returns true if id is an instance of ContractToken.
+func isToken(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) bool {
+	_, _, cid, _, err := rst.GetValues(id.Slice())
+	return err == nil && cid == ContractTokenID
+}
+
+// uint64Arg decodes an argument that holds a 64-bit uint in LittleEndian.
+func uint64Arg(buf []byte, name string) (uint64, error) {
+	if buf == nil {
+		return 0, errors.New("argument \"" + name + "\" is missing")
+	}
+	if len(buf) != 8 {
+		return 0, errors.New("argument \"" + name + "\" needs to be 8 bytes")
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+func safeAdd(a, b uint64) (uint64, error) {
+	if a > math.MaxUint64-b {
+		return 0, errors.New("uint64 overflow")
+	}
+	return a + b, nil
+}
+
+func safeSub(a, b uint64) (uint64, error) {
+	if b > a {
+		return 0, errors.New("uint64 underflow")
+	}
+	return a - b, nil
+}
@@ -0,0 +1,306 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken_Spawn(t *testing.T) {
+	ct := newCT("spawn:token")
+
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractTokenID,
+			Args: byzcoin.Arguments{
+				{Name: "symbol", Value: []byte("TKN")},
+				{Name: "decimals", Value: uint64Buf(19)},
+			},
+		},
+	}
+	c, _ := contractTokenFromBytes(nil)
+	_, _, err := c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+
+	inst.Spawn.Args = byzcoin.Arguments{
+		{Name: "symbol", Value: []byte("TKN")},
+		{Name: "decimals", Value: uint64Buf(2)},
+		{Name: "cap", Value: uint64Buf(100)},
+	}
+	sc, _, err := c.Spawn(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	var token Token
+	require.NoError(t, protobuf.Decode(sc[0].Value, &token))
+	require.Equal(t, Token{Symbol: "TKN", Decimals: 2, Cap: 100}, token)
+}
+
+func TestToken_Mint(t *testing.T) {
+	ct, tokenID, accounts := newTokenCT(t, 2)
+
+	mint := func(value uint64) ([]byzcoin.StateChange, error) {
+		inst := byzcoin.Instruction{
+			InstanceID: tokenID,
+			Invoke: &byzcoin.Invoke{
+				Command: "mint",
+				Args: byzcoin.Arguments{
+					{Name: "coins", Value: uint64Buf(value)},
+					{Name: "destination", Value: accounts[0].Slice()},
+				},
+			},
+		}
+		c, err := contractTokenFromBytes(ct.values[string(tokenID.Slice())])
+		require.NoError(t, err)
+		sc, _, err := c.Invoke(ct, inst, nil)
+		return sc, err
+	}
+
+	sc, err := mint(60)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(60), getTokenAccount(t, ct, accounts[0]).Balance)
+	require.Equal(t, uint64(60), getToken(t, ct, tokenID).Supply)
+
+	// The cap is 100.
+	_, err = mint(41)
+	require.Error(t, err)
+	sc, err = mint(40)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(100), getToken(t, ct, tokenID).Supply)
+}
+
+func TestToken_TransferFrom(t *testing.T) {
+	ct, tokenID, accounts := newTokenCT(t, 3)
+	setBalance(t, ct, accounts[0], 10)
+
+	// Without allowance, nothing can be transferred.
+	transferFrom := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(4)},
+		{Name: "from", Value: accounts[0].Slice()},
+		{Name: "destination", Value: accounts[2].Slice()},
+	}
+	_, err := invokeAccount(ct, accounts[1], "transferFrom", transferFrom)
+	require.Error(t, err)
+
+	sc, err := invokeAccount(ct, accounts[0], "approve", byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(5)},
+		{Name: "spender", Value: accounts[1].Slice()},
+	})
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(5), getTokenAccount(t, ct, accounts[0]).allowance(accounts[1]))
+
+	sc, err = invokeAccount(ct, accounts[1], "transferFrom", transferFrom)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(6), getTokenAccount(t, ct, accounts[0]).Balance)
+	require.Equal(t, uint64(1), getTokenAccount(t, ct, accounts[0]).allowance(accounts[1]))
+	require.Equal(t, uint64(4), getTokenAccount(t, ct, accounts[2]).Balance)
+
+	// The allowance is used up.
+	_, err = invokeAccount(ct, accounts[1], "transferFrom", transferFrom)
+	require.Error(t, err)
+
+	// The token cannot be used as an account.
+	_, err = invokeAccount(ct, accounts[0], "transfer", byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(1)},
+		{Name: "destination", Value: tokenID.Slice()},
+	})
+	require.Error(t, err)
+}
+
+func TestToken_BatchTransfer(t *testing.T) {
+	ct, _, accounts := newTokenCT(t, 3)
+	setBalance(t, ct, accounts[0], 10)
+
+	batch := func(transfers ...TokenTransfer) ([]byzcoin.StateChange, error) {
+		buf, err := protobuf.Encode(&TokenTransfers{Transfers: transfers})
+		require.NoError(t, err)
+		return invokeAccount(ct, accounts[0], "batchTransfer", byzcoin.Arguments{
+			{Name: "transfers", Value: buf},
+		})
+	}
+
+	// Not enough tokens for all transfers.
+	_, err := batch(TokenTransfer{accounts[1], 6}, TokenTransfer{accounts[2], 5})
+	require.Error(t, err)
+
+	// The same destination can appear more than once.
+	sc, err := batch(TokenTransfer{accounts[1], 2}, TokenTransfer{accounts[2], 3},
+		TokenTransfer{accounts[1], 4})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(sc))
+	storeSC(ct, sc)
+	require.Equal(t, uint64(1), getTokenAccount(t, ct, accounts[0]).Balance)
+	require.Equal(t, uint64(6), getTokenAccount(t, ct, accounts[1]).Balance)
+	require.Equal(t, uint64(3), getTokenAccount(t, ct, accounts[2]).Balance)
+}
+
+func TestToken_BurnFetchStore(t *testing.T) {
+	ct, tokenID, accounts := newTokenCT(t, 1)
+	setBalance(t, ct, accounts[0], 10)
+
+	sc, err := invokeAccount(ct, accounts[0], "burn", byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(3)},
+	})
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(7), getTokenAccount(t, ct, accounts[0]).Balance)
+	require.Equal(t, uint64(7), getToken(t, ct, tokenID).Supply)
+
+	c, err := contractTokenAccountFromBytes(ct.values[string(accounts[0].Slice())])
+	require.NoError(t, err)
+	_, cout, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: accounts[0],
+		Invoke: &byzcoin.Invoke{
+			Command: "fetch",
+			Args:    byzcoin.Arguments{{Name: "coins", Value: uint64Buf(2)}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: tokenID, Value: 2}}, cout)
+
+	// Only the coins of the token are stored.
+	other := byzcoin.Coin{Name: CoinName, Value: 1}
+	_, cout, err = c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: accounts[0],
+		Invoke:     &byzcoin.Invoke{Command: "store"},
+	}, append(cout, other))
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, cout)
+	require.Equal(t, uint64(7), c.(*contractTokenAccount).Balance)
+}
+
+func TestToken_StoreMintedCoins(t *testing.T) {
+	ct, tokenID, accounts := newTokenCT(t, 1)
+
+	// A coin instance cannot be named after the token.
+	c, _ := contractCoinFromBytes(nil)
+	_, _, err := c.Spawn(ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractCoinID,
+			Args:       byzcoin.Arguments{{Name: "type", Value: tokenID.Slice()}},
+		},
+	}, nil)
+	require.Error(t, err)
+
+	// A coin instance spawned before the token can mint, but its coins
+	// cannot be fetched and stored in a token account.
+	coinID := byzcoin.NewInstanceID([]byte("coin"))
+	buf, err := protobuf.Encode(&byzcoin.Coin{Name: tokenID})
+	require.NoError(t, err)
+	ct.Store(coinID, buf, ContractCoinID, gdarc.GetBaseID())
+	c, err = contractCoinFromBytes(ct.values[string(coinID.Slice())])
+	require.NoError(t, err)
+	_, _, err = c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: coinID,
+		Invoke: &byzcoin.Invoke{
+			Command: "mint",
+			Args:    byzcoin.Arguments{{Name: "coins", Value: uint64Buf(1000)}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	_, cout, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: coinID,
+		Invoke: &byzcoin.Invoke{
+			Command: "fetch",
+			Args:    byzcoin.Arguments{{Name: "coins", Value: uint64Buf(1000)}},
+		},
+	}, nil)
+	require.Error(t, err)
+	require.Empty(t, cout)
+
+	sc, err := invokeAccountWithCoins(ct, accounts[0], "store", cout)
+	require.NoError(t, err)
+	storeSC(ct, sc)
+	require.Equal(t, uint64(0), getTokenAccount(t, ct, accounts[0]).Balance)
+	require.Equal(t, uint64(0), getToken(t, ct, tokenID).Supply)
+}
+
+// newTokenCT creates a token with a cap of 100 and n empty accounts.
+func newTokenCT(t *testing.T, n int) (*cvTest, byzcoin.InstanceID, []byzcoin.InstanceID) {
+	ct := newCT()
+	tokenID := byzcoin.NewInstanceID([]byte("token"))
+	buf, err := protobuf.Encode(&Token{Symbol: "TKN", Cap: 100})
+	require.NoError(t, err)
+	ct.Store(tokenID, buf, ContractTokenID, gdarc.GetBaseID())
+
+	var accounts []byzcoin.InstanceID
+	for i := 0; i < n; i++ {
+		id := byzcoin.NewInstanceID([]byte{byte(i + 1)})
+		buf, err := protobuf.Encode(&TokenAccount{Token: tokenID})
+		require.NoError(t, err)
+		ct.Store(id, buf, ContractTokenAccountID, gdarc.GetBaseID())
+		accounts = append(accounts, id)
+	}
+	return ct, tokenID, accounts
+}
+
+// setBalance sets the balance of an account and the supply of its token.
+func setBalance(t *testing.T, ct *cvTest, id byzcoin.InstanceID, value uint64) {
+	account := getTokenAccount(t, ct, id)
+	account.Balance = value
+	buf, err := protobuf.Encode(&account)
+	require.NoError(t, err)
+	ct.Store(id, buf, ContractTokenAccountID, gdarc.GetBaseID())
+
+	token := getToken(t, ct, account.Token)
+	token.Supply += value
+	buf, err = protobuf.Encode(&token)
+	require.NoError(t, err)
+	ct.Store(account.Token, buf, ContractTokenID, gdarc.GetBaseID())
+}
+
+func invokeAccount(ct *cvTest, id byzcoin.InstanceID, cmd string, args byzcoin.Arguments) ([]byzcoin.StateChange, error) {
+	c, err := contractTokenAccountFromBytes(ct.values[string(id.Slice())])
+	if err != nil {
+		return nil, err
+	}
+	sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: id,
+		Invoke:     &byzcoin.Invoke{Command: cmd, Args: args},
+	}, nil)
+	return sc, err
+}
+
+func invokeAccountWithCoins(ct *cvTest, id byzcoin.InstanceID, cmd string, coins []byzcoin.Coin) ([]byzcoin.StateChange, error) {
+	c, err := contractTokenAccountFromBytes(ct.values[string(id.Slice())])
+	if err != nil {
+		return nil, err
+	}
+	sc, _, err := c.Invoke(ct, byzcoin.Instruction{
+		InstanceID: id,
+		Invoke:     &byzcoin.Invoke{Command: cmd},
+	}, coins)
+	return sc, err
+}
+
+func storeSC(ct *cvTest, scs []byzcoin.StateChange) {
+	for _, sc := range scs {
+		ct.Store(byzcoin.NewInstanceID(sc.InstanceID), sc.Value, string(sc.ContractID), sc.DarcID)
+	}
+}
+
+func getTokenAccount(t *testing.T, ct *cvTest, id byzcoin.InstanceID) TokenAccount {
+	var account TokenAccount
+	require.NoError(t, protobuf.Decode(ct.values[string(id.Slice())], &account))
+	return account
+}
+
+func getToken(t *testing.T, ct *cvTest, id byzcoin.InstanceID) Token {
+	var token Token
+	require.NoError(t, protobuf.Decode(ct.values[string(id.Slice())], &token))
+	return token
+}
+
+func uint64Buf(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
@@ -0,0 +1,115 @@
+package byzcoin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dedis/cothority/darc"
+)
+
+// DarcVersion is a version of a darc with the index of the block it has been
+// committed in.
+type DarcVersion struct {
+	Darc       *darc.Darc
+	BlockIndex int
+}
+
+// PrunedVersionsError is returned by GetDarcHistory, together with the
+// versions that are still stored, if some versions of the darc have been
+// pruned from the storage of the state changes of the node.
+type PrunedVersionsError struct {
+	// Missing are the versions that have been pruned.
+	Missing []uint64
+}
+
+func (e *PrunedVersionsError) Error() string {
+	return fmt.Sprintf("versions %v of the darc have been pruned", e.Missing)
+}
+
+// GetDarcHistory returns all the versions of the darc with the given base ID,
+// from the oldest to the latest, using GetAllInstanceVersion on the instance
+// of the darc. The Client's Roster and ID should be initialized before calling
+// this method (see NewClientFromConfig).
+//
+// The nodes only keep a limited number of state changes, so the oldest
+// versions can be missing. In that case, the versions that are still stored
+// are returned with a *PrunedVersionsError. Versions are thus to be found by
+// their Darc.Version, not by their position in the slice.
+func (c *Client) GetDarcHistory(baseID darc.ID) ([]DarcVersion, error) {
+	resp, err := c.GetAllInstanceVersion(NewInstanceID(baseID))
+	if err != nil {
+		return nil, err
+	}
+	var versions []DarcVersion
+	for _, sc := range resp.StateChanges {
+		if string(sc.StateChange.ContractID) != ContractDarcID {
+			return nil, errors.New("instance is not a darc")
+		}
+		d, err := darc.NewFromProtobuf(sc.StateChange.Value)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, DarcVersion{Darc: d, BlockIndex: sc.BlockIndex})
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("darc not found")
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Darc.Version < versions[j].Darc.Version
+	})
+	if missing := missingDarcVersions(versions); len(missing) > 0 {
+		return versions, &PrunedVersionsError{Missing: missing}
+	}
+	return versions, nil
+}
+
+// missingDarcVersions returns the versions that are not in the sorted
+// versions, up to the latest of them.
+func missingDarcVersions(versions []DarcVersion) []uint64 {
+	var missing []uint64
+	var next uint64
+	for _, v := range versions {
+		for ; next < v.Darc.Version; next++ {
+			missing = append(missing, next)
+		}
+		next = v.Darc.Version + 1
+	}
+	return missing
+}
+
+// FindDarcVersion returns the version of the darc from the versions returned
+// by GetDarcHistory, or an error if it is missing.
+func FindDarcVersion(versions []DarcVersion, version uint64) (DarcVersion, error) {
+	for _, v := range versions {
+		if v.Darc.Version == version {
+			return v, nil
+		}
+	}
+	if len(versions) > 0 && version < versions[len(versions)-1].Darc.Version {
+		return DarcVersion{}, fmt.Errorf("version %d of the darc has been pruned", version)
+	}
+	return DarcVersion{}, fmt.Errorf("version %d of the darc doesn't exist", version)
+}
+
+// NewDarcRestoreInstruction returns the instruction evolving the darc latest
+// to a new version with the rules of prev, a previous version of it. The
+// signer counters and the signatures of the instruction still need to be set,
+// by signers fulfilling the evolve rule of latest.
+func NewDarcRestoreInstruction(latest, prev *darc.Darc) (Instruction, error) {
+	d, err := latest.Restore(prev)
+	if err != nil {
+		return Instruction{}, err
+	}
+	buf, err := d.ToProto()
+	if err != nil {
+		return Instruction{}, err
+	}
+	return Instruction{
+		InstanceID: NewInstanceID(d.GetBaseID()),
+		Invoke: &Invoke{
+			Command: CmdDarcEvolve,
+			Args:    Arguments{{Name: "darc", Value: buf}},
+		},
+	}, nil
+}
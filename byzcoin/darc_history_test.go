@@ -0,0 +1,93 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/darc"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_DarcHistory evolves the genesis darc twice, reads its history
+// and restores the rules of the first evolution.
+func TestClient_DarcHistory(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	cl := NewClient(s.genesis.SkipChainID(), *s.roster)
+
+	evolve := func(instr Instruction, counter uint64) {
+		instr.SignerCounter = []uint64{counter}
+		ctx, err := combineInstrsAndSign(s.signer, instr)
+		require.NoError(t, err)
+		s.sendTxAndWait(t, ctx, 10)
+	}
+	evolveTo := func(d *darc.Darc, counter uint64) {
+		buf, err := d.ToProto()
+		require.NoError(t, err)
+		evolve(Instruction{
+			InstanceID: NewInstanceID(d.GetBaseID()),
+			Invoke: &Invoke{
+				Command: CmdDarcEvolve,
+				Args:    Arguments{{Name: "darc", Value: buf}},
+			},
+		}, counter)
+	}
+
+	d1 := s.darc.Copy()
+	require.NoError(t, d1.EvolveFrom(s.darc))
+	require.NoError(t, d1.Rules.AddRule("spawn:history", []byte("ed25519:a")))
+	evolveTo(d1, 1)
+	d2 := d1.Copy()
+	require.NoError(t, d2.EvolveFrom(d1))
+	require.NoError(t, d2.Rules.UpdateRule("spawn:history", []byte("ed25519:b")))
+	evolveTo(d2, 2)
+
+	versions, err := cl.GetDarcHistory(s.darc.GetBaseID())
+	require.NoError(t, err)
+	require.Equal(t, 3, len(versions))
+	for i, v := range versions {
+		require.Equal(t, uint64(i), v.Darc.Version)
+	}
+	require.Equal(t, 0, versions[0].BlockIndex)
+	v, err := FindDarcVersion(versions, 1)
+	require.NoError(t, err)
+	require.Equal(t, d1.GetID(), v.Darc.GetID())
+	_, err = FindDarcVersion(versions, 3)
+	require.Error(t, err)
+	require.True(t, versions[2].BlockIndex > versions[1].BlockIndex)
+	diffs := darc.DiffRules(versions[1].Darc.Rules, versions[2].Darc.Rules)
+	require.Equal(t, 1, len(diffs))
+	require.Equal(t, "~ spawn:history: ed25519:a -> ed25519:b", diffs[0].String())
+
+	instr, err := NewDarcRestoreInstruction(versions[2].Darc, versions[1].Darc)
+	require.NoError(t, err)
+	evolve(instr, 3)
+	versions, err = cl.GetDarcHistory(s.darc.GetBaseID())
+	require.NoError(t, err)
+	require.Equal(t, 4, len(versions))
+	require.Equal(t, 0, len(darc.DiffRules(versions[1].Darc.Rules, versions[3].Darc.Rules)))
+
+	_, err = cl.GetDarcHistory(darc.ID([]byte("unknown")))
+	require.Error(t, err)
+}
+
+// TestDarcHistory_Pruned looks up the versions of a darc whose oldest
+// versions have been pruned by the nodes.
+func TestDarcHistory_Pruned(t *testing.T) {
+	var versions []DarcVersion
+	for _, version := range []uint64{2, 3, 5} {
+		d := darc.NewDarc(darc.NewRules(), []byte("pruned"))
+		d.Version = version
+		versions = append(versions, DarcVersion{Darc: d, BlockIndex: int(version)})
+	}
+	require.Equal(t, []uint64{0, 1, 4}, missingDarcVersions(versions))
+
+	v, err := FindDarcVersion(versions, 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, v.BlockIndex)
+	_, err = FindDarcVersion(versions, 0)
+	require.EqualError(t, err, "version 0 of the darc has been pruned")
+	_, err = FindDarcVersion(versions, 4)
+	require.EqualError(t, err, "version 4 of the darc has been pruned")
+	_, err = FindDarcVersion(versions, 6)
+	require.EqualError(t, err, "version 6 of the darc doesn't exist")
+}
@@ -0,0 +1,345 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+var forwardTxMsgID network.MessageTypeID
+var forwardTxAckMsgID network.MessageTypeID
+
+func init() {
+	forwardTxMsgID = network.RegisterMessage(&ForwardTx{})
+	forwardTxAckMsgID = network.RegisterMessage(&ForwardTxAck{})
+}
+
+// ForwardTx is sent by a node that received a new transaction to the leader
+// of the skipchain, so that the leader doesn't need to wait for the next
+// collection of transactions to learn about it.
+type ForwardTx struct {
+	SkipchainID skipchain.SkipBlockID
+	Transaction ClientTransaction
+}
+
+// ForwardTxAck is the reply of the leader to a ForwardTx message. If the
+// leader refuses the transaction, Error is set and Ack is empty.
+type ForwardTxAck struct {
+	SkipchainID skipchain.SkipBlockID
+	TxHash      []byte
+	Ack         TxAck
+	Error       string
+}
+
+// Hash computes the digest that is signed by the leader.
+func (ack TxAck) Hash() []byte {
+	h := sha256.New()
+	h.Write(ack.SkipchainID)
+	h.Write(ack.TxHash)
+	if ack.Leader != nil {
+		h.Write(ack.Leader.ID[:])
+	}
+	tsBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tsBuf, uint64(ack.Timestamp))
+	h.Write(tsBuf)
+	return h.Sum(nil)
+}
+
+// Verify checks that the acknowledgement is signed by its leader. The caller
+// must check that the leader is part of the roster of the skipchain.
+func (ack TxAck) Verify() error {
+	if ack.Leader == nil {
+		return errors.New("acknowledgement without leader")
+	}
+	return schnorr.Verify(cothority.Suite, ack.Leader.Public, ack.Hash(), ack.Signature)
+}
+
+// inRoster returns true if si is a member of the roster with the same public
+// key. Comparing only the IDs is not enough, as the ID of a server identity
+// can be reused with another key.
+func inRoster(r *onet.Roster, si *network.ServerIdentity) bool {
+	if r == nil || si == nil {
+		return false
+	}
+	_, member := r.Search(si.ID)
+	return member != nil && member.Public.Equal(si.Public)
+}
+
+// pendingTxExpiry is how long a forwarded transaction is sent again to the
+// new leaders. A transaction that the leader dropped without including it
+// in a block is forgotten after that time.
+var pendingTxExpiry = 10 * time.Minute
+
+// pendingTx is a forwarded transaction with the time it was acknowledged.
+type pendingTx struct {
+	tx    ClientTransaction
+	added time.Time
+}
+
+// txForwarder keeps track of the transactions that have been forwarded to
+// the leader, so that they can be sent again if the leader changes before
+// they are included.
+type txForwarder struct {
+	sync.Mutex
+	// acks holds the channels of the transactions waiting for an
+	// acknowledgement of the leader, keyed on the skipchain ID and the
+	// transaction hash.
+	acks map[string]chan ForwardTxAck
+	// pending holds the forwarded transactions that are not yet included,
+	// keyed on the skipchain ID and then on the transaction hash.
+	pending map[string]map[string]pendingTx
+}
+
+func newTxForwarder() txForwarder {
+	return txForwarder{
+		acks:    make(map[string]chan ForwardTxAck),
+		pending: make(map[string]map[string]pendingTx),
+	}
+}
+
+func ackKey(scID skipchain.SkipBlockID, txHash []byte) string {
+	return string(scID) + "/" + string(txHash)
+}
+
+func (f *txForwarder) waitAck(scID skipchain.SkipBlockID, txHash []byte) chan ForwardTxAck {
+	f.Lock()
+	defer f.Unlock()
+	ch := make(chan ForwardTxAck, 1)
+	f.acks[ackKey(scID, txHash)] = ch
+	return ch
+}
+
+func (f *txForwarder) deleteAck(scID skipchain.SkipBlockID, txHash []byte) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.acks, ackKey(scID, txHash))
+}
+
+func (f *txForwarder) informAck(reply ForwardTxAck) {
+	f.Lock()
+	defer f.Unlock()
+	if ch, ok := f.acks[ackKey(reply.SkipchainID, reply.TxHash)]; ok {
+		select {
+		case ch <- reply:
+		default:
+		}
+	}
+}
+
+// addPending stores a transaction acknowledged by the leader until it is
+// included, and removes the expired ones of the skipchain.
+func (f *txForwarder) addPending(scID skipchain.SkipBlockID, tx ClientTransaction) {
+	f.Lock()
+	defer f.Unlock()
+	txs, ok := f.pending[string(scID)]
+	if !ok {
+		txs = make(map[string]pendingTx)
+		f.pending[string(scID)] = txs
+	}
+	for h, p := range txs {
+		if time.Since(p.added) >= pendingTxExpiry {
+			delete(txs, h)
+		}
+	}
+	txs[string(tx.Instructions.Hash())] = pendingTx{tx: tx, added: time.Now()}
+}
+
+// included removes the transaction from the pending ones, as it doesn't need
+// to be forwarded again.
+func (f *txForwarder) included(scID skipchain.SkipBlockID, txHash []byte) {
+	f.Lock()
+	defer f.Unlock()
+	if txs, ok := f.pending[string(scID)]; ok {
+		delete(txs, string(txHash))
+	}
+}
+
+// takePending returns all the pending transactions of a skipchain and removes
+// them. The transactions older than pendingTxExpiry are dropped.
+func (f *txForwarder) takePending(scID skipchain.SkipBlockID) []ClientTransaction {
+	f.Lock()
+	defer f.Unlock()
+	var out []ClientTransaction
+	for _, p := range f.pending[string(scID)] {
+		if time.Since(p.added) < pendingTxExpiry {
+			out = append(out, p.tx)
+		}
+	}
+	delete(f.pending, string(scID))
+	return out
+}
+
+// signTxAck returns an acknowledgement for the transaction, signed by this
+// node.
+func (s *Service) signTxAck(scID skipchain.SkipBlockID, txHash []byte) (*TxAck, error) {
+	ack := &TxAck{
+		SkipchainID: scID,
+		TxHash:      txHash,
+		Leader:      s.ServerIdentity(),
+		Timestamp:   time.Now().UnixNano(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, s.getPrivateKey(), ack.Hash())
+	if err != nil {
+		return nil, err
+	}
+	ack.Signature = sig
+	return ack, nil
+}
+
+// forwardTx sends the transaction to the current leader and waits for its
+// acknowledgement. If this node is the leader, the transaction is directly
+// added to the buffer. If an error is returned, the transaction hasn't been
+// added anywhere.
+func (s *Service) forwardTx(scID skipchain.SkipBlockID, tx ClientTransaction) (*TxAck, error) {
+	leader, err := s.getLeader(scID)
+	if err != nil {
+		return nil, err
+	}
+	txHash := tx.Instructions.Hash()
+	if leader.Equal(s.ServerIdentity()) {
+		s.txBuffer.add(string(scID), tx)
+		return s.signTxAck(scID, txHash)
+	}
+
+	interval, _, err := s.LoadBlockInfo(scID)
+	if err != nil {
+		return nil, err
+	}
+	ch := s.txForwarder.waitAck(scID, txHash)
+	defer s.txForwarder.deleteAck(scID, txHash)
+	if err := s.SendRaw(leader, &ForwardTx{SkipchainID: scID, Transaction: tx}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.Error != "" {
+			return nil, errors.New("leader refused transaction: " + reply.Error)
+		}
+		if !reply.Ack.Leader.Equal(leader) {
+			return nil, errors.New("acknowledgement is not from the leader")
+		}
+		s.txForwarder.addPending(scID, tx)
+		return &reply.Ack, nil
+	case <-time.After(interval / 2):
+		return nil, errors.New("timeout while waiting for the leader")
+	}
+}
+
+// addTx makes sure the transaction reaches the leader. If the leader cannot
+// be reached, the transaction is stored locally, so that it's sent with the
+// next collection of transactions.
+func (s *Service) addTx(scID skipchain.SkipBlockID, tx ClientTransaction) *TxAck {
+	ack, err := s.forwardTx(scID, tx)
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "couldn't forward transaction, keeping it:", err)
+		s.txBuffer.add(string(scID), tx)
+		return nil
+	}
+	return ack
+}
+
+// retryForwardedTxs sends the forwarded transactions that are not yet
+// included to the new leader. It is called after a view-change, because the
+// old leader might have lost them.
+func (s *Service) retryForwardedTxs(scID skipchain.SkipBlockID) {
+	txs := s.txForwarder.takePending(scID)
+	if len(txs) == 0 {
+		return
+	}
+	log.Lvlf2("%s: forwarding %d transactions to the new leader", s.ServerIdentity(), len(txs))
+	for _, tx := range txs {
+		s.addTx(scID, tx)
+	}
+}
+
+// handleForwardTx should be registered as a handler for ForwardTx messages.
+// It adds the transaction to the buffer if this node is the leader and
+// replies with a signed acknowledgement.
+func (s *Service) handleForwardTx(env *network.Envelope) {
+	req, ok := env.Msg.(*ForwardTx)
+	if !ok {
+		log.Error(s.ServerIdentity(), "failed to cast to ForwardTx")
+		return
+	}
+	txHash := req.Transaction.Instructions.Hash()
+	reply := &ForwardTxAck{SkipchainID: req.SkipchainID, TxHash: txHash}
+	if err := s.acceptForwardedTx(env.ServerIdentity, req); err != nil {
+		reply.Error = err.Error()
+	} else {
+		ack, err := s.signTxAck(req.SkipchainID, txHash)
+		if err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply.Ack = *ack
+		}
+	}
+	if err := s.SendRaw(env.ServerIdentity, reply); err != nil {
+		log.Error(s.ServerIdentity(), "couldn't send acknowledgement:", err)
+	}
+}
+
+func (s *Service) acceptForwardedTx(sender *network.ServerIdentity, req *ForwardTx) error {
+	if len(req.Transaction.Instructions) == 0 {
+		return errors.New("no instructions")
+	}
+	latest, err := s.db().GetLatestByID(req.SkipchainID)
+	if err != nil {
+		return errors.New("unknown skipchain")
+	}
+	if !inRoster(latest.Roster, sender) {
+		return errors.New("sender is not in the roster")
+	}
+	leader, err := s.getLeader(req.SkipchainID)
+	if err != nil {
+		return err
+	}
+	if !leader.Equal(s.ServerIdentity()) {
+		return errors.New("not the leader")
+	}
+	_, maxsz, err := s.LoadBlockInfo(req.SkipchainID)
+	if err != nil {
+		return err
+	}
+	if txSize(TxResult{ClientTransaction: req.Transaction}) > maxsz {
+		return errors.New("transaction too large")
+	}
+	s.txBuffer.add(string(req.SkipchainID), req.Transaction)
+	return nil
+}
+
+// handleForwardTxAck should be registered as a handler for ForwardTxAck
+// messages.
+func (s *Service) handleForwardTxAck(env *network.Envelope) {
+	reply, ok := env.Msg.(*ForwardTxAck)
+	if !ok {
+		log.Error(s.ServerIdentity(), "failed to cast to ForwardTxAck")
+		return
+	}
+	if reply.Error == "" {
+		if err := reply.Ack.Verify(); err != nil {
+			log.Error(s.ServerIdentity(), "invalid acknowledgement:", err)
+			return
+		}
+		if !reply.Ack.SkipchainID.Equal(reply.SkipchainID) || !bytes.Equal(reply.Ack.TxHash, reply.TxHash) {
+			log.Error(s.ServerIdentity(), "acknowledgement of another transaction")
+			return
+		}
+		if !reply.Ack.Leader.Equal(env.ServerIdentity) ||
+			!reply.Ack.Leader.Public.Equal(env.ServerIdentity.Public) {
+			log.Error(s.ServerIdentity(), "acknowledgement not signed by the sender")
+			return
+		}
+	}
+	s.txForwarder.informAck(*reply)
+}
@@ -0,0 +1,81 @@
+package byzcoin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ForwardTx(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	for i, idx := range []int{0, 1} {
+		tx, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, uint64(i+1))
+		require.NoError(t, err)
+		resp, err := s.services[idx].AddTransaction(&AddTxRequest{
+			Version:     CurrentVersion,
+			SkipchainID: s.genesis.SkipChainID(),
+			Transaction: tx,
+		})
+		require.NoError(t, err)
+
+		// Whatever node gets the transaction, the leader must
+		// acknowledge it.
+		require.NotNil(t, resp.Ack)
+		require.NoError(t, resp.Ack.Verify())
+		require.True(t, resp.Ack.Leader.Equal(s.services[0].ServerIdentity()))
+		require.Equal(t, tx.Instructions.Hash(), resp.Ack.TxHash)
+
+		// A modified acknowledgement must not verify.
+		ack := *resp.Ack
+		ack.Timestamp++
+		require.Error(t, ack.Verify())
+
+		key := tx.Instructions[0].DeriveID("").Slice()
+		pr := s.waitProofWithIdx(t, key, idx)
+		require.True(t, pr.InclusionProof.Match(key))
+	}
+
+	// Once included, the transaction must not be sent again.
+	require.Empty(t, s.services[1].txForwarder.takePending(s.genesis.SkipChainID()))
+
+	// The ID of a member with another key is not a member.
+	leader := s.services[0].ServerIdentity()
+	require.True(t, inRoster(s.roster, leader))
+	forged := *leader
+	forged.Public = key.NewKeyPair(cothority.Suite).Public
+	require.False(t, inRoster(s.roster, &forged))
+}
+
+func TestTxForwarder(t *testing.T) {
+	f := newTxForwarder()
+	scID := []byte("scID")
+	tx := ClientTransaction{Instructions: []Instruction{{InstanceID: NewInstanceID([]byte("a"))}}}
+
+	f.addPending(scID, tx)
+	f.included(scID, []byte("other"))
+	require.Equal(t, []ClientTransaction{tx}, f.takePending(scID))
+	require.Empty(t, f.takePending(scID))
+
+	f.addPending(scID, tx)
+	f.included(scID, tx.Instructions.Hash())
+	require.Empty(t, f.takePending(scID))
+
+	// A transaction that is never included expires.
+	defer func(expiry time.Duration) { pendingTxExpiry = expiry }(pendingTxExpiry)
+	pendingTxExpiry = 0
+	f.addPending(scID, tx)
+	require.Empty(t, f.takePending(scID))
+
+	// The acknowledgements are for a transaction on a skipchain.
+	ch := f.waitAck(scID, tx.Instructions.Hash())
+	f.informAck(ForwardTxAck{SkipchainID: []byte("other"), TxHash: tx.Instructions.Hash()})
+	require.Equal(t, 0, len(ch))
+	f.informAck(ForwardTxAck{SkipchainID: scID, TxHash: tx.Instructions.Hash()})
+	require.Equal(t, 1, len(ch))
+	f.deleteAck(scID, tx.Instructions.Hash())
+}
@@ -83,7 +83,8 @@ func createSC(t *testing.T) (s sc) {
 		return err
 	})
 	require.Nil(t, err)
-	s.s = skipchain.NewSkipBlockDB(db, bnsc)
+	s.s, err = skipchain.NewSkipBlockDB(db, bnsc)
+	require.Nil(t, err)
 
 	bucketName := []byte("a testing string")
 	err = db.Update(func(tx *bolt.Tx) error {
@@ -96,7 +97,7 @@ func createSC(t *testing.T) (s sc) {
 
 	s.key = []byte("key")
 	s.value = []byte("value")
-	s.c.StoreAll([]StateChange{{StateAction: Create, InstanceID: s.key, Value: s.value}}, 1)
+	s.c.StoreAll([]StateChange{{StateAction: Create, InstanceID: s.key, Value: s.value}}, 1, 0)
 
 	s.genesis = skipchain.NewSkipBlock()
 	s.genesis.Roster, s.genesisPrivs = genRoster(1)
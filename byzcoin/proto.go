@@ -7,6 +7,7 @@ import (
 	"github.com/dedis/cothority/darc"
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
 )
 
 // PROTOSTART
@@ -21,6 +22,7 @@ import (
 // type :Version:sint32
 // import "skipchain.proto";
 // import "onet.proto";
+// import "network.proto";
 // import "darc.proto";
 // import "trie.proto";
 //
@@ -64,6 +66,11 @@ type CreateGenesisBlock struct {
 	// Maximum block size. Zero (or not present in protobuf) means use the default, 4 megs.
 	// optional
 	MaxBlockSize int
+	// ReplayProtection of the chain, the signer counters by default.
+	ReplayProtection ReplayProtection `protobuf:"opt"`
+	// NonceMaxExpiry is only used with ReplayNonce. Zero means use the
+	// default, 1000 blocks.
+	NonceMaxExpiry uint64 `protobuf:"opt"`
 }
 
 // CreateGenesisBlockResponse holds the genesis-block of the new skipchain.
@@ -91,6 +98,30 @@ type AddTxRequest struct {
 type AddTxResponse struct {
 	// Version of the protocol
 	Version Version
+	// Ack is the acknowledgement of the leader that the transaction is in its
+	// pool of pending transactions. It is missing if the leader couldn't be
+	// reached, in which case the transaction is kept by the node that
+	// received it until the next collection of transactions.
+	Ack *TxAck `protobuf:"opt"`
+}
+
+// TxAck is signed by the leader of a skipchain when it accepts a transaction
+// in its pool of pending transactions. It is not a guarantee that the
+// transaction will be included, but it tells the client that the leader knows
+// about it.
+type TxAck struct {
+	// SkipchainID is the chain where the transaction will be added.
+	SkipchainID skipchain.SkipBlockID
+	// TxHash is the hash of the instructions of the transaction.
+	TxHash []byte
+	// Leader is the node that accepted the transaction.
+	Leader *network.ServerIdentity
+	// Timestamp is the time of the acknowledgement in nanoseconds since the
+	// epoch.
+	Timestamp int64
+	// Signature is the schnorr signature of the leader on the hash of the
+	// acknowledgement.
+	Signature []byte
 }
 
 // GetProof returns the proof that the given key is in the trie.
@@ -125,6 +156,9 @@ type CheckAuthorization struct {
 	DarcID darc.ID
 	// Identities that will sign together
 	Identities []darc.Identity
+	// Explain, if set, asks for the trace of the evaluation of the rule
+	// of this action.
+	Explain darc.Action `protobuf:"opt"`
 }
 
 // CheckAuthorizationResponse returns a list of Actions that the given identities
@@ -132,6 +166,9 @@ type CheckAuthorization struct {
 // given identities have now authorization in that darc at all.
 type CheckAuthorizationResponse struct {
 	Actions []darc.Action
+	// Trace is the trace of the evaluation of the rule of the action
+	// given in Explain.
+	Trace *darc.EvalTrace `protobuf:"opt"`
 }
 
 // ChainConfig stores all the configuration information for one skipchain. It
@@ -140,6 +177,27 @@ type ChainConfig struct {
 	BlockInterval time.Duration
 	Roster        onet.Roster
 	MaxBlockSize  int
+	// ReplayProtection selects how the instructions are protected against
+	// replays. The default is to use the signer counters.
+	ReplayProtection ReplayProtection `protobuf:"opt"`
+	// NonceMaxExpiry is the maximum number of blocks between the current
+	// block and the expiry of an instruction when ReplayNonce is used.
+	NonceMaxExpiry uint64 `protobuf:"opt"`
+	// ContractUpgrades are the versions of the contracts activated by the
+	// upgrade_contract command, in the order they were requested.
+	ContractUpgrades []ContractUpgrade `protobuf:"opt"`
+}
+
+// ContractUpgrade activates a version of a contract. The first block with
+// an index greater or equal to Block migrates all the instances of the
+// contract to the new version, and the instructions from this block on are
+// executed by the new version.
+type ContractUpgrade struct {
+	ContractID string
+	Version    uint32
+	Block      uint64
+	// Migrated is set by the block that migrated the instances.
+	Migrated bool
 }
 
 // Proof represents everything necessary to verify a given
@@ -176,11 +234,18 @@ type Instruction struct {
 	// SignerCounter must be set to a value that is one greater than what
 	// was in the last instruction signed by the same signer. Every counter
 	// must map to the corresponding element in Signature. The initial
-	// counter is 1. Overflow is allowed.
+	// counter is 1. Overflow is allowed. It must be empty if the chain
+	// uses nonces.
 	SignerCounter []uint64
 	// Signatures that are verified using the Darc controlling access to
 	// the instance.
 	Signatures []darc.Signature
+	// Nonce is a random value of NonceLength bytes, used instead of the
+	// SignerCounter if the chain uses nonces.
+	Nonce []byte `protobuf:"opt"`
+	// Expiry is the last block index where the instruction can be executed
+	// if the chain uses nonces.
+	Expiry uint64 `protobuf:"opt"`
 }
 
 // Spawn is called upon an existing instance that will spawn a new instance.
@@ -376,3 +441,61 @@ type CheckStateChangeValidityResponse struct {
 	StateChanges []StateChange
 	BlockID      skipchain.SkipBlockID
 }
+
+// GetViewChangeStatus requests the state of the view-change controller of a
+// node for the given chain.
+type GetViewChangeStatus struct {
+	// ByzCoinID of the chain
+	ByzCoinID skipchain.SkipBlockID
+}
+
+// GetViewChangeStatusResponse holds the current view of the node, the
+// view-change requests it accumulated and the reason of the last failed
+// view-change.
+type GetViewChangeStatusResponse struct {
+	// CurrentView is the view the node is in. If no view-change is in
+	// progress, it points to the latest block with the leader at index 0.
+	CurrentView ViewStatus
+	// Pending holds the view-change requests received for every pending
+	// view.
+	Pending []ViewStatus
+	// LastFailure is the reason why the last view-change failed on this
+	// node, it is empty if none failed.
+	LastFailure string
+}
+
+// ViewStatus describes one view and the nodes that requested it.
+type ViewStatus struct {
+	// LatestID is the ID of the block the view is based on.
+	LatestID skipchain.SkipBlockID
+	// LeaderIndex is the index of the leader in the roster of LatestID.
+	LeaderIndex int
+	// Signers are the IDs of the nodes that requested this view.
+	Signers [][]byte
+	// TimerStarted is true once 2f+1 requests have been received and the
+	// node waits for the view-change to complete.
+	TimerStarted bool
+}
+
+// RequestViewChange asks a node to start a view-change, so that the
+// leadership can be moved away from a node, e.g. before maintenance. It must
+// be signed by an identity that satisfies the "invoke:view_change" rule of the
+// genesis darc. The request needs to be sent to at least 2f+1 nodes for the
+// view-change to happen.
+type RequestViewChange struct {
+	// ByzCoinID of the chain
+	ByzCoinID skipchain.SkipBlockID
+	// LatestID must be the ID of the latest block, so that a request
+	// cannot be replayed later.
+	LatestID skipchain.SkipBlockID
+	// LeaderIndex is the index of the new leader in the current roster,
+	// it must be at least 1.
+	LeaderIndex int
+	// Signature on the hash of the request.
+	Signature darc.Signature
+}
+
+// RequestViewChangeResponse is returned once the node accepted the request
+// and started the view-change.
+type RequestViewChangeResponse struct {
+}
@@ -0,0 +1,170 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/pairing"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// NewReplayService returns a ByzCoin service that is not attached to a
+// conode: it has no network and no database, and can only be used to replay
+// chains with ReplayChain. Besides the configuration and darc contracts, it
+// knows the contracts and versions registered with RegisterGlobalContract and
+// RegisterGlobalContractVersion.
+func NewReplayService() *Service {
+	s := &Service{
+		contracts:        make(map[string]ContractFn),
+		contractVersions: make(map[string]map[uint32]contractVersion),
+	}
+	s.registerContract(ContractConfigID, s.contractConfigFromBytes)
+	s.registerContract(ContractDarcID, s.contractDarcFromBytes)
+	s.registerGlobalContracts()
+	return s
+}
+
+// ReplayChain verifies a chain without using the stored state of the
+// service. The blocks must start with the genesis block and follow each
+// other. For every block, it checks the hash of the block and the forward
+// link from the previous block, then re-executes the transactions on a
+// trie in memory and compares the result with the header of the block. The
+// cache of the state changes is neither used nor filled, so that every
+// transaction is executed again. Only the contracts registered in this
+// service can be executed: if an accepted transaction uses another contract,
+// or a version of a contract that is not registered, an error is returned
+// before replaying any block. The callback, if not nil, is called after
+// every verified block.
+func (s *Service) ReplayChain(blocks []*skipchain.SkipBlock, cb func(*skipchain.SkipBlock)) error {
+	if len(blocks) == 0 || blocks[0].Index != 0 {
+		return errors.New("need the blocks starting from the genesis block")
+	}
+	if err := s.checkReplayContracts(blocks); err != nil {
+		return err
+	}
+
+	var sst *stagingStateTrie
+	for i, sb := range blocks {
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return fmt.Errorf("block %d has a wrong hash", sb.Index)
+		}
+		if i > 0 {
+			if err := verifyReplayLink(blocks[i-1], sb); err != nil {
+				return fmt.Errorf("block %d: %s", sb.Index, err)
+			}
+		}
+
+		var header DataHeader
+		err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return fmt.Errorf("block %d: couldn't unmarshal header: %s", sb.Index, err)
+		}
+		var body DataBody
+		err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return fmt.Errorf("block %d: couldn't unmarshal body: %s", sb.Index, err)
+		}
+
+		if i == 0 {
+			nonce, err := s.loadNonceFromTxs(body.TxResults)
+			if err != nil {
+				return err
+			}
+			if sst, err = newMemStagingStateTrie(nonce); err != nil {
+				return err
+			}
+		}
+		sst.index = sb.Index - 1
+		sst.timestamp = header.Timestamp
+
+		mtr, txOut, scs, _ := s.executeStateChanges(sst, sb.SkipChainID(), body.TxResults, noTimeout)
+		if len(txOut) != len(body.TxResults) {
+			return fmt.Errorf("block %d: transaction list length mismatch after execution", sb.Index)
+		}
+		for j := range txOut {
+			if txOut[j].Accepted != body.TxResults[j].Accepted {
+				return fmt.Errorf("block %d: accept mismatch on transaction %d", sb.Index, j)
+			}
+		}
+		if !bytes.Equal(header.ClientTransactionHash, txOut.Hash()) {
+			return fmt.Errorf("block %d: client transaction hash doesn't verify", sb.Index)
+		}
+		if !bytes.Equal(header.TrieRoot, mtr) {
+			return fmt.Errorf("block %d: trie root doesn't verify", sb.Index)
+		}
+		if !bytes.Equal(header.StateChangesHash, scs.Hash()) {
+			return fmt.Errorf("block %d: state changes hash doesn't verify", sb.Index)
+		}
+		if err = sst.StoreAll(scs); err != nil {
+			return err
+		}
+
+		if cb != nil {
+			cb(sb)
+		}
+	}
+	return nil
+}
+
+// checkReplayContracts verifies that the contracts spawned by the accepted
+// transactions of the blocks, and the versions activated by them, are
+// registered in the service. Otherwise the replay would refuse these
+// transactions and only report a mismatch.
+func (s *Service) checkReplayContracts(blocks []*skipchain.SkipBlock) error {
+	for _, sb := range blocks {
+		var body DataBody
+		err := protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return fmt.Errorf("block %d: couldn't unmarshal body: %s", sb.Index, err)
+		}
+		for _, tx := range body.TxResults {
+			if !tx.Accepted {
+				continue
+			}
+			for _, instr := range tx.ClientTransaction.Instructions {
+				switch {
+				case instr.Spawn != nil:
+					if _, ok := s.contracts[instr.Spawn.ContractID]; !ok {
+						return fmt.Errorf("block %d: unknown contract %s", sb.Index, instr.Spawn.ContractID)
+					}
+				case instr.Invoke != nil && instr.InstanceID.Equal(ConfigInstanceID) &&
+					instr.Invoke.Command == CmdConfigUpgradeContract:
+					contractID := string(instr.Invoke.Args.Search("contract_id"))
+					versionBuf := instr.Invoke.Args.Search("version")
+					if len(versionBuf) != 8 {
+						continue
+					}
+					version := binary.LittleEndian.Uint64(versionBuf)
+					if _, ok := s.contractVersions[contractID][uint32(version)]; !ok {
+						return fmt.Errorf("block %d: unknown version %d of contract %s", sb.Index, version, contractID)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyReplayLink checks that the level-0 forward link of prev points to
+// sb and is signed by the roster of prev.
+func verifyReplayLink(prev, sb *skipchain.SkipBlock) error {
+	if prev.Index+1 != sb.Index {
+		return errors.New("blocks are not consecutive")
+	}
+	if !sb.SkipChainID().Equal(prev.SkipChainID()) {
+		return errors.New("block is from another chain")
+	}
+	if len(prev.ForwardLink) == 0 {
+		return errors.New("previous block has no forward link")
+	}
+	fl := prev.ForwardLink[0]
+	if !fl.From.Equal(prev.Hash) || !fl.To.Equal(sb.Hash) {
+		return errors.New("forward link doesn't point to the block")
+	}
+	return fl.Verify(pairing.NewSuiteBn256(), prev.Roster.ServicePublics(skipchain.ServiceName))
+}
@@ -0,0 +1,127 @@
+package byzcoin
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ReplayChain(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	for i := 0; i < 2; i++ {
+		tx, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, uint64(i+1))
+		require.NoError(t, err)
+		s.sendTxAndWait(t, tx, 10)
+	}
+
+	blocks := s.chainBlocks(t)
+	require.True(t, len(blocks) >= 3)
+
+	var verified int
+	require.NoError(t, s.service().ReplayChain(blocks, func(*skipchain.SkipBlock) { verified++ }))
+	require.Equal(t, len(blocks), verified)
+
+	// A service without a conode replays the chain the same way.
+	replay := NewReplayService()
+	replay.registerContract(dummyContract, adaptor(dummyContractFunc))
+	require.NoError(t, replay.ReplayChain(blocks, nil))
+
+	// The genesis block is needed.
+	require.Error(t, s.service().ReplayChain(blocks[1:], nil))
+
+	// A block with a changed body doesn't verify.
+	last := blocks[len(blocks)-1].Copy()
+	last.Payload = append([]byte{}, blocks[1].Payload...)
+	blocks[len(blocks)-1] = last
+	require.Error(t, s.service().ReplayChain(blocks, nil))
+}
+
+func TestService_ReplayChainUpgrade(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	migrate := func(rst ReadOnlyStateTrie, id InstanceID, value []byte) ([]byte, error) {
+		return append(value, []byte("-v1")...), nil
+	}
+	for _, service := range s.services {
+		require.NoError(t, service.registerContractVersion(dummyContract, 1, adaptor(dummyContractFunc), migrate))
+	}
+
+	tx, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, 1)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	dummyID := NewInstanceID(tx.Instructions[0].Hash())
+
+	// The upgrade is activated two blocks after the one of the
+	// instruction, and more blocks are added to reach it.
+	blocks := s.chainBlocks(t)
+	block := uint64(blocks[len(blocks)-1].Index + 3)
+	vBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(vBuf, 1)
+	bBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bBuf, block)
+	upgrade, err := combineInstrsAndSign(s.signer, Instruction{
+		InstanceID: ConfigInstanceID,
+		Invoke: &Invoke{
+			Command: CmdConfigUpgradeContract,
+			Args: Arguments{
+				{Name: "contract_id", Value: []byte(dummyContract)},
+				{Name: "version", Value: vBuf},
+				{Name: "block", Value: bBuf},
+			},
+		},
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	s.sendTxAndWait(t, upgrade, 10)
+	for i := 0; i < 3; i++ {
+		tx, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, uint64(i+3))
+		require.NoError(t, err)
+		s.sendTxAndWait(t, tx, 10)
+	}
+	blocks = s.chainBlocks(t)
+	require.True(t, uint64(blocks[len(blocks)-1].Index) >= block)
+
+	st, err := s.service().GetReadOnlyStateTrie(s.genesis.SkipChainID())
+	require.NoError(t, err)
+	val, _, _, _, err := st.GetValues(dummyID.Slice())
+	require.NoError(t, err)
+	require.Equal(t, string(s.value)+"-v1", string(val))
+
+	require.NoError(t, s.service().ReplayChain(blocks, nil))
+
+	// The replay stops before the first block if a contract or one of its
+	// versions is unknown.
+	replay := NewReplayService()
+	err = replay.ReplayChain(blocks, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown contract "+dummyContract)
+	replay.registerContract(dummyContract, adaptor(dummyContractFunc))
+	err = replay.ReplayChain(blocks, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown version 1 of contract "+dummyContract)
+
+	replay.registerContractVersion(dummyContract, 1, adaptor(dummyContractFunc), migrate)
+	var verified int
+	require.NoError(t, replay.ReplayChain(blocks, func(*skipchain.SkipBlock) { verified++ }))
+	require.Equal(t, len(blocks), verified)
+}
+
+// chainBlocks returns all the blocks of the chain, from the genesis block.
+func (s *ser) chainBlocks(t *testing.T) []*skipchain.SkipBlock {
+	var blocks []*skipchain.SkipBlock
+	sb := s.service().db().GetByID(s.genesis.Hash)
+	for {
+		blocks = append(blocks, sb)
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		sb = s.service().db().GetByID(sb.ForwardLink[0].To)
+		require.NotNil(t, sb)
+	}
+	return blocks
+}
@@ -1,6 +1,7 @@
 package byzcoin
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -9,6 +10,201 @@ import (
 	"github.com/dedis/cothority/darc"
 )
 
+// ReplayProtection selects how a chain protects itself against instructions
+// that are submitted more than once. It is stored in the ChainConfig.
+type ReplayProtection int
+
+const (
+	// ReplaySignerCounters requires every signer to give the next value of
+	// its counter, see ReplayGuard.md. This is the default.
+	ReplaySignerCounters ReplayProtection = iota
+	// ReplayNonce requires every instruction to have a random nonce and an
+	// expiry block index. The nonce is recorded in the trie until the
+	// expiry, so the instruction cannot be executed again.
+	ReplayNonce
+)
+
+// NonceLength is the length of the nonce of an instruction when the chain
+// uses ReplayNonce.
+const NonceLength = 32
+
+// nonceGCStep is the maximum number of expired nonce buckets that are
+// removed by one instruction.
+const nonceGCStep = 16
+
+// replayGuard verifies that an instruction has not been executed before and
+// returns the state changes to record that it has been executed.
+type replayGuard interface {
+	verify(st ReadOnlyStateTrie, instr Instruction) error
+	update(st ReadOnlyStateTrie, instr Instruction) (StateChanges, error)
+}
+
+// getReplayGuard returns the replay guard given by the config in the trie.
+// If there is no config yet, which is the case for the genesis transaction,
+// the signer counters are used.
+func getReplayGuard(st ReadOnlyStateTrie) (replayGuard, error) {
+	config, err := loadConfigFromTrie(st)
+	if err == errKeyNotSet {
+		return counterGuard{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch config.ReplayProtection {
+	case ReplaySignerCounters:
+		return counterGuard{}, nil
+	case ReplayNonce:
+		return nonceGuard{maxExpiry: config.NonceMaxExpiry}, nil
+	default:
+		return nil, fmt.Errorf("unknown replay protection %d", config.ReplayProtection)
+	}
+}
+
+// updateReplayGuard returns the state changes that record the execution of
+// the instruction in the replay guard of the trie.
+func updateReplayGuard(st ReadOnlyStateTrie, instr Instruction) (StateChanges, error) {
+	guard, err := getReplayGuard(st)
+	if err != nil {
+		return nil, err
+	}
+	return guard.update(st, instr)
+}
+
+// counterGuard uses the signer counters.
+type counterGuard struct{}
+
+func (counterGuard) verify(st ReadOnlyStateTrie, instr Instruction) error {
+	if len(instr.Nonce) > 0 {
+		return errors.New("chain uses signer counters, not nonces")
+	}
+	return verifySignerCounters(st, instr.SignerCounter, instr.Signatures)
+}
+
+func (counterGuard) update(st ReadOnlyStateTrie, instr Instruction) (StateChanges, error) {
+	return incrementSignerCounters(st, instr.Signatures)
+}
+
+// nonceGuard records the nonce of every instruction in a bucket of the trie
+// given by the expiry of the instruction. The buckets are removed once they
+// are expired.
+type nonceGuard struct {
+	maxExpiry uint64
+}
+
+func (g nonceGuard) verify(st ReadOnlyStateTrie, instr Instruction) error {
+	if len(instr.SignerCounter) > 0 {
+		return errors.New("chain uses nonces, not signer counters")
+	}
+	for _, sig := range instr.Signatures {
+		if !sig.Signer.PrimaryIdentity() {
+			return errors.New("not a primary identity")
+		}
+	}
+	if len(instr.Nonce) != NonceLength {
+		return fmt.Errorf("nonce must be %d bytes", NonceLength)
+	}
+	// The instruction is executed in the block after the last one of the
+	// trie.
+	current := uint64(st.GetIndex() + 1)
+	if instr.Expiry < current {
+		return fmt.Errorf("instruction expired at block %d", instr.Expiry)
+	}
+	if instr.Expiry > current+g.maxExpiry {
+		return fmt.Errorf("expiry must be at most %d blocks ahead", g.maxExpiry)
+	}
+	bucket, err := getNonceBucket(st, instr.Expiry)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(bucket); i += NonceLength {
+		if bytes.Equal(bucket[i:i+NonceLength], instr.Nonce) {
+			return errors.New("nonce has already been used")
+		}
+	}
+	return nil
+}
+
+func (g nonceGuard) update(st ReadOnlyStateTrie, instr Instruction) (StateChanges, error) {
+	bucket, err := getNonceBucket(st, instr.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	scs := StateChanges{guardStateChange(st, nonceBucketKey(instr.Expiry),
+		append(bucket, instr.Nonce...))}
+
+	// Remove the buckets that expired since the last instruction.
+	gcBuf, _, _, _, err := st.GetValues(nonceGCKey())
+	var gc uint64
+	if err == nil {
+		gc = binary.LittleEndian.Uint64(gcBuf)
+	} else if err != errKeyNotSet {
+		return nil, err
+	}
+	current := uint64(st.GetIndex() + 1)
+	next := gc
+	for ; next < current && next < gc+nonceGCStep; next++ {
+		key := nonceBucketKey(next)
+		_, _, _, _, err = st.GetValues(key)
+		if err == errKeyNotSet {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scs = append(scs, StateChange{
+			StateAction: Remove,
+			InstanceID:  key,
+			ContractID:  []byte{},
+			DarcID:      darc.ID([]byte{}),
+		})
+	}
+	if next != gc {
+		nextBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(nextBuf, next)
+		scs = append(scs, guardStateChange(st, nonceGCKey(), nextBuf))
+	}
+	return scs, nil
+}
+
+// getNonceBucket returns the nonces that expire at the given block index.
+func getNonceBucket(st ReadOnlyStateTrie, expiry uint64) ([]byte, error) {
+	val, _, _, _, err := st.GetValues(nonceBucketKey(expiry))
+	if err == errKeyNotSet {
+		return nil, nil
+	}
+	return val, err
+}
+
+// guardStateChange creates or updates the key without contract.
+func guardStateChange(st ReadOnlyStateTrie, key []byte, value []byte) StateChange {
+	sc := StateChange{
+		StateAction: Create,
+		InstanceID:  key,
+		ContractID:  []byte{},
+		Value:       value,
+		DarcID:      darc.ID([]byte{}),
+	}
+	if _, ver, _, _, err := st.GetValues(key); err == nil {
+		sc.StateAction = Update
+		sc.Version = ver + 1
+	}
+	return sc
+}
+
+func nonceBucketKey(expiry uint64) []byte {
+	h := sha256.New()
+	h.Write([]byte("noncebucket_"))
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, expiry)
+	h.Write(buf)
+	return h.Sum(nil)
+}
+
+func nonceGCKey() []byte {
+	h := sha256.Sum256([]byte("noncegc"))
+	return h[:]
+}
+
 // getSignerCounter returns 0 if the key is not set, otherwise it loads the
 // counter from the Trie.
 func getSignerCounter(st ReadOnlyStateTrie, id string) (uint64, error) {
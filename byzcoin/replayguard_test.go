@@ -41,3 +41,54 @@ func TestReplayGuard(t *testing.T) {
 	err = verifySignerCounters(sst, []uint64{3, 3}, sigs)
 	require.NoError(t, err)
 }
+
+func TestReplayGuard_Nonce(t *testing.T) {
+	sst, err := newMemStagingStateTrie([]byte("my nonce"))
+	require.NoError(t, err)
+	signer := darc.NewSignerEd25519(nil, nil)
+
+	// Without config, the signer counters are used.
+	guard, err := getReplayGuard(sst)
+	require.NoError(t, err)
+	require.Equal(t, counterGuard{}, guard)
+
+	guard = nonceGuard{maxExpiry: 10}
+	instr := Instruction{
+		Signatures: []darc.Signature{{Signer: signer.Identity()}},
+	}
+	instr.SetNonce(5)
+	require.NoError(t, guard.verify(sst, instr))
+	require.Error(t, counterGuard{}.verify(sst, instr))
+
+	sc, err := guard.update(sst, instr)
+	require.NoError(t, err)
+	require.NoError(t, sst.StoreAll(sc))
+	require.Error(t, guard.verify(sst, instr))
+
+	// Counters are not accepted.
+	instr.SetNonce(5)
+	require.NoError(t, guard.verify(sst, instr))
+	instr.SignerCounter = []uint64{1}
+	require.Error(t, guard.verify(sst, instr))
+
+	// The expiry is too far.
+	instr.SetNonce(20)
+	require.Error(t, guard.verify(sst, instr))
+
+	// Once the instruction expired, its bucket is removed by the next
+	// instruction.
+	sst.index = 10
+	instr.SetNonce(5)
+	require.Error(t, guard.verify(sst, instr))
+	instr.SetNonce(15)
+	require.NoError(t, guard.verify(sst, instr))
+	sc, err = guard.update(sst, instr)
+	require.NoError(t, err)
+	require.NoError(t, sst.StoreAll(sc))
+	bucket, err := getNonceBucket(sst, 5)
+	require.NoError(t, err)
+	require.Nil(t, bucket)
+	bucket, err = getNonceBucket(sst, 15)
+	require.NoError(t, err)
+	require.Equal(t, instr.Nonce, bucket)
+}
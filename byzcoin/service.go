@@ -106,6 +106,8 @@ type Service struct {
 	// store transactions. But there is more management overhead, e.g.,
 	// restarting after shutdown, answer getTxs requests and so on.
 	txBuffer txBuffer
+	// txForwarder keeps track of the transactions sent to the leader.
+	txForwarder txForwarder
 
 	heartbeats             heartbeats
 	heartbeatsTimeout      chan string
@@ -113,6 +115,9 @@ type Service struct {
 
 	// contracts map kinds to kind specific verification functions
 	contracts map[string]ContractFn
+	// contractVersions holds the versions of the contracts registered
+	// with RegisterContractVersion.
+	contractVersions map[string]map[uint32]contractVersion
 
 	storage *bcStorage
 
@@ -132,6 +137,9 @@ type Service struct {
 
 	updateCollectionLock sync.Mutex
 	catchingUp           bool
+	// trieUpdated is closed and replaced every time the state trie has
+	// been updated. It is protected by updateCollectionLock.
+	trieUpdated chan struct{}
 
 	downloadState downloadState
 }
@@ -154,6 +162,10 @@ const defaultInterval = 5 * time.Second
 // defaultMaxBlockSize is used when the config cannot be loaded.
 const defaultMaxBlockSize = 4 * 1e6
 
+// defaultNonceMaxExpiry is used if the genesis transaction selects
+// ReplayNonce without setting NonceMaxExpiry.
+const defaultNonceMaxExpiry = 1000
+
 // bcStorage is used to save our data locally.
 type bcStorage struct {
 	// PropTimeout is used when sending the request to integrate a new block
@@ -204,6 +216,14 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 	bsBuf := make([]byte, 8)
 	binary.PutVarint(bsBuf, int64(req.MaxBlockSize))
 
+	if req.ReplayProtection == ReplayNonce && req.NonceMaxExpiry == 0 {
+		req.NonceMaxExpiry = defaultNonceMaxExpiry
+	}
+	rpBuf := make([]byte, 8)
+	binary.PutVarint(rpBuf, int64(req.ReplayProtection))
+	expiryBuf := make([]byte, 8)
+	binary.PutUvarint(expiryBuf, req.NonceMaxExpiry)
+
 	rosterBuf, err := protobuf.Encode(&req.Roster)
 	if err != nil {
 		return nil, err
@@ -219,6 +239,8 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 			{Name: "block_interval", Value: intervalBuf},
 			{Name: "max_block_size", Value: bsBuf},
 			{Name: "roster", Value: rosterBuf},
+			{Name: "replay_protection", Value: rpBuf},
+			{Name: "nonce_max_expiry", Value: expiryBuf},
 			{Name: "trie_nonce", Value: nonce[:]},
 		},
 	}
@@ -232,7 +254,7 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 		}},
 	}
 
-	sb, err := s.createNewBlock(nil, &req.Roster, NewTxResults(ctx))
+	sb, err := s.createNewBlock(nil, &req.Roster, NewTxResults(ctx), time.Now().UnixNano())
 	if err != nil {
 		return nil, err
 	}
@@ -289,7 +311,11 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	// be created and (not) notified before the wait channel is created. Moving
 	// add() after createWaitChannel() solves this, but then we need a second add() for the
 	// no inclusion wait case.
+	//
+	// The transaction is forwarded to the leader, so that we can return its
+	// acknowledgement to the client.
 
+	var ack *TxAck
 	if req.InclusionWait > 0 {
 		// Wait for InclusionWait new blocks and look if our transaction is in it.
 		interval, _, err := s.LoadBlockInfo(req.SkipchainID)
@@ -305,7 +331,7 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 		z := s.notifications.registerForBlocks(blockCh)
 		defer s.notifications.unregisterForBlocks(z)
 
-		s.txBuffer.add(string(req.SkipchainID), req.Transaction)
+		ack = s.addTx(req.SkipchainID, req.Transaction)
 
 		// In case we don't have any blocks, because there are no transactions,
 		// have a hard timeout in twice the minimal expected time to create the
@@ -334,11 +360,12 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 			}
 		}
 	} else {
-		s.txBuffer.add(string(req.SkipchainID), req.Transaction)
+		ack = s.addTx(req.SkipchainID, req.Transaction)
 	}
 
 	return &AddTxResponse{
 		Version: CurrentVersion,
+		Ack:     ack,
 	}, nil
 }
 
@@ -419,12 +446,24 @@ func (s *Service) CheckAuthorization(req *CheckAuthorization) (resp *CheckAuthor
 	for _, i := range req.Identities {
 		ids = append(ids, i.String())
 	}
+	// The delegations are checked against the height of the next block,
+	// like the instructions of the next transaction in darcContext.
+	ctx := &darc.Context{Height: uint64(st.GetIndex() + 1), Darc: d}
+	if ts := st.GetTimestamp(); ts != 0 {
+		ctx.Time = time.Unix(0, ts)
+	}
 	for _, r := range d.Rules.List {
-		err = darc.EvalExprDarc(r.Expr, getDarcs, true, ids...)
+		_, err = darc.EvalExprTrace(r.Expr, getDarcs, true, ctx, ids...)
 		if err == nil {
 			resp.Actions = append(resp.Actions, r.Action)
 		}
 	}
+	if req.Explain != "" {
+		if !d.Rules.Contains(req.Explain) {
+			return nil, fmt.Errorf("action '%s' does not exist", req.Explain)
+		}
+		resp.Trace, _ = darc.EvalExprTrace(d.Rules.Get(req.Explain), getDarcs, true, ctx, ids...)
+	}
 	return resp, nil
 }
 
@@ -608,6 +647,97 @@ func (s *Service) CheckStateChangeValidity(req *CheckStateChangeValidity) (*Chec
 	}, nil
 }
 
+// GetViewChangeStatus returns the state of the view-change controller of this
+// node: the current view, the requests received for the pending views and the
+// reason of the last failed view-change.
+func (s *Service) GetViewChangeStatus(req *GetViewChangeStatus) (*GetViewChangeStatusResponse, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, errors.New("unknown byzcoin ID")
+	}
+	latest, err := s.db().GetLatestByID(req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	status, ok := s.viewChangeMan.status(req.ByzCoinID)
+	if !ok {
+		return nil, errors.New("view-change monitor is not running for this chain")
+	}
+
+	resp := &GetViewChangeStatusResponse{
+		CurrentView: ViewStatus{LatestID: latest.Hash},
+		LastFailure: s.viewChangeMan.lastFailure(req.ByzCoinID),
+	}
+	for _, l := range status.Logs {
+		vs := ViewStatus{
+			LatestID:     l.View.ID,
+			LeaderIndex:  l.View.LeaderIndex,
+			TimerStarted: l.TimerStarted,
+		}
+		for _, r := range l.Requests {
+			vs.Signers = append(vs.Signers, append([]byte{}, r.SignerID[:]...))
+		}
+		if l.View.LeaderIndex == status.Ctr {
+			resp.CurrentView = vs
+		}
+		resp.Pending = append(resp.Pending, vs)
+	}
+	return resp, nil
+}
+
+// RequestViewChange starts a view-change on this node if the request is
+// signed by an identity allowed to invoke a view-change in the genesis darc.
+// The node sends its view-change request to the other nodes, but these will
+// only follow if they also receive the request or detect a failure
+// themselves.
+func (s *Service) RequestViewChange(req *RequestViewChange) (*RequestViewChangeResponse, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, errors.New("unknown byzcoin ID")
+	}
+	latest, err := s.db().GetLatestByID(req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	if !latest.Hash.Equal(req.LatestID) {
+		return nil, errors.New("request is not for the latest block")
+	}
+	if i, _ := latest.Roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("refusing view-change for a chain we're not part of")
+	}
+	if req.LeaderIndex < 1 || req.LeaderIndex >= len(latest.Roster.List) {
+		return nil, fmt.Errorf("leader index must be between 1 and %d", len(latest.Roster.List)-1)
+	}
+
+	if err := req.Signature.Signer.Verify(req.Hash(), req.Signature.Signature); err != nil {
+		return nil, errors.New("invalid signature: " + err.Error())
+	}
+	st, err := s.GetReadOnlyStateTrie(req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := getInstanceDarc(st, ConfigInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	expr := d.Rules.Get(darc.Action("invoke:view_change"))
+	if err := darc.EvalExprForDarc(expr, d, darcGetter(st), false, req.Signature.Signer.String()); err != nil {
+		return nil, errors.New("signer is not allowed to request a view-change: " + err.Error())
+	}
+
+	if !s.viewChangeMan.started(req.ByzCoinID) {
+		return nil, errors.New("view-change monitor is not running for this chain")
+	}
+	log.Lvlf2("%s view-change to leader %d requested by %s", s.ServerIdentity(), req.LeaderIndex, req.Signature.Signer)
+	s.viewChangeMan.addReq(viewchange.InitReq{
+		SignerID: s.ServerIdentity().ID,
+		View: viewchange.View{
+			ID:          latest.Hash,
+			Gen:         req.ByzCoinID,
+			LeaderIndex: req.LeaderIndex,
+		},
+	})
+	return &RequestViewChangeResponse{}, nil
+}
+
 // SetPropagationTimeout overrides the default propagation timeout that is used
 // when a new block is announced to the nodes as well as the skipchain
 // propagation timeout.
@@ -623,7 +753,7 @@ func (s *Service) SetPropagationTimeout(p time.Duration) {
 // skipchain-service. Once the block has been created, we
 // inform all nodes to update their internal trie
 // to include the new transactions.
-func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx []TxResult) (*skipchain.SkipBlock, error) {
+func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx []TxResult, timestamp int64) (*skipchain.SkipBlock, error) {
 	var sb *skipchain.SkipBlock
 	var mr []byte
 	var sst *stagingStateTrie
@@ -669,6 +799,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		}
 		sst = st.MakeStagingStateTrie()
 	}
+	sst.timestamp = timestamp
 
 	// Create header of skipblock containing only hashes
 	var scs StateChanges
@@ -692,7 +823,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		TrieRoot:              mr,
 		ClientTransactionHash: txRes.Hash(),
 		StateChangesHash:      scs.Hash(),
-		Timestamp:             time.Now().UnixNano(),
+		Timestamp:             timestamp,
 	}
 	sb.Data, err = protobuf.Encode(header)
 	if err != nil {
@@ -901,6 +1032,7 @@ func (s *Service) catchUp(sb *skipchain.SkipBlock) {
 func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 	s.updateCollectionLock.Lock()
 	defer s.updateCollectionLock.Unlock()
+	defer s.notifyTrieUpdated()
 
 	s.closedMutex.Lock()
 	defer s.closedMutex.Unlock()
@@ -997,11 +1129,13 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 	}
 
 	log.Lvlf2("%s Updating transactions for %x on index %v", s.ServerIdentity(), sb.SkipChainID(), sb.Index)
-	_, _, scs, _ := s.createStateChanges(st.MakeStagingStateTrie(), sb.SkipChainID(), body.TxResults, noTimeout)
+	sst := st.MakeStagingStateTrie()
+	sst.timestamp = header.Timestamp
+	_, _, scs, _ := s.createStateChanges(sst, sb.SkipChainID(), body.TxResults, noTimeout)
 
 	log.Lvlf3("%s Storing index %d with %d state changes %v", s.ServerIdentity(), sb.Index, len(scs), scs.ShortStrings())
 	// Update our global state using all state changes.
-	if err = st.StoreAll(scs, sb.Index); err != nil {
+	if err = st.StoreAll(scs, sb.Index, header.Timestamp); err != nil {
 		return err
 	}
 	if !bytes.Equal(st.GetRoot(), header.TrieRoot) {
@@ -1019,6 +1153,7 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 	// Notify all waiting channels for processed ClientTransactions.
 	for _, t := range body.TxResults {
 		s.notifications.informWaitChannel(t.ClientTransaction.Instructions.Hash(), t.Accepted)
+		s.txForwarder.included(sb.SkipChainID(), t.ClientTransaction.Instructions.Hash())
 	}
 	s.notifications.informBlock(sb.SkipChainID())
 
@@ -1090,6 +1225,9 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 			view := isViewChangeTx(body.TxResults)
 			if view != nil {
 				s.viewChangeMan.done(*view)
+				// The old leader might have lost the transactions
+				// we sent to it.
+				go s.retryForwardedTxs(sb.SkipChainID())
 			}
 		} else {
 			// Start viewchange monitor that will fire if we don't get updates in time.
@@ -1253,6 +1391,95 @@ func (s *Service) LoadBlockInfo(scID skipchain.SkipBlockID) (time.Duration, int,
 	return config.BlockInterval, config.MaxBlockSize, nil
 }
 
+// pendingBlock is a block that has been proposed by the leader, but which is
+// not yet stored in the skipchain. While it is being signed, the leader
+// computes the next block on top of its state.
+type pendingBlock struct {
+	// index is the expected index of the block.
+	index int
+	// txs are the transactions of the block, they are put back in the
+	// queue if the block cannot be created.
+	txs []ClientTransaction
+	// sst holds the state after applying the block.
+	sst *stagingStateTrie
+	// done returns the result of the block creation.
+	done chan error
+}
+
+// proposeBlock starts the creation of a new block in the background and
+// returns immediately.
+func (s *Service) proposeBlock(scID skipchain.SkipBlockID, index int, r *onet.Roster, txOut TxResults, sst *stagingStateTrie) *pendingBlock {
+	pb := &pendingBlock{
+		index: index,
+		sst:   sst,
+		done:  make(chan error, 1),
+	}
+	for _, tx := range txOut {
+		pb.txs = append(pb.txs, tx.ClientTransaction)
+	}
+	go func() {
+		_, err := s.createNewBlock(scID, r, txOut, sst.timestamp)
+		pb.done <- err
+	}()
+	return pb
+}
+
+// stagingStateTrieFor returns the staging trie on which the next block
+// must be computed. If there is a pending block, this is the state after
+// the pending block, unless it has been stored in the meantime. The caller
+// must hold updateCollectionLock, so that the pending block is not stored
+// between the check of the index and the choice of the trie.
+func (s *Service) stagingStateTrieFor(scID skipchain.SkipBlockID, pending *pendingBlock) (*stagingStateTrie, error) {
+	st, err := s.getStateTrie(scID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil && st.GetIndex() < pending.index {
+		sst := pending.sst.Clone()
+		sst.index = pending.index
+		return sst, nil
+	}
+	return st.MakeStagingStateTrie(), nil
+}
+
+// waitTrieIndex waits until the state trie has been updated with the block
+// at the given index.
+func (s *Service) waitTrieIndex(scID skipchain.SkipBlockID, index int, timeout time.Duration) error {
+	st, err := s.getStateTrie(scID)
+	if err != nil {
+		return err
+	}
+	deadline := time.After(timeout)
+	for {
+		s.updateCollectionLock.Lock()
+		current := st.GetIndex()
+		updated := s.trieUpdated
+		s.updateCollectionLock.Unlock()
+		if current >= index {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-deadline:
+			return fmt.Errorf("trie didn't reach index %d after %v", index, timeout)
+		}
+	}
+}
+
+// notifyTrieUpdated wakes up the callers of waitTrieIndex. The caller must
+// hold updateCollectionLock.
+func (s *Service) notifyTrieUpdated() {
+	close(s.trieUpdated)
+	s.trieUpdated = make(chan struct{})
+}
+
+// startPolling starts the go-routine of the leader that creates new blocks.
+// The block production is pipelined: once a block is proposed, the leader
+// goes on collecting transactions and computes the next block on top of the
+// state of the proposed block while it is being signed. The next block is
+// proposed as soon as the previous one is stored. If the previous block
+// fails, the next block is thrown away and the transactions of both blocks
+// are put back in the queue.
 func (s *Service) startPolling(scID skipchain.SkipBlockID) chan bool {
 	s.pollChanWG.Add(1)
 	closeSignal := make(chan bool)
@@ -1267,6 +1494,13 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID) chan bool {
 		defer s.working.Done()
 		s.closedMutex.Unlock()
 		var txs []ClientTransaction
+		var pending *pendingBlock
+		defer func() {
+			// Don't leave a block creation behind when stopping.
+			if pending != nil {
+				<-pending.done
+			}
+		}()
 		for {
 			bcConfig, err := s.LoadConfig(scID)
 			if err != nil {
@@ -1346,6 +1580,24 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID) chan bool {
 
 				log.Lvl3("Collected all new transactions:", len(txs))
 
+				// If the pending block is already finished, we don't
+				// need to pipeline.
+				if pending != nil {
+					select {
+					case err := <-pending.done:
+						if err == nil {
+							err = s.waitTrieIndex(scID, pending.index, bcConfig.BlockInterval)
+						}
+						if err != nil {
+							log.Warnf("%s: block %d failed, putting back its %d transactions: %s",
+								s.ServerIdentity(), pending.index, len(pending.txs), err)
+							txs = append(pending.txs, txs...)
+						}
+						pending = nil
+					default:
+					}
+				}
+
 				if len(txs) == 0 {
 					log.Lvl3(s.ServerIdentity(), "no new transactions, not creating new block")
 					continue
@@ -1357,14 +1609,32 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID) chan bool {
 				}
 
 				// Pre-run transactions to look how many we can fit in the alloted time
-				// slot. Perhaps we can run this in parallel during the wait-phase?
+				// slot. If a block is still pending, the transactions are run on top
+				// of the state of the pending block. As the result is stored in the
+				// stateChangeCache, creating the block will not run them again.
+				//
+				// The lock is only held to choose the staging trie: if the
+				// pending block is stored during the pre-run, the trie gets
+				// the state changes the staging trie already holds. Any
+				// other update makes the block fail, and its transactions
+				// are put back in the queue.
 				log.Lvl3("Counting how many transactions fit in", bcConfig.BlockInterval/2)
 				then := time.Now()
-				st, err := s.getStateTrie(scID)
+				s.updateCollectionLock.Lock()
+				sst, err := s.stagingStateTrieFor(scID, pending)
 				if err != nil {
 					panic("the state trie must exist because we only start polling after creating/loading the skipchain")
 				}
-				_, txOut, _, sstTemp := s.createStateChanges(st.MakeStagingStateTrie(), scID, txIn, bcConfig.BlockInterval/2)
+				sstIndex := latest.Index
+				if st, err := s.getStateTrie(scID); err == nil {
+					sstIndex = st.GetIndex()
+				}
+				s.updateCollectionLock.Unlock()
+				// The transactions are run at the time of the block,
+				// which is the time of the pre-run.
+				timestamp := time.Now().UnixNano()
+				sst.timestamp = timestamp
+				_, txOut, states, sstTemp := s.createStateChanges(sst, scID, txIn, bcConfig.BlockInterval/2)
 				bcConfig, err = loadConfigFromTrie(sstTemp)
 				if err != nil {
 					panic("couldn't load config from temp stage Trie, this should never happen: " + err.Error())
@@ -1376,10 +1646,58 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID) chan bool {
 					log.Warnf("%d transactions (%v bytes) included in block in %v, %d transactions left for the next block", len(txOut), sz, time.Now().Sub(then), len(txs))
 				}
 
-				_, err = s.createNewBlock(scID, &bcConfig.Roster, txOut)
-				if err != nil {
-					log.Error(s.ServerIdentity(), "couldn't create new block: "+err.Error())
+				index := sstIndex + 1
+				if pending != nil {
+					// The new block can only be proposed once the
+					// pending one is stored.
+					select {
+					case err = <-pending.done:
+					case <-closeSignal:
+						log.Lvl2(s.ServerIdentity(), "abort pipelined block")
+						return
+					}
+					if err == nil {
+						err = s.waitTrieIndex(scID, pending.index, bcConfig.BlockInterval)
+					}
+					if err != nil {
+						// Roll back: the new block has been computed on the
+						// state of the failed block, so both are dropped.
+						log.Warnf("%s: block %d failed, dropping the next block and putting back the transactions: %s",
+							s.ServerIdentity(), pending.index, err)
+						var next []ClientTransaction
+						for _, tx := range txOut {
+							next = append(next, tx.ClientTransaction)
+						}
+						txs = append(append(pending.txs, next...), txs...)
+						pending = nil
+						continue
+					}
+					index = pending.index + 1
+					// sstTemp has been computed on a trie that has been
+					// updated in the meantime, so the state changes are
+					// applied again on top of the current trie.
+					s.updateCollectionLock.Lock()
+					sstTemp, err = s.stagingStateTrieFor(scID, nil)
+					if err == nil {
+						sstTemp.timestamp = timestamp
+						err = sstTemp.StoreAll(states)
+					}
+					s.updateCollectionLock.Unlock()
+					if err != nil {
+						// The pending block is stored, only the new one is
+						// dropped and its transactions are tried again.
+						log.Errorf("%s: couldn't apply the state changes of block %d on the updated trie, putting back the transactions: %s",
+							s.ServerIdentity(), index, err)
+						var next []ClientTransaction
+						for _, tx := range txOut {
+							next = append(next, tx.ClientTransaction)
+						}
+						txs = append(next, txs...)
+						pending = nil
+						continue
+					}
 				}
+				pending = s.proposeBlock(scID, index, &bcConfig.Roster, txOut, sstTemp)
 			}
 		}
 	}()
@@ -1455,6 +1773,7 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 		}
 		sst = st.MakeStagingStateTrie()
 	}
+	sst.timestamp = header.Timestamp
 	mtr, txOut, scs, _ := s.createStateChanges(sst, newSB.SkipChainID(), body.TxResults, noTimeout)
 
 	// Check that the locally generated list of accepted/rejected txs match the list
@@ -1555,23 +1874,50 @@ func (s *Service) createStateChanges(sst *stagingStateTrie, scID skipchain.SkipB
 	// If what we want is in the cache, then take it from there. Otherwise
 	// ignore the error and compute the state changes.
 	var err error
-	merkleRoot, txOut, states, err = s.stateChangeCache.get(scID, txIn.Hash())
+	baseRoot := sst.GetRoot()
+	merkleRoot, txOut, states, err = s.stateChangeCache.get(scID, baseRoot, sst.timestamp, txIn.Hash())
 	if err == nil {
 		log.Lvl3(s.ServerIdentity(), "loaded state changes from cache")
 		return
 	}
 	log.Lvl3(s.ServerIdentity(), "state changes from cache: MISS")
-	err = nil
 
+	merkleRoot, txOut, states, sstTemp = s.executeStateChanges(sst, scID, txIn, timeout)
+
+	// Store the result in the cache before returning. The merkle root is
+	// only set if all the transactions could be attempted.
+	if merkleRoot != nil && len(states) != 0 && len(txOut) != 0 {
+		s.stateChangeCache.update(scID, baseRoot, sst.timestamp, txOut.Hash(), merkleRoot, txOut, states)
+	}
+	return
+}
+
+// executeStateChanges does the work of createStateChanges without the
+// cache: every transaction is executed. The merkle root is nil if it stopped
+// before attempting all the transactions.
+func (s *Service) executeStateChanges(sst *stagingStateTrie, scID skipchain.SkipBlockID, txIn TxResults, timeout time.Duration) (merkleRoot []byte, txOut TxResults, states StateChanges, sstTemp *stagingStateTrie) {
+	var err error
+	// The size of the blocks is only needed to stop when the block is full,
+	// which is only done with a timeout.
 	var maxsz, blocksz int
-	_, maxsz, err = s.LoadBlockInfo(scID)
-	// no error or expected noCollection err, so keep going with the
-	// maxsz we got.
-	err = nil
+	if timeout != noTimeout {
+		_, maxsz, err = s.LoadBlockInfo(scID)
+		// no error or expected noCollection err, so keep going with the
+		// maxsz we got.
+		err = nil
+	}
 
 	deadline := time.Now().Add(timeout)
 
 	sstTemp = sst.Clone()
+	// The contract upgrades activated by this block are done before its
+	// transactions.
+	states, err = s.upgradeContracts(sstTemp)
+	if err != nil {
+		log.Errorf("%s couldn't upgrade the contracts: %s", s.logID(), err)
+		sstTemp = sst.Clone()
+		states = nil
+	}
 	var cin []Coin
 clientTransactions:
 	for _, tx := range txIn {
@@ -1585,18 +1931,26 @@ clientTransactions:
 		for _, instr := range tx.ClientTransaction.Instructions {
 			scs, cout, err := s.executeInstruction(sstTempC, cin, instr, h)
 			if err != nil {
-				log.Errorf("%s Call to contract returned error: %s", s.ServerIdentity(), err)
+				log.Errorf("%s Call to contract returned error: %s", s.logID(), err)
 				tx.Accepted = false
 				txOut = append(txOut, tx)
 				continue clientTransactions
 			}
 			var counterScs StateChanges
-			if counterScs, err = incrementSignerCounters(sstTempC, instr.Signatures); err != nil {
-				log.Errorf("%s failed to update signature counters: %s", s.ServerIdentity(), err)
+			if counterScs, err = updateReplayGuard(sstTempC, instr); err != nil {
+				log.Errorf("%s failed to update signature counters: %s", s.logID(), err)
+				tx.Accepted = false
+				txOut = append(txOut, tx)
+				continue clientTransactions
+			}
+			var usageScs StateChanges
+			if usageScs, err = updateActionUsage(sstTempC, instr); err != nil {
+				log.Errorf("%s failed to update the uses of the action: %s", s.logID(), err)
 				tx.Accepted = false
 				txOut = append(txOut, tx)
 				continue clientTransactions
 			}
+			counterScs = append(counterScs, usageScs...)
 
 			// Verify the validity of the state-changes:
 			//  - refuse to update non-existing instances
@@ -1623,20 +1977,20 @@ clientTransactions:
 					tx.Accepted = false
 					txOut = append(txOut, tx)
 					if err != nil {
-						log.Errorf("%s StoreAll failed: %s", s.ServerIdentity(), err)
+						log.Errorf("%s StoreAll failed: %s", s.logID(), err)
 					} else {
 						_, _, contractID, _, err := sstTempC.GetValues(instr.InstanceID.Slice())
 						if err != nil {
-							log.Errorf("%s couldn't get contractID from instruction %+v", s.ServerIdentity(),
+							log.Errorf("%s couldn't get contractID from instruction %+v", s.logID(),
 								instr)
 						}
-						log.Errorf("%s: contract %s %s", s.ServerIdentity(), contractID, reason)
+						log.Errorf("%s: contract %s %s", s.logID(), contractID, reason)
 					}
 					continue clientTransactions
 				}
 			}
 			if err = sstTempC.StoreAll(counterScs); err != nil {
-				log.Errorf("%s StoreAll failed to add counter changes: %s", s.ServerIdentity(), err)
+				log.Errorf("%s StoreAll failed to add counter changes: %s", s.logID(), err)
 				tx.Accepted = false
 				txOut = append(txOut, tx)
 				continue clientTransactions
@@ -1652,7 +2006,7 @@ clientTransactions:
 		// one way or the other.
 		// TODO: In issue #1409, we will refactor things such that we can drop transactions in here.
 		//if txsz > maxsz {
-		//	log.Errorf("%s transaction size %v is bigger than one block (%v), dropping it.", s.ServerIdentity(), txsz, maxsz)
+		//	log.Errorf("%s transaction size %v is bigger than one block (%v), dropping it.", s.logID(), txsz, maxsz)
 		//	continue clientTransactions
 		//}
 
@@ -1680,11 +2034,7 @@ clientTransactions:
 		blocksz += txsz
 	}
 
-	// Store the result in the cache before returning.
 	merkleRoot = sstTemp.GetRoot()
-	if len(states) != 0 && len(txOut) != 0 {
-		s.stateChangeCache.update(scID, txOut.Hash(), merkleRoot, txOut, states)
-	}
 	return
 }
 
@@ -1701,7 +2051,7 @@ func (s *Service) executeInstruction(st ReadOnlyStateTrie, cin []Coin, instr Ins
 		return
 	}
 
-	contractFactory, exists := s.contracts[contractID]
+	contractFactory, exists := s.getContractFn(st, contractID)
 	if !exists && ConfigInstanceID.Equal(instr.InstanceID) {
 		// Special case: first time call to genesis-configuration must return
 		// correct contract type.
@@ -1715,7 +2065,7 @@ func (s *Service) executeInstruction(st ReadOnlyStateTrie, cin []Coin, instr Ins
 		return
 	}
 	// Now we call the contract function with the data of the key.
-	log.Lvlf3("%s Calling contract '%s'", s.ServerIdentity(), contractID)
+	log.Lvlf3("%s Calling contract '%s'", s.logID(), contractID)
 
 	c, err := contractFactory(contents)
 	if err != nil {
@@ -1914,6 +2264,16 @@ func (s *Service) monitorLeaderFailure() {
 	}()
 }
 
+// logID identifies the service in the logs of the execution of the
+// transactions. A service that is not attached to a conode, like the one of
+// NewReplayService, has no server identity.
+func (s *Service) logID() string {
+	if s.ServiceProcessor == nil {
+		return "replay"
+	}
+	return s.ServerIdentity().String()
+}
+
 // registerContract stores the contract in a map and will
 // call it whenever a contract needs to be done.
 func (s *Service) registerContract(contractID string, c ContractFn) error {
@@ -2129,6 +2489,24 @@ func (s *Service) buildStateChanges(sid skipchain.SkipBlockID, sst *stagingState
 	if err != nil {
 		return nil, err
 	}
+	// The instructions of the block see the trie of the previous block,
+	// at the time of the block.
+	sst.index = sb.Index - 1
+	var header DataHeader
+	if err = protobuf.Decode(sb.Data, &header); err != nil {
+		return nil, err
+	}
+	sst.timestamp = header.Timestamp
+
+	upgradeScs, err := s.upgradeContracts(sst)
+	if err != nil {
+		return nil, err
+	}
+	if len(upgradeScs) > 0 {
+		if err = s.stateChangeStorage.append(upgradeScs, sb); err != nil {
+			return nil, err
+		}
+	}
 
 	// when an error occured, we stop where we are because those state changes
 	// should be generated without errors then something else went wrong
@@ -2144,10 +2522,15 @@ func (s *Service) buildStateChanges(sid skipchain.SkipBlockID, sst *stagingState
 				if err != nil {
 					return nil, err
 				}
-				counterScs, err := incrementSignerCounters(sst, instr.Signatures)
+				counterScs, err := updateReplayGuard(sst, instr)
+				if err != nil {
+					return nil, err
+				}
+				usageScs, err := updateActionUsage(sst, instr)
 				if err != nil {
 					return nil, err
 				}
+				counterScs = append(counterScs, usageScs...)
 
 				scs = append(scs, counterScs...)
 				err = sst.StoreAll(scs)
@@ -2155,7 +2538,9 @@ func (s *Service) buildStateChanges(sid skipchain.SkipBlockID, sst *stagingState
 					return nil, err
 				}
 
-				s.stateChangeStorage.append(scs, sb)
+				if err = s.stateChangeStorage.append(scs, sb); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -2178,10 +2563,13 @@ func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor:       onet.NewServiceProcessor(c),
 		contracts:              make(map[string]ContractFn),
+		contractVersions:       make(map[string]map[uint32]contractVersion),
 		txBuffer:               newTxBuffer(),
+		txForwarder:            newTxForwarder(),
 		storage:                &bcStorage{},
 		darcToSc:               make(map[string]skipchain.SkipBlockID),
 		stateChangeCache:       newStateChangeCache(),
+		trieUpdated:            make(chan struct{}),
 		stateChangeStorage:     newStateChangeStorage(c),
 		heartbeatsTimeout:      make(chan string, 1),
 		closeLeaderMonitorChan: make(chan bool, 1),
@@ -2200,7 +2588,9 @@ func newService(c *onet.Context) (onet.Service, error) {
 		s.GetInstanceVersion,
 		s.GetLastInstanceVersion,
 		s.GetAllInstanceVersion,
-		s.CheckStateChangeValidity)
+		s.CheckStateChangeValidity,
+		s.GetViewChangeStatus,
+		s.RequestViewChange)
 	if err != nil {
 		log.ErrFatal(err, "Couldn't register messages")
 	}
@@ -2209,9 +2599,12 @@ func newService(c *onet.Context) (onet.Service, error) {
 		log.ErrFatal(err, "Couldn't register streaming messages")
 	}
 	s.RegisterProcessorFunc(viewChangeMsgID, s.handleViewChangeReq)
+	s.RegisterProcessorFunc(forwardTxMsgID, s.handleForwardTx)
+	s.RegisterProcessorFunc(forwardTxAckMsgID, s.handleForwardTxAck)
 
-	s.registerContract(ContractConfigID, contractConfigFromBytes)
+	s.registerContract(ContractConfigID, s.contractConfigFromBytes)
 	s.registerContract(ContractDarcID, s.contractDarcFromBytes)
+	s.registerGlobalContracts()
 
 	skipchain.RegisterVerification(c, verifyByzCoin, s.verifySkipBlock)
 	if _, err := s.ProtocolRegister(collectTxProtocol, NewCollectTxProtocol(s.getTxs)); err != nil {
@@ -971,7 +971,7 @@ func TestService_StateChangeVerification(t *testing.T) {
 	require.Equal(t, 3, len(scs))
 	require.Equal(t, 1, len(txOut))
 	require.Equal(t, true, txOut[0].Accepted)
-	require.Nil(t, cdb.StoreAll(scs, 0))
+	require.Nil(t, cdb.StoreAll(scs, 0, 0))
 	_, txOut, scs, _ = s.service().createStateChanges(cdb.MakeStagingStateTrie(), s.genesis.SkipChainID(), NewTxResults(ClientTransaction{Instructions: Instructions{{
 		InstanceID: iid,
 		Spawn:      &Spawn{ContractID: cid},
@@ -1201,6 +1201,24 @@ func TestService_CheckAuthorization(t *testing.T) {
 	resp, err = s.service().CheckAuthorization(ca)
 	require.Nil(t, err)
 	require.Contains(t, resp.Actions, darc.Action("spawn:darc"))
+
+	log.Lvl1("Explain the delegation")
+	ca.Identities = []darc.Identity{darc.NewSignerEd25519(nil, nil).Identity()}
+	ca.Explain = "spawn:darc"
+	resp, err = s.service().CheckAuthorization(ca)
+	require.Nil(t, err)
+	require.NotNil(t, resp.Trace)
+	require.False(t, resp.Trace.Result)
+	require.Equal(t, s.darc.GetIdentityString(), resp.Trace.Failed)
+	require.Equal(t, 1, len(resp.Trace.Terms))
+	del := resp.Trace.Terms[0].Delegation
+	require.NotNil(t, del)
+	require.Equal(t, s.darc.GetBaseID(), del.BaseID)
+	require.Equal(t, s.signer.Identity().String(), del.Trace.Failed)
+
+	ca.Explain = "invoke:missing"
+	_, err = s.service().CheckAuthorization(ca)
+	require.NotNil(t, err)
 }
 
 func TestService_GetLeader(t *testing.T) {
@@ -1806,6 +1824,80 @@ func testViewChange(t *testing.T, nHosts, nFailures int, interval time.Duration)
 	log.Lvl1("Sent two tx")
 }
 
+// Sends transactions faster than the blocks can be signed, so that the leader
+// has to compute the next block on top of the one that is still pending.
+func TestService_PipelinedBlocks(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	var ids []InstanceID
+	for i := 0; i < 10; i++ {
+		tx, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, uint64(i+1))
+		require.NoError(t, err)
+		ids = append(ids, tx.Instructions[0].DeriveID(""))
+		s.sendTx(t, tx)
+		time.Sleep(s.interval / 2)
+	}
+
+	// The counters depend on each other, so every transaction can only
+	// be accepted if the blocks are computed on top of each other.
+	for _, id := range ids {
+		pr := s.waitProof(t, id)
+		require.True(t, pr.InclusionProof.Match(id.Slice()))
+	}
+}
+
+func TestService_RequestViewChange(t *testing.T) {
+	s := newSerN(t, 1, testInterval, 4, true)
+	defer s.local.CloseAll()
+
+	latest, err := s.service().db().GetLatestByID(s.genesis.SkipChainID())
+	require.NoError(t, err)
+	req := &RequestViewChange{
+		ByzCoinID:   s.genesis.SkipChainID(),
+		LatestID:    latest.Hash,
+		LeaderIndex: 1,
+	}
+
+	// The client is not allowed to request a view-change.
+	require.NoError(t, req.Sign(s.signer))
+	_, err = s.service().RequestViewChange(req)
+	require.Error(t, err)
+
+	// But the conodes are, thanks to the invoke:view_change rule.
+	signer := darc.NewSignerEd25519(s.services[0].ServerIdentity().Public, s.services[0].getPrivateKey())
+	// A request for an unknown leader must be refused.
+	req.LeaderIndex = len(s.roster.List)
+	require.NoError(t, req.Sign(signer))
+	_, err = s.service().RequestViewChange(req)
+	require.Error(t, err)
+
+	req.LeaderIndex = 1
+	require.NoError(t, req.Sign(signer))
+	for _, service := range s.services {
+		_, err = service.RequestViewChange(req)
+		require.NoError(t, err)
+	}
+
+	// Wait for the node at index 1 to become the leader.
+	var leader *network.ServerIdentity
+	for i := 0; i < 20; i++ {
+		leader, err = s.services[2].getLeader(s.genesis.SkipChainID())
+		require.NoError(t, err)
+		if leader.Equal(s.services[1].ServerIdentity()) {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+	require.True(t, leader.Equal(s.services[1].ServerIdentity()))
+
+	status, err := s.services[1].GetViewChangeStatus(&GetViewChangeStatus{
+		ByzCoinID: s.genesis.SkipChainID(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "", status.LastFailure)
+}
+
 func TestService_DarcToSc(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -2302,7 +2394,7 @@ func newSerN(t *testing.T, step int, interval time.Duration, n int, viewchange b
 	registerDummy(s.hosts)
 
 	genesisMsg, err := DefaultGenesisMsg(CurrentVersion, s.roster,
-		[]string{"spawn:dummy", "spawn:invalid", "spawn:panic", "spawn:darc", "invoke:update_config", "spawn:slow", "spawn:stateChangeCacheTest", "delete"}, s.signer.Identity())
+		[]string{"spawn:dummy", "spawn:invalid", "spawn:panic", "spawn:darc", "invoke:update_config", "spawn:slow", "spawn:stateChangeCacheTest", "delete", "invoke:upgrade_contract"}, s.signer.Identity())
 	require.Nil(t, err)
 	s.darc = &genesisMsg.GenesisDarc
 
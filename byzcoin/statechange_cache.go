@@ -8,19 +8,34 @@ import (
 	"github.com/dedis/cothority/skipchain"
 )
 
+// stateChangeCacheSize is the number of values kept per skipchain. We need
+// two of them because the leader computes the state changes of the next block
+// while the previous one is still being signed.
+const stateChangeCacheSize = 2
+
 // stateChangeCache is a simple struct that maintains a cache of state changes
-// keyed on the skipchain ID. It only keeps one value because state changes
-// should only happen at block interval boundaries. So we do not expect
-// interleaving state changes for the same skipchain. The advantage of this
-// approach is that we do not need to worry about deleting used cache because
-// the memory usage stays constant at one entry per Skipchain.
+// keyed on the skipchain ID. It only keeps a few values because state changes
+// should only happen at block interval boundaries. So we do not expect more
+// interleaving state changes for the same skipchain than the blocks that are
+// pipelined by the leader. The advantage of this approach is that we do not
+// need to worry about deleting used cache because the memory usage stays
+// constant at stateChangeCacheSize entries per Skipchain.
+//
+// Every value is stored together with the root of the trie on which the state
+// changes have been computed, so that state changes computed on top of a
+// block that is not yet stored are never used for another block. As the
+// instructions can depend on the time of the block, the timestamp of the trie
+// is stored too, so that transactions proposed again at another time are
+// executed again.
 type stateChangeCache struct {
 	sync.Mutex
-	cache map[string]*stateChangeValue
+	cache map[string][]*stateChangeValue
 }
 
 type stateChangeValue struct {
 	digest     []byte
+	baseRoot   []byte
+	timestamp  int64
 	merkleRoot []byte
 	txOut      []TxResult
 	states     StateChanges
@@ -28,38 +43,46 @@ type stateChangeValue struct {
 
 func newStateChangeCache() stateChangeCache {
 	return stateChangeCache{
-		cache: make(map[string]*stateChangeValue),
+		cache: make(map[string][]*stateChangeValue),
 	}
 }
 
-func (c *stateChangeCache) get(scID skipchain.SkipBlockID, digest []byte) (merkleRoot []byte, txOut TxResults, states StateChanges, err error) {
+func (c *stateChangeCache) get(scID skipchain.SkipBlockID, baseRoot []byte, timestamp int64, digest []byte) (merkleRoot []byte, txOut TxResults, states StateChanges, err error) {
 	c.Lock()
 	defer c.Unlock()
 	key := string(scID)
-	out, ok := c.cache[key]
+	values, ok := c.cache[key]
 	if !ok {
 		err = errors.New("key does not exist")
 		return
 	}
-	if !bytes.Equal(out.digest, digest) {
-		err = errors.New("digest is not the same")
-		return
+	for _, out := range values {
+		if bytes.Equal(out.digest, digest) && bytes.Equal(out.baseRoot, baseRoot) &&
+			out.timestamp == timestamp {
+			merkleRoot = out.merkleRoot
+			txOut = out.txOut
+			states = out.states
+			return
+		}
 	}
-
-	merkleRoot = out.merkleRoot
-	txOut = out.txOut
-	states = out.states
+	err = errors.New("digest is not the same")
 	return
 }
 
-func (c *stateChangeCache) update(scID skipchain.SkipBlockID, digest []byte, merkleRoot []byte, txOut TxResults, states StateChanges) {
+func (c *stateChangeCache) update(scID skipchain.SkipBlockID, baseRoot []byte, timestamp int64, digest []byte, merkleRoot []byte, txOut TxResults, states StateChanges) {
 	c.Lock()
 	defer c.Unlock()
 	key := string(scID)
-	c.cache[key] = &stateChangeValue{
+	values := append(c.cache[key], &stateChangeValue{
 		digest:     digest,
+		baseRoot:   baseRoot,
+		timestamp:  timestamp,
 		merkleRoot: merkleRoot,
 		txOut:      txOut,
 		states:     states,
+	})
+	if len(values) > stateChangeCacheSize {
+		values = values[len(values)-stateChangeCacheSize:]
 	}
+	c.cache[key] = values
 }
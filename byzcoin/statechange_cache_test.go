@@ -11,19 +11,50 @@ func TestStateChangeCache(t *testing.T) {
 	require.NotNil(t, cache.cache)
 
 	scID := []byte("scID")
+	base := []byte("base")
 	digest := []byte("digest")
 
-	_, _, _, err := cache.get(scID, digest)
+	_, _, _, err := cache.get(scID, base, 0, digest)
 	require.Error(t, err)
 
 	root := []byte("root")
 	txs := NewTxResults()
 	scs := StateChanges([]StateChange{})
-	cache.update(scID, digest, root, txs, scs)
+	cache.update(scID, base, 0, digest, root, txs, scs)
 
-	root1, txs1, scs1, err := cache.get(scID, digest)
+	root1, txs1, scs1, err := cache.get(scID, base, 0, digest)
 	require.NoError(t, err)
 	require.Equal(t, root, root1)
 	require.Equal(t, txs, txs1)
 	require.Equal(t, scs, scs1)
+
+	// The same transactions computed on another trie must not be found.
+	_, _, _, err = cache.get(scID, []byte("other base"), 0, digest)
+	require.Error(t, err)
+
+	// Nor the same transactions computed at another time.
+	_, _, _, err = cache.get(scID, base, 1, digest)
+	require.Error(t, err)
+}
+
+func TestStateChangeCache_Pipelined(t *testing.T) {
+	cache := newStateChangeCache()
+	scID := []byte("scID")
+
+	// The block being signed and the next one must both be available.
+	cache.update(scID, []byte("base1"), 0, []byte("digest1"), []byte("root1"), NewTxResults(), nil)
+	cache.update(scID, []byte("root1"), 0, []byte("digest2"), []byte("root2"), NewTxResults(), nil)
+	root, _, _, err := cache.get(scID, []byte("base1"), 0, []byte("digest1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("root1"), root)
+	root, _, _, err = cache.get(scID, []byte("root1"), 0, []byte("digest2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("root2"), root)
+
+	// A third value evicts the oldest one.
+	cache.update(scID, []byte("root2"), 0, []byte("digest3"), []byte("root3"), NewTxResults(), nil)
+	_, _, _, err = cache.get(scID, []byte("base1"), 0, []byte("digest1"))
+	require.Error(t, err)
+	_, _, _, err = cache.get(scID, []byte("root1"), 0, []byte("digest2"))
+	require.NoError(t, err)
 }
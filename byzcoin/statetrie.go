@@ -17,12 +17,19 @@ type ReadOnlyStateTrie interface {
 	GetValues(key []byte) (value []byte, version uint64, contractID string, darcID darc.ID, err error)
 	GetProof(key []byte) (*trie.Proof, error)
 	GetIndex() int
+	GetTimestamp() int64
 }
 
 // stagingStateTrie is a wrapper around trie.StagingTrie that allows for use in
 // byzcoin.
 type stagingStateTrie struct {
 	trie.StagingTrie
+	// index is the index of the last block applied to the trie, the
+	// instructions executed on the staging trie belong to the next block.
+	index int
+	// timestamp is the time in nanoseconds of the block the instructions
+	// belong to, it is used to evaluate the conditions of the darcs.
+	timestamp int64
 }
 
 // Clone makes a copy of the staged data of the structure, the source Trie is
@@ -30,6 +37,8 @@ type stagingStateTrie struct {
 func (t *stagingStateTrie) Clone() *stagingStateTrie {
 	return &stagingStateTrie{
 		StagingTrie: *t.StagingTrie.Clone(),
+		index:       t.index,
+		timestamp:   t.timestamp,
 	}
 }
 
@@ -77,12 +86,21 @@ func (t *stagingStateTrie) Commit() error {
 	return errors.New("not implemented")
 }
 
-// GetIndex returns the index of the current trie.
+// GetIndex returns the index of the last block applied to the trie. The
+// instructions executed on the staging trie belong to the block with index
+// GetIndex()+1.
 func (t *stagingStateTrie) GetIndex() int {
-	panic("cannot get index in stagingStateTrie")
+	return t.index
+}
+
+// GetTimestamp returns the time in nanoseconds of the block the instructions
+// executed on the staging trie belong to.
+func (t *stagingStateTrie) GetTimestamp() int64 {
+	return t.timestamp
 }
 
 const trieIndexKey = "trieIndexKey"
+const trieTimestampKey = "trieTimestampKey"
 
 // stateTrie is a wrapper around trie.Trie that support the storage of an
 // index.
@@ -114,8 +132,9 @@ func newStateTrie(db *bolt.DB, bucket, nonce []byte) (*stateTrie, error) {
 	}, nil
 }
 
-// StoreAll stores the state changes in the Trie.
-func (t *stateTrie) StoreAll(scs StateChanges, index int) error {
+// StoreAll stores the state changes of the block with the given index and
+// timestamp in the Trie.
+func (t *stateTrie) StoreAll(scs StateChanges, index int, timestamp int64) error {
 	pairs := make([]trie.KVPair, len(scs))
 	for i := range pairs {
 		pairs[i] = &scs[i]
@@ -126,7 +145,12 @@ func (t *stateTrie) StoreAll(scs StateChanges, index int) error {
 		}
 		indexBuf := make([]byte, 4)
 		binary.LittleEndian.PutUint32(indexBuf, uint32(index))
-		return t.SetMetadataWithBucket([]byte(trieIndexKey), indexBuf, b)
+		if err := t.SetMetadataWithBucket([]byte(trieIndexKey), indexBuf, b); err != nil {
+			return err
+		}
+		timestampBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestampBuf, uint64(timestamp))
+		return t.SetMetadataWithBucket([]byte(trieTimestampKey), timestampBuf, b)
 	})
 }
 
@@ -165,10 +189,22 @@ func (t *stateTrie) GetIndex() int {
 	return int(binary.LittleEndian.Uint32(indexBuf))
 }
 
+// GetTimestamp gets the timestamp of the latest block, or 0 if it is not
+// known.
+func (t *stateTrie) GetTimestamp() int64 {
+	timestampBuf := t.GetMetadata([]byte(trieTimestampKey))
+	if timestampBuf == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(timestampBuf))
+}
+
 // MakeStagingStateTrie creates a StagingStateTrie from the StateTrie.
 func (t *stateTrie) MakeStagingStateTrie() *stagingStateTrie {
 	return &stagingStateTrie{
 		StagingTrie: *t.MakeStagingTrie(),
+		index:       t.GetIndex(),
+		timestamp:   t.GetTimestamp(),
 	}
 }
 
@@ -180,6 +216,7 @@ func newMemStagingStateTrie(nonce []byte) (*stagingStateTrie, error) {
 	}
 	et := stagingStateTrie{
 		StagingTrie: *memTrie.MakeStagingTrie(),
+		index:       -1,
 	}
 	return &et, nil
 }
@@ -31,11 +31,17 @@ func TestStateTrie(t *testing.T) {
 		Version:     version,
 		DarcID:      darcID,
 	}
-	require.NoError(t, st.StoreAll([]StateChange{sc}, 5))
+	require.NoError(t, st.StoreAll([]StateChange{sc}, 5, 50))
 	require.Equal(t, st.GetIndex(), 5)
 
-	require.NoError(t, st.StoreAll([]StateChange{sc}, 6))
+	require.NoError(t, st.StoreAll([]StateChange{sc}, 6, 60))
 	require.Equal(t, st.GetIndex(), 6)
+	require.Equal(t, int64(60), st.GetTimestamp())
+	// The staging trie knows the last block, so that the contracts can
+	// find out in which block they are executed.
+	require.Equal(t, 6, st.MakeStagingStateTrie().GetIndex())
+	require.Equal(t, 6, st.MakeStagingStateTrie().Clone().GetIndex())
+	require.Equal(t, int64(60), st.MakeStagingStateTrie().Clone().GetTimestamp())
 
 	_, _, _, _, err = st.GetValues(append(key, byte(0)))
 	require.Equal(t, errKeyNotSet, err)
@@ -723,12 +723,32 @@ func (c ChainConfig) sanityCheck(old *ChainConfig) error {
 	if len(c.Roster.List) < 3 {
 		return errors.New("need at least 3 nodes to have a majority")
 	}
+	switch c.ReplayProtection {
+	case ReplaySignerCounters:
+	case ReplayNonce:
+		if c.NonceMaxExpiry == 0 {
+			return errors.New("nonce max expiry must be greater than zero")
+		}
+	default:
+		return errors.New("unknown replay protection")
+	}
 	if old != nil {
+		// The upgrades can only be changed by upgrade_contract.
+		if !equalContractUpgrades(old.ContractUpgrades, c.ContractUpgrades) {
+			return errors.New("contract upgrades cannot be changed by update_config")
+		}
 		return old.checkNewRoster(c.Roster)
 	}
 	return nil
 }
 
+// CheckUpdate returns an error if newConfig is not accepted by the
+// update_config command to replace c. Clients can use it to validate a new
+// config before sending it.
+func (c ChainConfig) CheckUpdate(newConfig ChainConfig) error {
+	return newConfig.sanityCheck(&c)
+}
+
 // checkNewRoster makes sure that the new roster follows the rules we need
 // in byzcoin:
 //   - no new node can join as leader
@@ -7,7 +7,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/byzcoin/trie"
 	"github.com/dedis/cothority/darc"
@@ -114,6 +116,14 @@ func (instr Instruction) Hash() []byte {
 		binary.LittleEndian.PutUint64(verBuf, ver)
 		h.Write(verBuf)
 	}
+	// The nonce is only hashed if it is set, so that the hash of the
+	// instructions using signer counters doesn't change.
+	if len(instr.Nonce) > 0 {
+		h.Write(instr.Nonce)
+		expBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(expBuf, instr.Expiry)
+		h.Write(expBuf)
+	}
 	return h.Sum(nil)
 }
 
@@ -186,10 +196,23 @@ func (instr Instruction) String() string {
 	out += fmt.Sprintf("\tinstID: %v\n", instr.InstanceID)
 	out += fmt.Sprintf("\taction: %s\n", instr.Action())
 	out += fmt.Sprintf("\tcounters: %v\n", instr.SignerCounter)
+	if len(instr.Nonce) > 0 {
+		out += fmt.Sprintf("\tnonce: %x expiry: %d\n", instr.Nonce, instr.Expiry)
+	}
 	out += fmt.Sprintf("\tsignatures: %d\n", len(instr.Signatures))
 	return out
 }
 
+// SetNonce sets a random nonce and the given expiry, for chains that use
+// ReplayNonce instead of the signer counters. It must be called before
+// signing.
+func (instr *Instruction) SetNonce(expiry uint64) {
+	n := GenNonce()
+	instr.Nonce = n[:]
+	instr.Expiry = expiry
+	instr.SignerCounter = nil
+}
+
 // SignWith creates a signed version of the instruction. The signature is
 // created on msg, which must be the hash of the ClientTransaction which
 // contains the instruction. Otherwise the verification will fail on the server
@@ -223,8 +246,12 @@ func (instr Instruction) GetIdentityStrings() []string {
 // and then verify if the signature on the instruction can satisfy the rules of
 // the darc. An error is returned if any of the verification fails.
 func (instr Instruction) Verify(st ReadOnlyStateTrie, msg []byte) error {
-	// check the signature counters
-	if err := verifySignerCounters(st, instr.SignerCounter, instr.Signatures); err != nil {
+	// check the signature counters or the nonce
+	guard, err := getReplayGuard(st)
+	if err != nil {
+		return err
+	}
+	if err = guard.verify(st, instr); err != nil {
 		return err
 	}
 
@@ -249,8 +276,69 @@ func (instr Instruction) Verify(st ReadOnlyStateTrie, msg []byte) error {
 		}
 	}
 
-	// check the expression
-	getDarc := func(str string, latest bool) *darc.Darc {
+	// check the expression and its conditions
+	return darc.EvalExprContext(d.Rules.Get(darc.Action(instr.Action())), darcGetter(st), instr.darcContext(st, d),
+		instr.GetIdentityStrings()...)
+}
+
+// ExplainAuthorization returns the trace of the evaluation of the rule of the
+// action of the instruction in the darc of its instance, if the given
+// identities sign it. Unlike CheckAuthorization, the conditions are checked
+// against the context of the instruction, with the time and the index of
+// the last block of st. The signatures and the replay protection are not
+// checked.
+func (instr Instruction) ExplainAuthorization(st ReadOnlyStateTrie, ids ...darc.Identity) (*darc.EvalTrace, error) {
+	d, err := getInstanceDarc(st, instr.InstanceID)
+	if err != nil {
+		return nil, errors.New("darc not found: " + err.Error())
+	}
+	action := darc.Action(instr.Action())
+	if !d.Rules.Contains(action) {
+		return nil, fmt.Errorf("action '%v' does not exist", action)
+	}
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = id.String()
+	}
+	return darc.EvalExprTrace(d.Rules.Get(action), darcGetter(st), false, instr.darcContext(st, d), idStrs...)
+}
+
+// darcContext returns the context against which the conditions of the rule
+// of the darc d are checked: the time and the index of the block, the
+// arguments of the instruction and the earlier uses of its action on d. The
+// delegations of the rule are restricted by d.
+func (instr Instruction) darcContext(st ReadOnlyStateTrie, d *darc.Darc) *darc.Context {
+	ctx := &darc.Context{
+		Arg: func(name string) []byte {
+			switch instr.GetType() {
+			case SpawnType:
+				return instr.Spawn.Args.Search(name)
+			case InvokeType:
+				return instr.Invoke.Args.Search(name)
+			}
+			return nil
+		},
+		Uses: func(window time.Duration) int {
+			u, err := getActionUsage(st, d.GetBaseID(), instr.Action())
+			if err != nil {
+				log.Error("couldn't get the uses of the action:", err)
+				return math.MaxInt32
+			}
+			return u.count(st.GetTimestamp() - int64(window))
+		},
+	}
+	if ts := st.GetTimestamp(); ts != 0 {
+		ctx.Time = time.Unix(0, ts)
+	}
+	ctx.Height = uint64(st.GetIndex() + 1)
+	ctx.Darc = d
+	return ctx
+}
+
+// darcGetter returns a callback that loads the darcs referenced in
+// expressions as "darc:<id>" from the trie.
+func darcGetter(st ReadOnlyStateTrie) darc.GetDarc {
+	return func(str string, latest bool) *darc.Darc {
 		if len(str) < 5 || string(str[0:5]) != "darc:" {
 			return nil
 		}
@@ -264,7 +352,6 @@ func (instr Instruction) Verify(st ReadOnlyStateTrie, msg []byte) error {
 		}
 		return d
 	}
-	return darc.EvalExpr(d.Rules.Get(darc.Action(instr.Action())), getDarc, instr.GetIdentityStrings()...)
 }
 
 // InstrType is the instruction type, which can be spawn, invoke or delete.
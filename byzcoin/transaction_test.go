@@ -3,9 +3,11 @@ package byzcoin
 import (
 	"encoding/binary"
 	"testing"
+	"time"
 
 	"github.com/dedis/cothority/byzcoin/trie"
 	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
 	"github.com/dedis/protobuf"
 	"github.com/stretchr/testify/require"
 )
@@ -26,7 +28,7 @@ func TestTransaction_Signing(t *testing.T) {
 	mdb := trie.NewMemDB()
 	tr, err := trie.NewTrie(mdb, []byte("my nonce"))
 	require.NoError(t, err)
-	sst := &stagingStateTrie{*tr.MakeStagingTrie()}
+	sst := &stagingStateTrie{StagingTrie: *tr.MakeStagingTrie()}
 
 	// verification should fail because trie is empty
 	ctxHash := ctx.Instructions.Hash()
@@ -135,3 +137,38 @@ func combineInstrsAndSign(signer darc.Signer, instrs ...Instruction) (ClientTran
 	}
 	return t, nil
 }
+
+// TestTransaction_DelegationExpiry checks that the delegation of a rule to a
+// darc expires at the height set in the darc of the instance.
+func TestTransaction_DelegationExpiry(t *testing.T) {
+	sst, err := newMemStagingStateTrie([]byte("my nonce"))
+	require.NoError(t, err)
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	contractor := darc.NewSignerEd25519(nil, nil)
+	child := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()},
+		[]darc.Identity{contractor.Identity()}), []byte("contractor"))
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()},
+		[]darc.Identity{owner.Identity()}), []byte("delegating"))
+	require.NoError(t, d.Rules.AddRule("invoke:update", expression.Expr(child.GetIdentityString())))
+	d.SetDelegation(child.GetBaseID(), time.Time{}, 10)
+	var scs StateChanges
+	for _, dd := range []*darc.Darc{child, d} {
+		buf, err := dd.ToProto()
+		require.NoError(t, err)
+		scs = append(scs, NewStateChange(Create, NewInstanceID(dd.GetBaseID()), ContractDarcID, buf, dd.GetBaseID()))
+	}
+	require.NoError(t, sst.StoreAll(scs))
+
+	instr := Instruction{
+		InstanceID:    NewInstanceID(d.GetBaseID()),
+		Invoke:        &Invoke{Command: "update"},
+		SignerCounter: []uint64{1},
+	}
+	msg := Instructions{instr}.Hash()
+	require.NoError(t, instr.SignWith(msg, contractor))
+	sst.index = 8
+	require.NoError(t, instr.Verify(sst, msg))
+	sst.index = 9
+	require.Error(t, instr.Verify(sst, msg))
+}
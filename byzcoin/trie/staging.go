@@ -2,6 +2,7 @@ package trie
 
 import (
 	"errors"
+	"sort"
 	"sync"
 )
 
@@ -215,6 +216,42 @@ func (t *StagingTrie) GetProof(key []byte) (*Proof, error) {
 	return p, err
 }
 
+// ForEach calls f on every key/value pair of the staging trie. The pairs of
+// the source trie that are not modified are visited first, in the order of
+// the source trie, followed by the staged pairs sorted by key. The traversal
+// stops at the first error returned by f. f must not use the staging trie.
+func (t *StagingTrie) ForEach(f func(k, v []byte) error) error {
+	t.Lock()
+	defer t.Unlock()
+
+	err := t.source.ForEach(func(k, v []byte) error {
+		if t.isDeleted(k) {
+			return nil
+		}
+		if _, ok := t.overlay[string(k)]; ok {
+			return nil
+		}
+		return f(k, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for k := range t.overlay {
+		if !t.isDeleted([]byte(k)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := f([]byte(k), t.overlay[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (t *StagingTrie) isDeleted(k []byte) bool {
 	if _, ok := t.deleteList[string(k)]; ok {
 		return true
@@ -1,6 +1,7 @@
 package trie
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -311,3 +312,55 @@ func testStagingBatch(t *testing.T, db DB) {
 	require.NoError(t, sTrie2.Batch(pairs))
 	require.Equal(t, root1, sTrie2.GetRoot())
 }
+
+func TestStagingForEach(t *testing.T) {
+	testMemAndDisk(t, testStagingForEach)
+}
+
+func testStagingForEach(t *testing.T, db DB) {
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		k := []byte{byte(i)}
+		require.NoError(t, testTrie.Set(k, k))
+	}
+
+	// The source trie must give all the pairs.
+	pairs := make(map[byte]byte)
+	require.NoError(t, testTrie.ForEach(func(k, v []byte) error {
+		pairs[k[0]] = v[0]
+		return nil
+	}))
+	require.Equal(t, 10, len(pairs))
+
+	// Overwrite, delete and add some keys in the staging trie.
+	sTrie := testTrie.MakeStagingTrie()
+	require.NoError(t, sTrie.Set([]byte{0}, []byte{100}))
+	require.NoError(t, sTrie.Delete([]byte{1}))
+	require.NoError(t, sTrie.Set([]byte{20}, []byte{20}))
+	require.NoError(t, sTrie.Set([]byte{21}, []byte{21}))
+	require.NoError(t, sTrie.Delete([]byte{21}))
+
+	var keys []byte
+	pairs = make(map[byte]byte)
+	require.NoError(t, sTrie.ForEach(func(k, v []byte) error {
+		keys = append(keys, k[0])
+		pairs[k[0]] = v[0]
+		return nil
+	}))
+	require.Equal(t, 10, len(keys))
+	require.Equal(t, 10, len(pairs))
+	require.Equal(t, byte(100), pairs[0])
+	require.Equal(t, byte(20), pairs[20])
+	_, ok := pairs[1]
+	require.False(t, ok)
+	_, ok = pairs[21]
+	require.False(t, ok)
+	// The staged keys come last.
+	require.Equal(t, []byte{0, 20}, keys[8:])
+
+	// The traversal stops on error.
+	require.Error(t, sTrie.ForEach(func(k, v []byte) error {
+		return errors.New("stop")
+	}))
+}
@@ -476,6 +476,15 @@ func (t *Trie) CopyTo(target Bucket) error {
 	})
 }
 
+// ForEach calls f on every key/value pair stored in the trie. The pairs are
+// visited in the order of the trie, which is the same for all tries holding
+// the same pairs. The traversal stops at the first error returned by f.
+func (t *Trie) ForEach(f func(k, v []byte) error) error {
+	return t.db.View(func(b Bucket) error {
+		return t.dfs(&forEachNodeProcessor{f}, t.getRoot(b), b)
+	})
+}
+
 // TODO for now we just replace leafs with empty nodes, which is ok but it'll
 // be better if we can "shrink" the tree as well.
 func (t *Trie) del(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket) ([]byte, error) {
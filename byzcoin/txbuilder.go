@@ -0,0 +1,351 @@
+package byzcoin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/darc"
+)
+
+// TxBuilder chains spawn, invoke and delete instructions on one or more
+// contracts and sends them to the ledger. It sets the signer counters, or the
+// nonces if the ledger uses ReplayNonce, signs the instructions and waits
+// for them to be included.
+//
+// An instruction can use the instance spawned by a previous instruction,
+// either as the instance it is sent to or as the value of an argument. As
+// the ID of a spawned instance is derived from the signatures of the
+// transaction holding the spawn instruction, an instruction that refers to
+// it is put in a new transaction. All the other instructions are added to
+// the current transaction, so that they are accepted or refused together.
+// The spawned instances are supposed to use the convention of
+// Instruction.DeriveID(""). For the contracts deriving their IDs from the
+// arguments, like darcs, use ExistingInstance with the known ID.
+type TxBuilder struct {
+	cl      *Client
+	signers []darc.Signer
+	instrs  []*BuilderInstruction
+}
+
+// InstanceRef refers to an instance, either by its ID or as the instance
+// spawned by an instruction of the builder.
+type InstanceRef struct {
+	id InstanceID
+	// spawnedBy is the index of the spawn instruction plus one, or 0 if
+	// the instance is given by its ID.
+	spawnedBy int
+}
+
+// ExistingInstance returns a reference to the instance with the given ID.
+func ExistingInstance(id InstanceID) InstanceRef {
+	return InstanceRef{id: id}
+}
+
+// BuilderInstruction is an instruction added to a TxBuilder.
+type BuilderInstruction struct {
+	index   int
+	target  InstanceRef
+	instr   Instruction
+	argRefs []builderArgRef
+	signers []darc.Signer
+}
+
+type builderArgRef struct {
+	name string
+	ref  InstanceRef
+}
+
+// InstructionResult is the outcome of an instruction sent by a TxBuilder.
+type InstructionResult struct {
+	// Instruction is the instruction as it was signed and sent.
+	Instruction Instruction
+	// InstanceID is the ID of the spawned instance for a spawn
+	// instruction, and the ID of the target instance otherwise.
+	InstanceID InstanceID
+	// Proof is the proof of InstanceID after the inclusion of the
+	// transaction. For a delete instruction, it proves the absence of the
+	// instance.
+	Proof Proof
+}
+
+// NewTxBuilder returns a builder for the ledger of the client. The signers
+// are used for all the instructions that don't have their own signers.
+func (c *Client) NewTxBuilder(signers ...darc.Signer) *TxBuilder {
+	return &TxBuilder{cl: c, signers: signers}
+}
+
+// Spawn adds a spawn instruction of the contract to the instance ref, which
+// is usually a darc.
+func (b *TxBuilder) Spawn(ref InstanceRef, contractID string, args Arguments) *BuilderInstruction {
+	return b.add(ref, Instruction{Spawn: &Spawn{ContractID: contractID, Args: args}})
+}
+
+// Invoke adds an invoke instruction of the command on the instance ref.
+func (b *TxBuilder) Invoke(ref InstanceRef, command string, args Arguments) *BuilderInstruction {
+	return b.add(ref, Instruction{Invoke: &Invoke{Command: command, Args: args}})
+}
+
+// Delete adds a delete instruction of the instance ref.
+func (b *TxBuilder) Delete(ref InstanceRef) *BuilderInstruction {
+	return b.add(ref, Instruction{Delete: &Delete{}})
+}
+
+func (b *TxBuilder) add(ref InstanceRef, instr Instruction) *BuilderInstruction {
+	bi := &BuilderInstruction{
+		index:  len(b.instrs),
+		target: ref,
+		instr:  instr,
+	}
+	b.instrs = append(b.instrs, bi)
+	return bi
+}
+
+// Spawned returns a reference to the instance created by the spawn
+// instruction.
+func (bi *BuilderInstruction) Spawned() InstanceRef {
+	return InstanceRef{spawnedBy: bi.index + 1}
+}
+
+// WithArgInstance adds an argument whose value is the ID of the instance
+// ref.
+func (bi *BuilderInstruction) WithArgInstance(name string, ref InstanceRef) *BuilderInstruction {
+	bi.argRefs = append(bi.argRefs, builderArgRef{name: name, ref: ref})
+	return bi
+}
+
+// WithSigners sets the signers of the instruction, replacing the ones of
+// the builder.
+func (bi *BuilderInstruction) WithSigners(signers ...darc.Signer) *BuilderInstruction {
+	bi.signers = signers
+	return bi
+}
+
+// refs returns the references used by the instruction.
+func (bi *BuilderInstruction) refs() []InstanceRef {
+	refs := []InstanceRef{bi.target}
+	for _, a := range bi.argRefs {
+		refs = append(refs, a.ref)
+	}
+	return refs
+}
+
+// Send sends the instructions to the ledger, in as few transactions as
+// possible, and waits up to wait blocks for every transaction to be
+// included. It returns one result per instruction, in the order they were
+// added. If a transaction is refused, the results of the transactions
+// already included are returned with the error.
+func (b *TxBuilder) Send(wait int) ([]InstructionResult, error) {
+	if len(b.instrs) == 0 {
+		return nil, errors.New("no instructions to send")
+	}
+	if wait <= 0 {
+		return nil, errors.New("need to wait for the inclusion of the transactions")
+	}
+	groups, err := b.groups()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := b.newReplayState()
+	if err != nil {
+		return nil, err
+	}
+
+	spawned := make(map[int]InstanceID)
+	var results []InstructionResult
+	for g, group := range groups {
+		ctx := ClientTransaction{}
+		var signers [][]darc.Signer
+		for _, bi := range group {
+			instr, err := bi.resolve(spawned)
+			if err != nil {
+				return results, err
+			}
+			s := bi.signers
+			if len(s) == 0 {
+				s = b.signers
+			}
+			if len(s) == 0 {
+				return results, fmt.Errorf("instruction %d has no signers", bi.index)
+			}
+			if err = rs.set(&instr, s); err != nil {
+				return results, err
+			}
+			ctx.Instructions = append(ctx.Instructions, instr)
+			signers = append(signers, s)
+		}
+		h := ctx.Instructions.Hash()
+		for i := range ctx.Instructions {
+			if err = ctx.Instructions[i].SignWith(h, signers[i]...); err != nil {
+				return results, err
+			}
+		}
+
+		if _, err = b.cl.AddTransactionAndWait(ctx, wait); err != nil {
+			return results, fmt.Errorf("transaction %d of %d: %s", g+1, len(groups), err)
+		}
+
+		for i, bi := range group {
+			instr := ctx.Instructions[i]
+			id := instr.InstanceID
+			if instr.GetType() == SpawnType {
+				id = instr.DeriveID("")
+				spawned[bi.index] = id
+			}
+			resp, err := b.cl.GetProof(id.Slice())
+			if err != nil {
+				return results, err
+			}
+			results = append(results, InstructionResult{
+				Instruction: instr,
+				InstanceID:  id,
+				Proof:       resp.Proof,
+			})
+		}
+	}
+	return results, nil
+}
+
+// groups splits the instructions in transactions. A new transaction is
+// started when an instruction refers to an instance spawned in the current
+// one.
+func (b *TxBuilder) groups() ([][]*BuilderInstruction, error) {
+	var groups [][]*BuilderInstruction
+	var current []*BuilderInstruction
+	inCurrent := make(map[int]bool)
+	for _, bi := range b.instrs {
+		split := false
+		for _, ref := range bi.refs() {
+			if ref.spawnedBy == 0 {
+				continue
+			}
+			k := ref.spawnedBy - 1
+			if k >= bi.index {
+				return nil, fmt.Errorf("instruction %d refers to a later instruction", bi.index)
+			}
+			if b.instrs[k].instr.GetType() != SpawnType {
+				return nil, fmt.Errorf("instruction %d refers to instruction %d, which is not a spawn", bi.index, k)
+			}
+			if inCurrent[k] {
+				split = true
+			}
+		}
+		if split {
+			groups = append(groups, current)
+			current = nil
+			inCurrent = make(map[int]bool)
+		}
+		current = append(current, bi)
+		inCurrent[bi.index] = true
+	}
+	return append(groups, current), nil
+}
+
+// resolve returns the instruction with the references replaced by the IDs
+// of the spawned instances.
+func (bi *BuilderInstruction) resolve(spawned map[int]InstanceID) (Instruction, error) {
+	lookup := func(ref InstanceRef) (InstanceID, error) {
+		if ref.spawnedBy == 0 {
+			return ref.id, nil
+		}
+		id, ok := spawned[ref.spawnedBy-1]
+		if !ok {
+			return InstanceID{}, fmt.Errorf("instance of instruction %d is not spawned yet", ref.spawnedBy-1)
+		}
+		return id, nil
+	}
+
+	instr := bi.instr
+	var err error
+	instr.InstanceID, err = lookup(bi.target)
+	if err != nil {
+		return instr, err
+	}
+	if len(bi.argRefs) == 0 {
+		return instr, nil
+	}
+	var args Arguments
+	switch instr.GetType() {
+	case SpawnType:
+		args = append(args, instr.Spawn.Args...)
+	case InvokeType:
+		args = append(args, instr.Invoke.Args...)
+	default:
+		return instr, errors.New("delete instructions have no arguments")
+	}
+	for _, a := range bi.argRefs {
+		id, err := lookup(a.ref)
+		if err != nil {
+			return instr, err
+		}
+		args = append(args, Argument{Name: a.name, Value: id.Slice()})
+	}
+	switch instr.GetType() {
+	case SpawnType:
+		instr.Spawn = &Spawn{ContractID: instr.Spawn.ContractID, Args: args}
+	case InvokeType:
+		instr.Invoke = &Invoke{Command: instr.Invoke.Command, Args: args}
+	}
+	return instr, nil
+}
+
+// replayState keeps track of the counters of the signers, or of the expiry
+// of the nonces, while the transactions are created.
+type replayState struct {
+	cl       *Client
+	nonce    bool
+	expiry   uint64
+	counters map[string]uint64
+}
+
+func (b *TxBuilder) newReplayState() (*replayState, error) {
+	config, err := b.cl.GetChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	rs := &replayState{cl: b.cl, counters: make(map[string]uint64)}
+	if config.ReplayProtection == ReplayNonce {
+		resp, err := b.cl.GetProof(ConfigInstanceID.Slice())
+		if err != nil {
+			return nil, err
+		}
+		rs.nonce = true
+		rs.expiry = uint64(resp.Proof.Latest.Index) + config.NonceMaxExpiry
+	}
+	return rs, nil
+}
+
+// set sets the counters or the nonce of the instruction.
+func (rs *replayState) set(instr *Instruction, signers []darc.Signer) error {
+	if rs.nonce {
+		instr.SetNonce(rs.expiry)
+		return nil
+	}
+
+	var missing []string
+	for _, s := range signers {
+		id := s.Identity().String()
+		if _, ok := rs.counters[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		reply, err := rs.cl.GetSignerCounters(missing...)
+		if err != nil {
+			return err
+		}
+		if len(reply.Counters) != len(missing) {
+			return errors.New("wrong number of signer counters")
+		}
+		for i, id := range missing {
+			rs.counters[id] = reply.Counters[i]
+		}
+	}
+
+	instr.SignerCounter = nil
+	for _, s := range signers {
+		id := s.Identity().String()
+		rs.counters[id]++
+		instr.SignerCounter = append(instr.SignerCounter, rs.counters[id])
+	}
+	return nil
+}
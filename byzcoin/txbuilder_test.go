@@ -0,0 +1,112 @@
+package byzcoin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+var builderContract = "builder"
+
+// builderContractFunc spawns instances at DeriveID(""), and updates their
+// value with the "value" argument, or with the "ref" argument if the
+// referred instance exists.
+func builderContractFunc(rst ReadOnlyStateTrie, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch inst.GetType() {
+	case SpawnType:
+		return []StateChange{
+			NewStateChange(Create, inst.DeriveID(""), builderContract, inst.Spawn.Args.Search("value"), darcID),
+		}, c, nil
+	case InvokeType:
+		value := inst.Invoke.Args.Search("value")
+		if ref := inst.Invoke.Args.Search("ref"); ref != nil {
+			if _, _, _, _, err := rst.GetValues(ref); err != nil {
+				return nil, nil, errors.New("referred instance doesn't exist")
+			}
+			value = ref
+		}
+		return []StateChange{
+			NewStateChange(Update, inst.InstanceID, builderContract, value, darcID),
+		}, c, nil
+	default:
+		return []StateChange{
+			NewStateChange(Remove, inst.InstanceID, builderContract, nil, darcID),
+		}, c, nil
+	}
+}
+
+func TestTxBuilder(t *testing.T) {
+	l := onet.NewLocalTestT(tSuite, t)
+	defer l.CloseAll()
+	servers, roster, _ := l.GenTree(3, true)
+	for _, s := range servers {
+		RegisterContract(s, builderContract, adaptor(builderContractFunc))
+	}
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := DefaultGenesisMsg(CurrentVersion, roster,
+		[]string{"spawn:" + builderContract, "invoke:update", "delete"}, signer.Identity())
+	require.NoError(t, err)
+	msg.BlockInterval = 100 * time.Millisecond
+	cl, _, err := NewLedger(msg, false)
+	require.NoError(t, err)
+	gDarc := ExistingInstance(NewInstanceID(msg.GenesisDarc.GetBaseID()))
+
+	b := cl.NewTxBuilder(signer)
+	a := b.Spawn(gDarc, builderContract, Arguments{{Name: "value", Value: []byte("a")}})
+	// Needs the ID of a, so goes in a second transaction with the spawn
+	// of c.
+	b.Invoke(a.Spawned(), "update", Arguments{{Name: "value", Value: []byte("a2")}})
+	c := b.Spawn(gDarc, builderContract, Arguments{{Name: "value", Value: []byte("c")}})
+	b.Invoke(a.Spawned(), "update", nil).WithArgInstance("ref", c.Spawned())
+	groups, err := b.groups()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(groups))
+	require.Equal(t, 2, len(groups[1]))
+
+	results, err := b.Send(10)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(results))
+	require.Equal(t, results[0].InstanceID, results[1].InstanceID)
+	require.Equal(t, results[0].InstanceID, results[3].InstanceID)
+	_, v, _, _, err := results[1].Proof.KeyValue()
+	require.NoError(t, err)
+	require.Equal(t, []byte("a2"), v)
+	_, v, _, _, err = results[2].Proof.KeyValue()
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), v)
+	_, v, _, _, err = results[3].Proof.KeyValue()
+	require.NoError(t, err)
+	require.Equal(t, results[2].InstanceID.Slice(), v)
+
+	// A new builder fetches the updated counters.
+	b = cl.NewTxBuilder(signer)
+	b.Delete(ExistingInstance(results[0].InstanceID))
+	b.Delete(ExistingInstance(results[2].InstanceID))
+	results, err = b.Send(10)
+	require.NoError(t, err)
+	require.False(t, results[0].Proof.InclusionProof.Match(results[0].InstanceID.Slice()))
+	require.False(t, results[1].Proof.InclusionProof.Match(results[1].InstanceID.Slice()))
+
+	// A refused transaction returns an error.
+	b = cl.NewTxBuilder(signer)
+	b.Invoke(ExistingInstance(results[0].InstanceID), "update", nil)
+	_, err = b.Send(10)
+	require.Error(t, err)
+
+	// References must be to earlier spawn instructions.
+	b = cl.NewTxBuilder(signer)
+	d := b.Delete(gDarc)
+	b.Invoke(d.Spawned(), "update", nil)
+	_, err = b.Send(10)
+	require.Error(t, err)
+}
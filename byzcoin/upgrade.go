@@ -0,0 +1,281 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// The contracts can be upgraded by registering new versions of them with
+// RegisterContractVersion. A new version is only used once the ledger
+// activates it with the upgrade_contract command of the config contract:
+// the first block with an index greater or equal to the one given in the
+// command migrates the instances of the contract using the MigrationFn of
+// the new version, before executing its transactions. As all the nodes run
+// the same migration on the same state, the result is part of the block.
+
+// CmdConfigUpgradeContract is the command of the config contract that
+// activates a new version of a contract.
+var CmdConfigUpgradeContract = "upgrade_contract"
+
+// MigrationFn converts the value of an instance from the format of the
+// previous version of a contract to the format of the new version. It is
+// called on all the nodes, so it must be deterministic.
+type MigrationFn func(rst ReadOnlyStateTrie, id InstanceID, value []byte) ([]byte, error)
+
+// contractVersion is a registered version of a contract.
+type contractVersion struct {
+	fn      ContractFn
+	migrate MigrationFn
+}
+
+// RegisterContractVersion stores a new version of a contract. The version
+// registered by RegisterContract is 0, and is used until another version
+// is activated by upgrade_contract. The migration function can be nil if
+// the values of the instances don't change. The versions that must also be
+// known when replaying a chain are registered with
+// RegisterGlobalContractVersion.
+func RegisterContractVersion(s skipchain.GetService, kind string, version uint32, f ContractFn, m MigrationFn) error {
+	if version == 0 {
+		return errors.New("version 0 is registered by RegisterContract")
+	}
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerContractVersion(kind, version, f, m)
+}
+
+var globalContractVersions = make(map[string]map[uint32]contractVersion)
+
+// RegisterGlobalContractVersion stores a new version of a contract for all
+// the ByzCoin services, like RegisterGlobalContract does for the first
+// version. The services that replay a chain need all the versions that were
+// activated on it.
+func RegisterGlobalContractVersion(kind string, version uint32, f ContractFn, m MigrationFn) error {
+	if version == 0 {
+		return errors.New("version 0 is registered by RegisterGlobalContract")
+	}
+	globalContractsMut.Lock()
+	defer globalContractsMut.Unlock()
+	if _, exists := globalContractVersions[kind][version]; exists {
+		return fmt.Errorf("version %d of contract %s already registered", version, kind)
+	}
+	if globalContractVersions[kind] == nil {
+		globalContractVersions[kind] = make(map[uint32]contractVersion)
+	}
+	globalContractVersions[kind][version] = contractVersion{fn: f, migrate: m}
+	return nil
+}
+
+// registerContractVersion stores a version of the contract.
+func (s *Service) registerContractVersion(contractID string, version uint32, f ContractFn, m MigrationFn) error {
+	if s.contractVersions[contractID] == nil {
+		s.contractVersions[contractID] = make(map[uint32]contractVersion)
+	}
+	s.contractVersions[contractID][version] = contractVersion{fn: f, migrate: m}
+	return nil
+}
+
+// getContractFn returns the factory of the version of the contract that is
+// active in the trie.
+func (s *Service) getContractFn(st ReadOnlyStateTrie, contractID string) (ContractFn, bool) {
+	config, err := loadConfigFromTrie(st)
+	if err != nil {
+		// Before the genesis block, only the first versions exist.
+		fn, ok := s.contracts[contractID]
+		return fn, ok
+	}
+	version := config.contractVersion(contractID)
+	if version == 0 {
+		fn, ok := s.contracts[contractID]
+		return fn, ok
+	}
+	cv, ok := s.contractVersions[contractID][version]
+	return cv.fn, ok
+}
+
+// contractVersion returns the active version of the contract.
+func (c ChainConfig) contractVersion(contractID string) uint32 {
+	var version uint32
+	for _, u := range c.ContractUpgrades {
+		if u.ContractID == contractID && u.Migrated {
+			version = u.Version
+		}
+	}
+	return version
+}
+
+// addContractUpgrade verifies the arguments of the upgrade_contract command
+// and adds the upgrade to the config. The arguments are:
+//   - contract_id: the ID of the contract
+//   - version: the version to activate, as a LittleEndian uint64
+//   - block: the index of the block activating it, as a LittleEndian uint64
+func (s *Service) addContractUpgrade(rst ReadOnlyStateTrie, config *ChainConfig, args Arguments) error {
+	contractID := string(args.Search("contract_id"))
+	if contractID == "" {
+		return errors.New("missing contract_id argument")
+	}
+	if contractID == ContractConfigID {
+		return errors.New("the config contract cannot be upgraded")
+	}
+	versionBuf := args.Search("version")
+	blockBuf := args.Search("block")
+	if len(versionBuf) != 8 || len(blockBuf) != 8 {
+		return errors.New("version and block must be 8-byte uint64s")
+	}
+	version := binary.LittleEndian.Uint64(versionBuf)
+	block := binary.LittleEndian.Uint64(blockBuf)
+
+	if version == 0 || version > uint64(^uint32(0)) {
+		return fmt.Errorf("invalid version %d", version)
+	}
+	if _, ok := s.contractVersions[contractID][uint32(version)]; !ok {
+		return fmt.Errorf("version %d of contract %s is not registered", version, contractID)
+	}
+	if version <= uint64(config.contractVersion(contractID)) {
+		return fmt.Errorf("version %d of contract %s is not newer than the active one", version, contractID)
+	}
+	for _, u := range config.ContractUpgrades {
+		if u.ContractID == contractID && !u.Migrated {
+			return fmt.Errorf("contract %s has a pending upgrade to version %d", contractID, u.Version)
+		}
+	}
+	// The block holding the instruction is GetIndex()+1, so the upgrade
+	// can start from the next one.
+	if block <= uint64(rst.GetIndex()+1) {
+		return fmt.Errorf("block %d is not in the future", block)
+	}
+
+	config.ContractUpgrades = append(config.ContractUpgrades, ContractUpgrade{
+		ContractID: contractID,
+		Version:    uint32(version),
+		Block:      block,
+	})
+	return nil
+}
+
+// upgradeContracts runs the migrations of the upgrades that are activated
+// by the block with index sst.GetIndex()+1 and stores the resulting state
+// changes in sst. An upgrade whose migration fails is removed from the
+// config, so that the contract stays at its current version.
+func (s *Service) upgradeContracts(sst *stagingStateTrie) (StateChanges, error) {
+	config, err := loadConfigFromTrie(sst)
+	if err != nil {
+		// No upgrade can happen before the genesis block.
+		return nil, nil
+	}
+
+	index := uint64(sst.GetIndex() + 1)
+	var scs StateChanges
+	var upgrades []ContractUpgrade
+	changed := false
+	for _, u := range config.ContractUpgrades {
+		if u.Migrated || u.Block > index {
+			upgrades = append(upgrades, u)
+			continue
+		}
+		changed = true
+		migrationScs, err := s.migrateContract(sst, u)
+		if err != nil {
+			log.Errorf("%s couldn't migrate contract %s to version %d, dropping the upgrade: %s",
+				s.logID(), u.ContractID, u.Version, err)
+			continue
+		}
+		if err = sst.StoreAll(migrationScs); err != nil {
+			return nil, err
+		}
+		scs = append(scs, migrationScs...)
+		u.Migrated = true
+		upgrades = append(upgrades, u)
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	config.ContractUpgrades = upgrades
+	configBuf, err := protobuf.Encode(config)
+	if err != nil {
+		return nil, err
+	}
+	_, ver, _, darcID, err := sst.GetValues(ConfigInstanceID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	sc := NewStateChange(Update, ConfigInstanceID, ContractConfigID, configBuf, darcID)
+	sc.Version = ver + 1
+	if err = sst.StoreAll(StateChanges{sc}); err != nil {
+		return nil, err
+	}
+	return append(scs, sc), nil
+}
+
+// migrateContract returns the state changes that convert all the instances
+// of the contract to the version of the upgrade.
+func (s *Service) migrateContract(sst *stagingStateTrie, u ContractUpgrade) (StateChanges, error) {
+	cv, ok := s.contractVersions[u.ContractID][u.Version]
+	if !ok {
+		return nil, fmt.Errorf("version %d is not registered", u.Version)
+	}
+	if cv.migrate == nil {
+		return nil, nil
+	}
+
+	// The instances are collected first, as the migration functions
+	// cannot read the trie during the traversal.
+	type instance struct {
+		id   InstanceID
+		body StateChangeBody
+	}
+	var instances []instance
+	err := sst.ForEach(func(k, v []byte) error {
+		body, err := decodeStateChangeBody(v)
+		if err != nil {
+			return err
+		}
+		if string(body.ContractID) == u.ContractID {
+			instances = append(instances, instance{NewInstanceID(k), body})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The order of the traversal depends on the staged changes of the trie,
+	// which can differ between the nodes, so the instances are sorted to
+	// get the same state changes everywhere.
+	sort.Slice(instances, func(i, j int) bool {
+		return bytes.Compare(instances[i].id[:], instances[j].id[:]) < 0
+	})
+
+	var scs StateChanges
+	for _, inst := range instances {
+		value, err := cv.migrate(sst, inst.id, inst.body.Value)
+		if err != nil {
+			return nil, fmt.Errorf("instance %x: %s", inst.id.Slice(), err)
+		}
+		sc := NewStateChange(Update, inst.id, u.ContractID, value, inst.body.DarcID)
+		sc.Version = inst.body.Version + 1
+		scs = append(scs, sc)
+	}
+	return scs, nil
+}
+
+// equalContractUpgrades returns true if both lists hold the same upgrades.
+func equalContractUpgrades(a, b []ContractUpgrade) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
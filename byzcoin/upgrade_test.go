@@ -0,0 +1,140 @@
+package byzcoin
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_UpgradeContract(t *testing.T) {
+	local := onet.NewLocalTestT(tSuite, t)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, true)
+	s := local.GetServices(servers, ByzCoinID)[0].(*Service)
+
+	versionFn := func(version string) ContractFn {
+		return func([]byte) (Contract, error) {
+			return nil, errors.New(version)
+		}
+	}
+	require.NoError(t, s.registerContract("upgradable", versionFn("v0")))
+	require.NoError(t, s.registerContractVersion("upgradable", 1, versionFn("v1"),
+		func(rst ReadOnlyStateTrie, id InstanceID, value []byte) ([]byte, error) {
+			return append(value, []byte("-v1")...), nil
+		}))
+	require.NoError(t, s.registerContractVersion("upgradable", 2, versionFn("v2"),
+		func(rst ReadOnlyStateTrie, id InstanceID, value []byte) ([]byte, error) {
+			return nil, errors.New("cannot migrate")
+		}))
+	checkVersion := func(sst *stagingStateTrie, version string) {
+		fn, ok := s.getContractFn(sst, "upgradable")
+		require.True(t, ok)
+		_, err := fn(nil)
+		require.EqualError(t, err, version)
+	}
+
+	sst, err := newMemStagingStateTrie([]byte("my nonce"))
+	require.NoError(t, err)
+	darcID := make([]byte, 32)
+	storeConfig := func(config *ChainConfig) {
+		buf, err := protobuf.Encode(config)
+		require.NoError(t, err)
+		action := Update
+		if v, _ := sst.Get(ConfigInstanceID.Slice()); v == nil {
+			action = Create
+		}
+		require.NoError(t, sst.StoreAll(StateChanges{
+			NewStateChange(action, ConfigInstanceID, ContractConfigID, buf, darcID),
+		}))
+	}
+	storeConfig(&ChainConfig{
+		BlockInterval: testInterval,
+		Roster:        *roster,
+		MaxBlockSize:  16000,
+	})
+	ids := []InstanceID{NewInstanceID([]byte("a")), NewInstanceID([]byte("b")), NewInstanceID([]byte("c"))}
+	require.NoError(t, sst.StoreAll(StateChanges{
+		NewStateChange(Create, ids[0], "upgradable", []byte("a"), darcID),
+		NewStateChange(Create, ids[1], "upgradable", []byte("b"), darcID),
+		NewStateChange(Create, ids[2], "other", []byte("c"), darcID),
+	}))
+	checkVersion(sst, "v0")
+
+	upgradeArgs := func(contractID string, version, block uint64) Arguments {
+		vBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(vBuf, version)
+		bBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(bBuf, block)
+		return Arguments{
+			{Name: "contract_id", Value: []byte(contractID)},
+			{Name: "version", Value: vBuf},
+			{Name: "block", Value: bBuf},
+		}
+	}
+
+	// The instruction is in block 1, so the upgrade must start later.
+	sst.index = 0
+	config, err := loadConfigFromTrie(sst)
+	require.NoError(t, err)
+	require.Error(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 1, 1)))
+	require.Error(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 3, 5)))
+	require.Error(t, s.addContractUpgrade(sst, config, upgradeArgs(ContractConfigID, 1, 5)))
+	require.NoError(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 1, 5)))
+	require.Error(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 2, 6)))
+	storeConfig(config)
+
+	// Nothing happens before the block of the upgrade.
+	sst.index = 3
+	scs, err := s.upgradeContracts(sst)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(scs))
+	checkVersion(sst, "v0")
+
+	// The instances are migrated by block 5.
+	sst.index = 4
+	scs, err = s.upgradeContracts(sst)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(scs))
+	for i, v := range []string{"a-v1", "b-v1"} {
+		val, ver, _, _, err := sst.GetValues(ids[i].Slice())
+		require.NoError(t, err)
+		require.Equal(t, v, string(val))
+		require.Equal(t, uint64(1), ver)
+	}
+	val, ver, _, _, err := sst.GetValues(ids[2].Slice())
+	require.NoError(t, err)
+	require.Equal(t, "c", string(val))
+	require.Equal(t, uint64(0), ver)
+	checkVersion(sst, "v1")
+
+	// The migration is done only once.
+	sst.index = 5
+	scs, err = s.upgradeContracts(sst)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(scs))
+
+	// A failing migration drops the upgrade.
+	config, err = loadConfigFromTrie(sst)
+	require.NoError(t, err)
+	require.Error(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 1, 10)))
+	require.NoError(t, s.addContractUpgrade(sst, config, upgradeArgs("upgradable", 2, 10)))
+	storeConfig(config)
+	sst.index = 9
+	scs, err = s.upgradeContracts(sst)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(scs))
+	config, err = loadConfigFromTrie(sst)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(config.ContractUpgrades))
+	checkVersion(sst, "v1")
+
+	// The upgrades cannot be changed by update_config.
+	newConfig := *config
+	require.NoError(t, config.CheckUpdate(newConfig))
+	newConfig.ContractUpgrades = nil
+	require.Error(t, config.CheckUpdate(newConfig))
+}
@@ -0,0 +1,118 @@
+package byzcoin
+
+import (
+	"crypto/sha256"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/dedis/protobuf"
+)
+
+// actionUsage records the time of the instructions with an action on a darc,
+// for the rate conditions of the rule of the action. Only the times in the
+// largest window of the rule are kept.
+type actionUsage struct {
+	// Times are the timestamps of the blocks of the instructions, in
+	// nanoseconds.
+	Times []int64
+}
+
+// count returns the number of uses after since.
+func (u actionUsage) count(since int64) int {
+	var n int
+	for _, t := range u.Times {
+		if t > since {
+			n++
+		}
+	}
+	return n
+}
+
+// getActionUsage returns the uses of the action on the darc.
+func getActionUsage(st ReadOnlyStateTrie, darcID darc.ID, action string) (actionUsage, error) {
+	var u actionUsage
+	val, _, _, _, err := st.GetValues(actionUsageKey(darcID, action))
+	if err == errKeyNotSet {
+		return u, nil
+	}
+	if err != nil {
+		return u, err
+	}
+	err = protobuf.Decode(val, &u)
+	return u, err
+}
+
+// updateActionUsage returns the state changes that record the execution of
+// the instruction, if the rule of its action, or the sign expression of a
+// darc it delegates to, has a rate condition. The instructions on instances
+// without darc, like the genesis one, are not recorded.
+func updateActionUsage(st ReadOnlyStateTrie, instr Instruction) (StateChanges, error) {
+	d, err := getInstanceDarc(st, instr.InstanceID)
+	if err != nil {
+		return nil, nil
+	}
+	window := rateWindow(d.Rules.Get(darc.Action(instr.Action())), darcGetter(st))
+	if window == 0 {
+		return nil, nil
+	}
+	u, err := getActionUsage(st, d.GetBaseID(), instr.Action())
+	if err != nil {
+		return nil, err
+	}
+	now := st.GetTimestamp()
+	var times []int64
+	for _, t := range u.Times {
+		if t > now-int64(window) {
+			times = append(times, t)
+		}
+	}
+	buf, err := protobuf.Encode(&actionUsage{Times: append(times, now)})
+	if err != nil {
+		return nil, err
+	}
+	return StateChanges{guardStateChange(st, actionUsageKey(d.GetBaseID(), instr.Action()), buf)}, nil
+}
+
+// rateWindow returns the largest window of the rate conditions of the
+// expression, or 0 if there are none. The sign expressions of the darcs it
+// delegates to are evaluated against the same uses, so their rate
+// conditions are included.
+func rateWindow(expr expression.Expr, getDarc darc.GetDarc) time.Duration {
+	return rateWindowVisited(expr, getDarc, make(map[string]bool))
+}
+
+func rateWindowVisited(expr expression.Expr, getDarc darc.GetDarc, visited map[string]bool) time.Duration {
+	var window time.Duration
+	var delegated []expression.Expr
+	Y := expression.InitParserWithConditions(func(s string) bool {
+		if strings.HasPrefix(s, "darc:") && !visited[s] {
+			visited[s] = true
+			if d := getDarc(s, true); d != nil && d.Rules.Contains(darc.Action("_sign")) {
+				delegated = append(delegated, d.Rules.GetSignExpr())
+			}
+		}
+		return true
+	}, func(c expression.Condition) bool {
+		if c.Name == expression.CondRate && c.Window > window {
+			window = c.Window
+		}
+		return true
+	})
+	expression.Evaluate(Y, expr)
+	for _, e := range delegated {
+		if w := rateWindowVisited(e, getDarc, visited); w > window {
+			window = w
+		}
+	}
+	return window
+}
+
+func actionUsageKey(darcID darc.ID, action string) []byte {
+	h := sha256.New()
+	h.Write([]byte("actionusage_"))
+	h.Write(darcID)
+	h.Write([]byte(action))
+	return h.Sum(nil)
+}
@@ -0,0 +1,130 @@
+package byzcoin
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+// TestActionUsage_Conditions delegates a limited spending right: the signer
+// can transfer at most 1000 coins at once, twice per hour, until 2027.
+func TestActionUsage_Conditions(t *testing.T) {
+	sst, err := newMemStagingStateTrie([]byte("my nonce"))
+	require.NoError(t, err)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{signer.Identity()},
+		[]darc.Identity{signer.Identity()}), []byte("conditions"))
+	require.NoError(t, d.Rules.AddRule("invoke:transfer", expression.Expr(signer.Identity().String()+
+		" & before(2027-01-01) & arg(coins) <= 1000 & rate(2/1h)")))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+	id := NewInstanceID(d.GetBaseID())
+	require.NoError(t, sst.StoreAll(StateChanges{NewStateChange(Create, id, ContractDarcID, dBuf, d.GetBaseID())}))
+	sst.timestamp = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	var counter uint64
+	transfer := func(coins uint64) error {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, coins)
+		instr := Instruction{
+			InstanceID: id,
+			Invoke: &Invoke{
+				Command: "transfer",
+				Args:    Arguments{{Name: "coins", Value: buf}},
+			},
+			SignerCounter: []uint64{counter + 1},
+		}
+		msg := Instructions{instr}.Hash()
+		require.NoError(t, instr.SignWith(msg, signer))
+		if err := instr.Verify(sst, msg); err != nil {
+			return err
+		}
+		scs, err := updateReplayGuard(sst, instr)
+		require.NoError(t, err)
+		usageScs, err := updateActionUsage(sst, instr)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(usageScs))
+		require.NoError(t, sst.StoreAll(append(scs, usageScs...)))
+		counter++
+		return nil
+	}
+
+	require.NoError(t, transfer(1000))
+	require.Error(t, transfer(1001))
+	require.NoError(t, transfer(10))
+	// Only two transfers per hour.
+	require.Error(t, transfer(10))
+	sst.timestamp += int64(30 * time.Minute)
+	require.Error(t, transfer(10))
+	sst.timestamp += int64(30 * time.Minute)
+	require.NoError(t, transfer(10))
+	u, err := getActionUsage(sst, d.GetBaseID(), "invoke:transfer")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(u.Times))
+
+	// The right expires.
+	sst.timestamp = time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	require.Error(t, transfer(10))
+
+	// An action without rate condition is not recorded.
+	usageScs, err := updateActionUsage(sst, Instruction{InstanceID: id, Invoke: &Invoke{Command: "evolve"}})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(usageScs))
+}
+
+// TestActionUsage_Delegated limits the uses of an action with a rate
+// condition in the sign expression of the delegated darc only.
+func TestActionUsage_Delegated(t *testing.T) {
+	sst, err := newMemStagingStateTrie([]byte("my nonce"))
+	require.NoError(t, err)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	delegate := darc.NewDarc(darc.InitRules([]darc.Identity{signer.Identity()},
+		[]darc.Identity{signer.Identity()}), []byte("delegate"))
+	require.NoError(t, delegate.Rules.UpdateSign(expression.Expr(signer.Identity().String()+" & rate(2/1h)")))
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{signer.Identity()},
+		[]darc.Identity{signer.Identity()}), []byte("delegating"))
+	require.NoError(t, d.Rules.AddRule("invoke:transfer", expression.Expr(darc.NewIdentityDarc(delegate.GetBaseID()).String())))
+	for _, dd := range []*darc.Darc{delegate, d} {
+		buf, err := dd.ToProto()
+		require.NoError(t, err)
+		require.NoError(t, sst.StoreAll(StateChanges{
+			NewStateChange(Create, NewInstanceID(dd.GetBaseID()), ContractDarcID, buf, dd.GetBaseID()),
+		}))
+	}
+	id := NewInstanceID(d.GetBaseID())
+	sst.timestamp = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	var counter uint64
+	transfer := func() error {
+		instr := Instruction{
+			InstanceID:    id,
+			Invoke:        &Invoke{Command: "transfer"},
+			SignerCounter: []uint64{counter + 1},
+		}
+		msg := Instructions{instr}.Hash()
+		require.NoError(t, instr.SignWith(msg, signer))
+		if err := instr.Verify(sst, msg); err != nil {
+			return err
+		}
+		scs, err := updateReplayGuard(sst, instr)
+		require.NoError(t, err)
+		usageScs, err := updateActionUsage(sst, instr)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(usageScs))
+		require.NoError(t, sst.StoreAll(append(scs, usageScs...)))
+		counter++
+		return nil
+	}
+
+	require.NoError(t, transfer())
+	require.NoError(t, transfer())
+	require.Error(t, transfer())
+	sst.timestamp += int64(time.Hour)
+	require.NoError(t, transfer())
+}
@@ -2,6 +2,8 @@ package byzcoin
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"math"
 	"sync"
@@ -23,11 +25,15 @@ import (
 type viewChangeManager struct {
 	sync.Mutex
 	controllers map[string]*viewchange.Controller
+	// failures holds the reason of the last failed view-change for every
+	// skipchain, so that operators can find out why it didn't happen.
+	failures map[string]string
 }
 
 func newViewChangeManager() viewChangeManager {
 	return viewChangeManager{
 		controllers: make(map[string]*viewchange.Controller),
+		failures:    make(map[string]string),
 	}
 }
 
@@ -105,6 +111,34 @@ func (m *viewChangeManager) waiting(k string) bool {
 	return c.Waiting()
 }
 
+// status returns the status of the controller of the given skipchain. The
+// second return value is false if no controller exists for it.
+func (m *viewChangeManager) status(scID skipchain.SkipBlockID) (viewchange.Status, bool) {
+	m.Lock()
+	defer m.Unlock()
+	c, ok := m.controllers[string(scID)]
+	if !ok {
+		return viewchange.Status{}, false
+	}
+	return c.Status(), true
+}
+
+// setFailure records the reason why a view-change failed for the given
+// skipchain.
+func (m *viewChangeManager) setFailure(scID skipchain.SkipBlockID, reason string) {
+	m.Lock()
+	defer m.Unlock()
+	m.failures[string(scID)] = reason
+}
+
+// lastFailure returns the reason of the last failed view-change for the
+// given skipchain, or an empty string if there was none.
+func (m *viewChangeManager) lastFailure(scID skipchain.SkipBlockID) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.failures[string(scID)]
+}
+
 func (m *viewChangeManager) closeAll() {
 	m.Lock()
 	defer m.Unlock()
@@ -150,6 +184,7 @@ func (s *Service) sendNewView(proof []viewchange.InitReq) {
 
 	if len(proof) == 0 {
 		log.Error(s.ServerIdentity(), "not enough proofs")
+		return
 	}
 	log.Lvl2(s.ServerIdentity(), "sending new-view request for view:", proof[0].View)
 
@@ -171,17 +206,21 @@ func (s *Service) sendNewView(proof []viewchange.InitReq) {
 		defer s.working.Done()
 		// This go-routine eventually exists because both cosi and
 		// block creation have a timeout.
+		gen := proof[0].View.Gen
 		sig, err := s.startViewChangeCosi(req)
 		if err != nil {
 			log.Error(s.ServerIdentity(), "Error while starting view-change:", err)
+			s.viewChangeMan.setFailure(gen, "couldn't start view-change cosi: "+err.Error())
 			return
 		}
 		if len(sig) == 0 {
 			log.Error(s.ServerIdentity(), "empty viewchange cosi signature")
+			s.viewChangeMan.setFailure(gen, "empty view-change cosi signature")
 			return
 		}
 		if err := s.createViewChangeBlock(req, sig); err != nil {
 			log.Error(s.ServerIdentity(), err)
+			s.viewChangeMan.setFailure(gen, "couldn't create view-change block: "+err.Error())
 		}
 	}()
 }
@@ -299,21 +338,35 @@ func (s *Service) verifyViewChange(msg []byte, data []byte) bool {
 		log.Error(s.ServerIdentity(), err)
 		return false
 	}
-	if !bytes.Equal(msg, req.Hash()) {
-		log.Error(s.ServerIdentity(), "digest doesn't verify")
+	if err := s.verifyNewViewReq(msg, req); err != nil {
+		log.Error(s.ServerIdentity(), err)
+		if gen := req.GetGen(); gen != nil {
+			s.viewChangeMan.setFailure(gen, "verification failed: "+err.Error())
+		}
 		return false
 	}
+	log.Lvl2(s.ServerIdentity(), "view-change verification OK")
+	return true
+}
+
+// verifyNewViewReq checks that the new-view request is valid and matches the
+// digest msg that is signed by the view-change ftcosi.
+func (s *Service) verifyNewViewReq(msg []byte, req viewchange.NewViewReq) error {
+	if !bytes.Equal(msg, req.Hash()) {
+		return errors.New("digest doesn't verify")
+	}
+	if req.GetView() == nil {
+		return errors.New("no proofs in request")
+	}
 	// Check that we know about the view and the new roster in the request
 	// matches the view-change proofs.
 	sb := s.db().GetByID(req.GetView().ID)
 	if sb == nil {
-		log.Error(s.ServerIdentity(), "view does not exist")
-		return false
+		return errors.New("view does not exist")
 	}
 	newRosterID := rotateRoster(sb.Roster, req.GetView().LeaderIndex).ID
 	if !newRosterID.Equal(req.Roster.ID) {
-		log.Error(s.ServerIdentity(), "invalid roster in request")
-		return false
+		return errors.New("invalid roster in request")
 	}
 	// Check the signers are unique, they are in the roster and the
 	// signatures are correct.
@@ -328,12 +381,10 @@ func (s *Service) verifyViewChange(msg []byte, data []byte) bool {
 	}()
 	f := len(sb.Roster.List) / 3
 	if uniqueSigners < 2*f+1 {
-		log.Error(s.ServerIdentity(), "not enough proofs")
-		return false
+		return errors.New("not enough proofs")
 	}
 	if uniqueViews != 1 {
-		log.Error(s.ServerIdentity(), "conflicting views")
-		return false
+		return errors.New("conflicting views")
 	}
 	// Put the roster in a map so that it's more efficient to search.
 	rosterMap := make(map[network.ServerIdentityID]*network.ServerIdentity)
@@ -343,17 +394,14 @@ func (s *Service) verifyViewChange(msg []byte, data []byte) bool {
 	for _, p := range req.Proof {
 		sid, ok := rosterMap[p.SignerID]
 		if !ok {
-			log.Error(s.ServerIdentity(), "the signer is not in the roster")
-			return false
+			return errors.New("the signer is not in the roster")
 		}
 		// Check that the signature is correct.
 		if err := schnorr.Verify(cothority.Suite, sid.Public, p.Hash(), p.Signature); err != nil {
-			log.Error(s.ServerIdentity(), err)
-			return false
+			return err
 		}
 	}
-	log.Lvl2(s.ServerIdentity(), "view-change verification OK")
-	return true
+	return nil
 }
 
 // createViewChangeBlock creates a new block to record the successful
@@ -379,7 +427,7 @@ func (s *Service) createViewChangeBlock(req viewchange.NewViewReq, multisig []by
 	if err != nil {
 		return err
 	}
-	ctr, err := getSignerCounter(st, signer.Identity().String())
+	config, err := loadConfigFromTrie(st)
 	if err != nil {
 		return err
 	}
@@ -400,17 +448,49 @@ func (s *Service) createViewChangeBlock(req viewchange.NewViewReq, multisig []by
 					},
 				},
 			},
-			SignerCounter: []uint64{ctr + 1},
 		}},
 	}
+	if config.ReplayProtection == ReplayNonce {
+		ctx.Instructions[0].SetNonce(uint64(st.GetIndex()+1) + config.NonceMaxExpiry)
+	} else {
+		ctr, err := getSignerCounter(st, signer.Identity().String())
+		if err != nil {
+			return err
+		}
+		ctx.Instructions[0].SignerCounter = []uint64{ctr + 1}
+	}
 	if err = ctx.Instructions[0].SignWith(ctx.Instructions.Hash(), signer); err != nil {
 		return err
 	}
 
-	_, err = s.createNewBlock(req.GetGen(), rotateRoster(sb.Roster, req.GetView().LeaderIndex), []TxResult{TxResult{ctx, false}})
+	_, err = s.createNewBlock(req.GetGen(), rotateRoster(sb.Roster, req.GetView().LeaderIndex), []TxResult{TxResult{ctx, false}}, time.Now().UnixNano())
 	return err
 }
 
+// Hash computes the digest that is signed in a RequestViewChange.
+func (req RequestViewChange) Hash() []byte {
+	h := sha256.New()
+	h.Write(req.ByzCoinID)
+	h.Write(req.LatestID)
+	idxBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(idxBuf, uint32(req.LeaderIndex))
+	h.Write(idxBuf)
+	return h.Sum(nil)
+}
+
+// Sign signs the request with the given signer.
+func (req *RequestViewChange) Sign(signer darc.Signer) error {
+	sig, err := signer.Sign(req.Hash())
+	if err != nil {
+		return err
+	}
+	req.Signature = darc.Signature{
+		Signature: sig,
+		Signer:    signer.Identity(),
+	}
+	return nil
+}
+
 // getPrivateKey returns the default private key of the server
 // that is used to sign schnorr signatures for the view change
 // protocol
@@ -16,6 +16,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/dedis/cothority"
@@ -83,6 +84,7 @@ type Controller struct {
 	reqChan          chan InitReq
 	doneChan         chan View
 	waiting          chan chan bool
+	status           chan chan Status
 	closeMonitorChan chan bool
 	sendInitReq      SendInitReqFunc
 	sendNewViewReq   SendNewViewReqFunc
@@ -101,6 +103,7 @@ func NewController(sendInitReq SendInitReqFunc, sendNewView SendNewViewReqFunc,
 		reqChan:          make(chan InitReq, 1),
 		doneChan:         make(chan View, 1),
 		waiting:          make(chan chan bool, 1),
+		status:           make(chan chan Status, 1),
 		closeMonitorChan: make(chan bool),
 		sendInitReq:      sendInitReq,
 		sendNewViewReq:   sendNewView,
@@ -222,6 +225,8 @@ func (c *Controller) Start(myID network.ServerIdentityID, genesis skipchain.Skip
 			} else {
 				ch <- false
 			}
+		case ch := <-c.status:
+			ch <- meta.status(ctr)
 		case <-c.closeMonitorChan:
 			stopTimer(timer, c.stopTimerChan, ctr)
 			return
@@ -276,6 +281,35 @@ func (c *Controller) Waiting() bool {
 	return <-ch
 }
 
+// Status returns a snapshot of the current state of the controller. It can be
+// used to inspect which views are pending and how many requests have been
+// received for each of them.
+func (c *Controller) Status() Status {
+	ch := make(chan Status, 1)
+	c.status <- ch
+	return <-ch
+}
+
+// Status is a snapshot of the internal state of the Controller.
+type Status struct {
+	// Ctr is the leader index of the view that the controller is
+	// currently processing, it is 0 when no view-change is in progress.
+	Ctr int
+	// Logs holds the requests received for every pending view, sorted by
+	// leader index.
+	Logs []StatusLog
+}
+
+// StatusLog holds the view-change requests that have been accumulated for
+// one view.
+type StatusLog struct {
+	View     View
+	Requests []InitReq
+	// TimerStarted is true if 2f+1 requests have been received and the
+	// controller is waiting for the view-change to complete.
+	TimerStarted bool
+}
+
 // InitReq is the request that is sent by SendInitReqFunc. It is the
 // "view-change" message from the PBFT paper.
 type InitReq struct {
@@ -456,6 +490,21 @@ func (m stateLogs) getProof(viewIdx int) []InitReq {
 	return reqs
 }
 
+func (m stateLogs) status(ctr int) Status {
+	st := Status{Ctr: ctr}
+	for k, l := range m.m {
+		st.Logs = append(st.Logs, StatusLog{
+			View:         l.curr,
+			Requests:     m.getProof(k),
+			TimerStarted: l.state == startedTimerState,
+		})
+	}
+	sort.Slice(st.Logs, func(i, j int) bool {
+		return st.Logs[i].View.LeaderIndex < st.Logs[j].View.LeaderIndex
+	})
+	return st
+}
+
 func (m stateLogs) empty() bool {
 	return len(m.m) == 0
 }
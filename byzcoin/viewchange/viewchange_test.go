@@ -24,6 +24,32 @@ func TestViewChange_Timeout2(t *testing.T) {
 	testTimeout(t, 2)
 }
 
+func TestViewChange_Status(t *testing.T) {
+	dur := 100 * time.Millisecond
+	f := 1
+	mySignerID := [16]byte{byte(255)}
+	_, _, view, vcl := testSetupViewChange2F1(t, mySignerID, dur, f)
+	defer vcl.Stop()
+
+	st := vcl.Status()
+	require.Equal(t, view.LeaderIndex, st.Ctr)
+	require.Equal(t, 1, len(st.Logs))
+	require.True(t, st.Logs[0].View.Equal(view))
+	require.Equal(t, 2*f+1, len(st.Logs[0].Requests))
+	require.True(t, st.Logs[0].TimerStarted)
+
+	// Once the view-change is done, the status must be reset.
+	vcl.Done(view)
+	select {
+	case <-vcl.stopTimerChan:
+	case <-time.After(dur):
+		require.Fail(t, "timer should have stopped on done")
+	}
+	st = vcl.Status()
+	require.Equal(t, 0, st.Ctr)
+	require.Equal(t, 0, len(st.Logs))
+}
+
 func TestViewChange_AutoStart1(t *testing.T) {
 	testAutoStart(t, 1)
 }
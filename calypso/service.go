@@ -70,6 +70,9 @@ func init() {
 	log.ErrFatal(err)
 	calypsoID, err = onet.RegisterNewService(ServiceName, newService)
 	log.ErrFatal(err)
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractWriteID, contractWriteFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractReadID, contractReadFromBytes))
+	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractLongTermSecretID, contractLTSFromBytes))
 	network.RegisterMessages(&storage{}, &vData{})
 
 	// The loopback check makes Java testing not work, because Java client commands
@@ -665,9 +668,6 @@ func newService(c *onet.Context) (onet.Service, error) {
 		s.GetLTSReply, s.Authorise); err != nil {
 		return nil, errors.New("couldn't register messages")
 	}
-	byzcoin.RegisterContract(c, ContractWriteID, contractWriteFromBytes)
-	byzcoin.RegisterContract(c, ContractReadID, contractReadFromBytes)
-	byzcoin.RegisterContract(c, ContractLongTermSecretID, contractLTSFromBytes)
 	if err := s.tryLoad(); err != nil {
 		log.Error(err)
 		return nil, err
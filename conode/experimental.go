@@ -14,4 +14,5 @@ import (
 	_ "github.com/dedis/cothority/evoting/service"
 	_ "github.com/dedis/cothority/identity"
 	_ "github.com/dedis/cothority/personhood"
+	_ "github.com/dedis/cothority/sigcollect"
 )
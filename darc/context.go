@@ -0,0 +1,84 @@
+package darc
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/dedis/cothority/darc/expression"
+)
+
+// Context is the context of a request, against which the conditions of the
+// expressions are checked. A condition that needs a missing field evaluates
+// to false.
+type Context struct {
+	// Time is the time of the request.
+	Time time.Time
+	// Arg returns the value of an argument of the request, or nil if the
+	// argument is missing.
+	Arg func(name string) []byte
+	// Uses returns the number of earlier requests with the same action on
+	// the same darc in the window before Time.
+	Uses func(window time.Duration) int
+	// Height is the block height of the request, or 0 if it is unknown.
+	Height uint64
+	// Darc is the darc of the evaluated rule. If it is set, the latest
+	// version of the darc restricts the delegations of the rule.
+	Darc *Darc
+}
+
+// check evaluates a condition. The arguments compared to numbers must be
+// unsigned 64-bit integers in little endian, the arguments compared with in
+// are compared as strings.
+func (ctx *Context) check(c expression.Condition) bool {
+	switch c.Name {
+	case expression.CondBefore:
+		return !ctx.Time.IsZero() && ctx.Time.Before(c.Time)
+	case expression.CondAfter:
+		return !ctx.Time.IsZero() && !ctx.Time.Before(c.Time)
+	case expression.CondRate:
+		if ctx.Uses == nil {
+			return false
+		}
+		return ctx.Uses(c.Window) < c.Count
+	case expression.CondArg:
+		if ctx.Arg == nil {
+			return false
+		}
+		arg := ctx.Arg(c.Arg)
+		if arg == nil {
+			return false
+		}
+		if c.Op == "in" {
+			for _, v := range c.Values {
+				if v == string(arg) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(arg) != 8 {
+			return false
+		}
+		a := binary.LittleEndian.Uint64(arg)
+		v, err := strconv.ParseUint(c.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		switch c.Op {
+		case "<":
+			return a < v
+		case "<=":
+			return a <= v
+		case ">":
+			return a > v
+		case ">=":
+			return a >= v
+		case "==":
+			return a == v
+		case "!=":
+			return a != v
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package darc
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Conditions(t *testing.T) {
+	owner := createIdentity()
+	coins := make([]byte, 8)
+	binary.LittleEndian.PutUint64(coins, 1000)
+	uses := 0
+	ctx := &Context{
+		Time: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		Arg: func(name string) []byte {
+			switch name {
+			case "coins":
+				return coins
+			case "type":
+				return []byte("gold")
+			}
+			return nil
+		},
+		Uses: func(window time.Duration) int {
+			return uses
+		},
+	}
+	eval := func(cond string) error {
+		return EvalExprContext(expression.Expr(owner.String()+" & "+cond), nil, ctx, owner.String())
+	}
+
+	require.Nil(t, eval("before(2027-01-01)"))
+	require.NotNil(t, eval("before(2026-10-18)"))
+	require.Nil(t, eval("after(2026-10-18)"))
+	require.NotNil(t, eval("after(2026-10-18T00:00:01Z)"))
+	require.Nil(t, eval("arg(coins) <= 1000"))
+	require.NotNil(t, eval("arg(coins) < 1000"))
+	require.Nil(t, eval("arg(coins) != 999"))
+	require.NotNil(t, eval("arg(type) <= 1000"))
+	require.NotNil(t, eval("arg(missing) >= 0"))
+	require.Nil(t, eval("arg(type) in (silver, gold)"))
+	require.NotNil(t, eval("arg(coins) in (gold)"))
+	require.Nil(t, eval("rate(2/1h)"))
+	uses = 2
+	require.NotNil(t, eval("rate(2/1h)"))
+
+	// The conditions are false without a context.
+	require.NotNil(t, EvalExpr(expression.Expr(owner.String()+" & before(2027-01-01)"), nil, owner.String()))
+	require.Nil(t, EvalExpr(expression.Expr(owner.String()+" | before(2027-01-01)"), nil, owner.String()))
+}
+
+// TestContext_Delegation checks that the conditions of the sign expression
+// of a delegated darc use the context of the request.
+func TestContext_Delegation(t *testing.T) {
+	owner := createIdentity()
+	d := NewDarc(InitRules([]Identity{owner}, []Identity{owner}), []byte("delegated"))
+	require.Nil(t, d.Rules.UpdateSign(expression.Expr(owner.String()+" & before(2027-01-01)")))
+	getDarc := DarcsToGetDarcs([]*Darc{d})
+	expr := expression.Expr(d.GetIdentityString())
+
+	ctx := &Context{Time: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)}
+	require.Nil(t, EvalExprContext(expr, getDarc, ctx, owner.String()))
+	ctx.Time = time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NotNil(t, EvalExprContext(expr, getDarc, ctx, owner.String()))
+	require.NotNil(t, EvalExpr(expr, getDarc, owner.String()))
+}
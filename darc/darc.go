@@ -38,6 +38,7 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
@@ -104,6 +105,21 @@ func InitRulesWith(owners, signers []Identity, evolveAction Action) Rules {
 	return rs
 }
 
+// InitRulesWithThreshold initialise a set of rules like InitRules, except
+// that at least k of the signers are needed under "_sign". It panics if k is
+// not between 1 and the number of signers.
+func InitRulesWithThreshold(owners []Identity, k int, signers []Identity) Rules {
+	rs := InitRules(owners, signers)
+	expr, err := thresholdExpr(k, signers)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := rs.UpdateSign(expr); err != nil {
+		panic("update rule should never fail on an existing rule: " + err.Error())
+	}
+	return rs
+}
+
 // NewDarc initialises a darc-structure given its owners and users. Note that
 // the BaseID is empty if the Version is 0, it must be computed using
 // GetBaseID.
@@ -131,6 +147,19 @@ func (d *Darc) Copy() *Darc {
 		dCopy.VerificationDarcs[i] = d.VerificationDarcs[i]
 	}
 	dCopy.Rules = d.Rules.Copy()
+	if len(d.Delegations) > 0 {
+		dCopy.Delegations = make([]Delegation, len(d.Delegations))
+		for i, del := range d.Delegations {
+			dCopy.Delegations[i] = Delegation{
+				Darc:         copyBytes(del.Darc),
+				Expiry:       del.Expiry,
+				ExpiryHeight: del.ExpiryHeight,
+			}
+		}
+	}
+	for _, id := range d.Revocations {
+		dCopy.Revocations = append(dCopy.Revocations, copyBytes(id))
+	}
 	return dCopy
 }
 
@@ -178,6 +207,16 @@ func (d Darc) GetID() ID {
 		h.Write([]byte(rule.Action))
 		h.Write(rule.Expr)
 	}
+	for _, del := range d.Delegations {
+		h.Write(del.Darc)
+		binary.LittleEndian.PutUint64(verBytes, uint64(del.Expiry))
+		h.Write(verBytes)
+		binary.LittleEndian.PutUint64(verBytes, del.ExpiryHeight)
+		h.Write(verBytes)
+	}
+	for _, id := range d.Revocations {
+		h.Write(id)
+	}
 	return h.Sum(nil)
 }
 
@@ -208,6 +247,42 @@ func (r *Rules) AddRule(a Action, expr expression.Expr) error {
 	return nil
 }
 
+// AddThresholdRule adds a new action whose expression is satisfied by at
+// least k of the identities, the action must not exist.
+func (r *Rules) AddThresholdRule(a Action, k int, ids ...Identity) error {
+	expr, err := thresholdExpr(k, ids)
+	if err != nil {
+		return err
+	}
+	return r.AddRule(a, expr)
+}
+
+// UpdateThresholdRule updates an existing action so that it is satisfied by
+// at least k of the identities, it cannot be the evolve or sign action.
+func (r *Rules) UpdateThresholdRule(a Action, k int, ids ...Identity) error {
+	expr, err := thresholdExpr(k, ids)
+	if err != nil {
+		return err
+	}
+	return r.UpdateRule(a, expr)
+}
+
+func thresholdExpr(k int, ids []Identity) (expression.Expr, error) {
+	if k < 1 || k > len(ids) {
+		return nil, fmt.Errorf("threshold %d is not between 1 and %d", k, len(ids))
+	}
+	idStrs := make([]string, len(ids))
+	seen := make(map[string]bool)
+	for i, id := range ids {
+		idStrs[i] = id.String()
+		if seen[idStrs[i]] {
+			return nil, fmt.Errorf("identity %s is given twice", idStrs[i])
+		}
+		seen[idStrs[i]] = true
+	}
+	return expression.InitThresholdExpr(k, idStrs...), nil
+}
+
 // UpdateRule updates an existing action-expression pair, it cannot be the
 // evolve or sign action.
 func (r *Rules) UpdateRule(a Action, expr expression.Expr) error {
@@ -441,7 +516,7 @@ func (r *Request) VerifyWithCB(d *Darc, getDarc GetDarc) error {
 		}
 	}
 	validIDs := r.GetIdentityStrings()
-	err := EvalExpr(d.Rules.Get(r.Action), getDarc, validIDs...)
+	err := EvalExprForDarc(d.Rules.Get(r.Action), d, getDarc, false, validIDs...)
 	if err != nil {
 		return err
 	}
@@ -454,6 +529,18 @@ func (d Darc) String() string {
 	for _, v := range d.Rules.List {
 		s += fmt.Sprintf("\n\t%s - \"%s\"", v.Action, v.Expr)
 	}
+	if len(d.Delegations) > 0 {
+		s += "\nDelegations:"
+		for _, del := range d.Delegations {
+			s += fmt.Sprintf("\n\tdarc:%x - expiry: %d, height: %d", del.Darc, del.Expiry, del.ExpiryHeight)
+		}
+	}
+	if len(d.Revocations) > 0 {
+		s += "\nRevocations:"
+		for _, id := range d.Revocations {
+			s += fmt.Sprintf("\n\tdarc:%x", id)
+		}
+	}
 	s += "\nSignatures:"
 	for i, sig := range d.Signatures {
 		s += fmt.Sprintf("\n\t%d - id: %s, sig: %x", i, sig.Signer.String(), sig.Signature)
@@ -536,10 +623,11 @@ func verifyOneEvolution(newDarc, prevDarc *Darc, getDarc func(string, bool) *Dar
 	}
 
 	// check that signers have the permission
-	if err := EvalExprWithSigs(
-		prevDarc.Rules.GetEvolutionExpr(),
-		getDarc,
-		newDarc.Signatures...); err != nil {
+	signers := make([]string, len(newDarc.Signatures))
+	for i, sig := range newDarc.Signatures {
+		signers[i] = sig.Signer.String()
+	}
+	if err := EvalExprForDarc(prevDarc.Rules.GetEvolutionExpr(), prevDarc, getDarc, false, signers...); err != nil {
 		return err
 	}
 
@@ -596,53 +684,144 @@ func EvalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
 
 // EvalExprDarc checks whether the expression evaluates to true given a list of
 // identities. It takes 'acceptDarc', and, if it is true, doesn't recurse into
-// darcs that fit one of the ids.
+// darcs that fit one of the ids. Only the delegations of the delegated darcs
+// are checked, EvalExprForDarc also checks the ones of the darc of the rule.
 func EvalExprDarc(expr expression.Expr, getDarc GetDarc, acceptDarc bool, ids ...string) error {
-	Y := expression.InitParser(func(s string) bool {
+	return EvalExprForDarc(expr, nil, getDarc, acceptDarc, ids...)
+}
+
+// EvalExprForDarc checks, like EvalExprDarc, whether the expression of a
+// rule of the darc d evaluates to true given a list of identities. The
+// delegations of d are restricted by the expiries and the revocations of its
+// latest version, found with getDarc. As there is no context, a delegation
+// that expires is not valid. If d is nil, it is the same as EvalExprDarc.
+func EvalExprForDarc(expr expression.Expr, d *Darc, getDarc GetDarc, acceptDarc bool, ids ...string) error {
+	_, err := evalExprTrace(expr, latestDarc(d, getDarc), getDarc, acceptDarc, nil, ids...)
+	return err
+}
+
+// EvalExprContext checks whether the expression evaluates to true given a
+// list of identities and the context of the request, against which the
+// conditions of the expression are checked. The conditions in the sign
+// expressions of the delegated darcs are checked against the same context.
+func EvalExprContext(expr expression.Expr, getDarc GetDarc, ctx *Context, ids ...string) error {
+	_, err := EvalExprTrace(expr, getDarc, false, ctx, ids...)
+	return err
+}
+
+// EvalExprTrace evaluates the expression like EvalExprDarc, with the
+// conditions checked against ctx if it is not nil, and returns the trace of
+// the evaluation, which follows the delegations to other darcs. The trace is
+// returned even if the evaluation fails.
+//
+// The delegations to other darcs are restricted by the expiries and the
+// revocations of the delegating darc: the darc of the rule, if it is given in
+// ctx, and the delegated darcs for their sign expressions.
+func EvalExprTrace(expr expression.Expr, getDarc GetDarc, acceptDarc bool, ctx *Context, ids ...string) (*EvalTrace, error) {
+	var delegator *Darc
+	if ctx != nil {
+		delegator = latestDarc(ctx.Darc, getDarc)
+	}
+	return evalExprTrace(expr, delegator, getDarc, acceptDarc, ctx, ids...)
+}
+
+// latestDarc returns the latest version of d found with getDarc, or d if it
+// cannot be found. The delegations are restricted by the latest version, so
+// that a revocation takes effect immediately.
+func latestDarc(d *Darc, getDarc GetDarc) *Darc {
+	if d == nil || getDarc == nil {
+		return d
+	}
+	if latest := getDarc(NewIdentityDarc(d.GetBaseID()).String(), true); latest != nil {
+		return latest
+	}
+	return d
+}
+
+// evalExprTrace evaluates the expression of a rule of the delegator, whose
+// delegations are checked if it is not nil.
+func evalExprTrace(expr expression.Expr, delegator *Darc, getDarc GetDarc, acceptDarc bool, ctx *Context,
+	ids ...string) (*EvalTrace, error) {
+	trace := &EvalTrace{Expr: expr}
+	cfn := func(c expression.Condition) bool {
+		match := ctx != nil && ctx.check(c)
+		trace.Terms = append(trace.Terms, TermTrace{Term: c.String(), Match: match})
+		return match
+	}
+	fn := func(s string) bool {
 		found := false
 		for _, id := range ids {
 			if id == s {
 				found = true
 			}
 		}
+		term := TermTrace{Term: s, Match: found}
+		defer func() {
+			trace.Terms = append(trace.Terms, term)
+		}()
 		if strings.HasPrefix(s, "darc") {
 			if acceptDarc && found {
+				if delegator != nil {
+					if id, err := hex.DecodeString(strings.TrimPrefix(s, "darc:")); err == nil {
+						if err := delegator.checkDelegation(id, ctx); err != nil {
+							term.Match = false
+							term.Delegation = &DelegationTrace{BaseID: id, Error: err.Error()}
+							return false
+						}
+					}
+				}
 				return true
 			}
 			// getDarc is responsible for returning the latest Darc
 			d := getDarc(s, true)
 			if d == nil {
+				term.Delegation = &DelegationTrace{Error: "darc not found"}
 				return false
 			}
+			term.Delegation = &DelegationTrace{BaseID: d.GetBaseID(), Version: d.Version}
+			if delegator != nil {
+				if err := delegator.checkDelegation(d.GetBaseID(), ctx); err != nil {
+					term.Delegation.Error = err.Error()
+					return false
+				}
+			}
 			// Evaluate the "sign" action only in the latest darc
 			// because it may have revoked some rules in earlier
 			// darcs. We do this recursively because there may be
 			// further delegations.
 			if !d.Rules.Contains(sign) {
+				term.Delegation.Error = "no sign rule"
 				return false
 			}
 			signExpr := d.Rules.GetSignExpr()
 			if bytes.Compare(expr, signExpr) == 0 {
 				log.Warn("Recursive expression!")
+				term.Delegation.Error = "recursive expression"
 				return false
 			}
 			// Recursively evaluate the sign expression until we
 			// find the final signer.
-			if err := EvalExprDarc(signExpr, getDarc, acceptDarc, ids...); err != nil {
-				return false
-			}
-			return true
+			var err error
+			term.Delegation.Trace, err = evalExprTrace(signExpr, d, getDarc, acceptDarc, ctx, ids...)
+			term.Match = err == nil
+			return term.Match
 		}
 		return found
-	})
-	res, err := expression.Evaluate(Y, expr)
+	}
+	res, subs, err := expression.EvaluateTrace(expr, fn, cfn)
+	trace.Result = err == nil && res
 	if err != nil {
-		return fmt.Errorf("evaluation failed on '%s' with error: %v", expr, err)
+		trace.Error = err.Error()
+		return trace, fmt.Errorf("evaluation failed on '%s' with error: %v", expr, err)
 	}
 	if res != true {
-		return fmt.Errorf("expression '%s' evaluated to false", expr)
+		if failed := expression.FirstFailing(subs); failed != nil {
+			trace.Failed = string(failed.Expr)
+			return trace, fmt.Errorf("expression '%s' evaluated to false, '%s' failed", expr, trace.Failed)
+		}
+		return trace, fmt.Errorf("expression '%s' evaluated to false", expr)
 	}
-	return nil
+	return trace, nil
 }
 
 // Type returns an integer representing the type of key held in the signer. It
@@ -655,6 +834,12 @@ func (s Signer) Type() int {
 		return 2
 	case s.Proxy != nil:
 		return 3
+	case s.BLS != nil:
+		return 4
+	case s.Secp256k1 != nil:
+		return 5
+	case s.WebAuthn != nil:
+		return 6
 	default:
 		return -1
 	}
@@ -670,6 +855,12 @@ func (s Signer) Identity() Identity {
 		return NewIdentityX509EC(s.X509EC.Point)
 	case 3:
 		return NewIdentityProxy(s.Proxy)
+	case 4:
+		return Identity{BLS: &IdentityBLS{Public: s.BLS.Public}}
+	case 5:
+		return NewIdentitySecp256k1(s.Secp256k1.Public)
+	case 6:
+		return NewIdentityWebAuthn(s.WebAuthn.RPID, s.WebAuthn.Public)
 	default:
 		return Identity{}
 	}
@@ -689,17 +880,25 @@ func (s Signer) Sign(msg []byte) ([]byte, error) {
 		return s.X509EC.Sign(msg)
 	case 3:
 		return s.Proxy.Sign(msg)
+	case 4:
+		return s.BLS.Sign(msg)
+	case 5:
+		return s.Secp256k1.Sign(msg)
+	case 6:
+		return s.WebAuthn.Sign(msg)
 	default:
 		return nil, errors.New("unknown signer type")
 	}
 }
 
-// GetPrivate returns the private key, if one exists.
+// GetPrivate returns the private key, if one exists. Only the Ed25519
+// signers have a private key that is a scalar of cothority.Suite, the other
+// signers return an error.
 func (s Signer) GetPrivate() (kyber.Scalar, error) {
 	switch s.Type() {
 	case 1:
 		return s.Ed25519.Secret, nil
-	case 0, 2, 3:
+	case 0, 2, 3, 4, 5, 6:
 		return nil, errors.New("signer lacks a private key")
 	default:
 		return nil, errors.New("signer is of unknown type")
@@ -721,6 +920,12 @@ func (id Identity) Equal(id2 *Identity) bool {
 		return id.X509EC.Equal(id2.X509EC)
 	case 3:
 		return id.Proxy.Equal(id2.Proxy)
+	case 4:
+		return id.BLS.Equal(id2.BLS)
+	case 5:
+		return id.Secp256k1.Equal(id2.Secp256k1)
+	case 6:
+		return id.WebAuthn.Equal(id2.WebAuthn)
 	}
 	return false
 }
@@ -737,6 +942,12 @@ func (id Identity) Type() int {
 		return 2
 	case id.Proxy != nil:
 		return 3
+	case id.BLS != nil:
+		return 4
+	case id.Secp256k1 != nil:
+		return 5
+	case id.WebAuthn != nil:
+		return 6
 	}
 	return -1
 }
@@ -753,6 +964,12 @@ func (id Identity) PrimaryIdentity() bool {
 		return true
 	case id.Proxy != nil:
 		return true
+	case id.BLS != nil:
+		return true
+	case id.Secp256k1 != nil:
+		return true
+	case id.WebAuthn != nil:
+		return true
 	}
 	return false
 }
@@ -768,6 +985,12 @@ func (id Identity) TypeString() string {
 		return "x509ec"
 	case 3:
 		return "proxy"
+	case 4:
+		return "bls"
+	case 5:
+		return "secp256k1"
+	case 6:
+		return "webauthn"
 	default:
 		return "No identity"
 	}
@@ -784,6 +1007,14 @@ func (id Identity) String() string {
 		return fmt.Sprintf("%s:%x", id.TypeString(), id.X509EC.Public)
 	case 3:
 		return fmt.Sprintf("%s:%v:%v", id.TypeString(), id.Proxy.Public, id.Proxy.Data)
+	case 4:
+		return fmt.Sprintf("%s:%x", id.TypeString(), id.BLS.Public)
+	case 5:
+		return fmt.Sprintf("%s:%x", id.TypeString(), id.Secp256k1.Public)
+	case 6:
+		// The relying party is part of the string, so that a rule
+		// only accepts assertions for the relying party it names.
+		return fmt.Sprintf("%s:%x:%x", id.TypeString(), id.WebAuthn.RPID, id.WebAuthn.Public)
 	default:
 		return "No identity"
 	}
@@ -801,6 +1032,12 @@ func (id Identity) Verify(msg, sig []byte) error {
 		return id.X509EC.Verify(msg, sig)
 	case 3:
 		return id.Proxy.Verify(msg, sig)
+	case 4:
+		return id.BLS.Verify(msg, sig)
+	case 5:
+		return id.Secp256k1.Verify(msg, sig)
+	case 6:
+		return id.WebAuthn.Verify(msg, sig)
 	default:
 		return errors.New("unknown identity")
 	}
@@ -1,6 +1,7 @@
 package darc
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/dedis/cothority/darc/expression"
@@ -383,6 +384,91 @@ func TestDarc_DelegationChain(t *testing.T) {
 	require.Nil(t, td.darc.VerifyWithCB(getDarc, true))
 }
 
+// TestDarc_Threshold uses a darc whose sign rule needs 2 of 3 signers inside
+// the threshold expression of another rule.
+func TestDarc_Threshold(t *testing.T) {
+	var signers []Signer
+	var ids []Identity
+	for i := 0; i < 5; i++ {
+		s, id := createSignerIdentity()
+		signers = append(signers, s)
+		ids = append(ids, id)
+	}
+	require.Panics(t, func() { InitRulesWithThreshold(ids[:1], 4, ids[:3]) })
+	d := NewDarc(InitRulesWithThreshold(ids[:1], 2, ids[:3]), []byte("threshold"))
+	require.Equal(t, "["+ids[0].String()+", "+ids[1].String()+", "+ids[2].String()+"]/2",
+		string(d.Rules.GetSignExpr()))
+
+	rules := NewRules()
+	require.NotNil(t, rules.AddThresholdRule("invoke:a", 0, ids[3:]...))
+	require.NotNil(t, rules.AddThresholdRule("invoke:a", 3, ids[3:]...))
+	require.NotNil(t, rules.AddThresholdRule("invoke:a", 1, ids[3], ids[3]))
+	require.Nil(t, rules.AddThresholdRule("invoke:a", 2, NewIdentityDarc(d.GetID()), ids[3], ids[4]))
+	require.NotNil(t, rules.AddThresholdRule("invoke:a", 1, ids[3]))
+	require.Nil(t, rules.UpdateThresholdRule("invoke:a", 2, NewIdentityDarc(d.GetID()), ids[3], ids[4]))
+	expr := rules.Get("invoke:a")
+
+	getDarc := DarcsToGetDarcs([]*Darc{d})
+	eval := func(ss ...Signer) error {
+		var idStrs []string
+		for _, s := range ss {
+			idStrs = append(idStrs, s.Identity().String())
+		}
+		return EvalExpr(expr, getDarc, idStrs...)
+	}
+	require.Nil(t, eval(signers[3], signers[4]))
+	// The delegated darc counts once, and only with 2 of its signers.
+	require.Nil(t, eval(signers[0], signers[1], signers[3]))
+	require.NotNil(t, eval(signers[0], signers[3]))
+	require.NotNil(t, eval(signers[0], signers[1], signers[2]))
+	require.NotNil(t, eval(signers[4]))
+}
+
+// TestDarc_Trace explains why a delegation through two darcs fails.
+func TestDarc_Trace(t *testing.T) {
+	s1, id1 := createSignerIdentity()
+	_, id2 := createSignerIdentity()
+	inner := NewDarc(InitRules([]Identity{id2}, []Identity{id2}), []byte("inner"))
+	outer := NewDarc(InitRules([]Identity{id1}, []Identity{NewIdentityDarc(inner.GetBaseID())}), []byte("outer"))
+	getDarc := DarcsToGetDarcs([]*Darc{inner, outer})
+	expr := expression.Expr(id1.String() + " & " + outer.GetIdentityString())
+
+	trace, err := EvalExprTrace(expr, getDarc, false, nil, s1.Identity().String())
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "'"+outer.GetIdentityString()+"' failed")
+	require.False(t, trace.Result)
+	require.Equal(t, outer.GetIdentityString(), trace.Failed)
+	require.Equal(t, 2, len(trace.Terms))
+	require.Equal(t, id1.String(), trace.Terms[0].Term)
+	require.True(t, trace.Terms[0].Match)
+	require.Nil(t, trace.Terms[0].Delegation)
+
+	// The outer darc delegates to the inner one, which needs id2.
+	del := trace.Terms[1].Delegation
+	require.NotNil(t, del)
+	require.Equal(t, outer.GetBaseID(), del.BaseID)
+	require.Equal(t, uint64(0), del.Version)
+	require.Equal(t, 1, len(del.Trace.Terms))
+	del = del.Trace.Terms[0].Delegation
+	require.NotNil(t, del)
+	require.Equal(t, inner.GetBaseID(), del.BaseID)
+	require.Equal(t, id2.String(), del.Trace.Failed)
+	require.False(t, del.Trace.Terms[0].Match)
+
+	// A missing darc and a parsing error.
+	trace, err = EvalExprTrace(expression.Expr("darc:"+strings.Repeat("00", 32)), getDarc, false, nil)
+	require.NotNil(t, err)
+	require.Equal(t, "darc not found", trace.Terms[0].Delegation.Error)
+	trace, err = EvalExprTrace(expression.Expr("ed25519:"), getDarc, false, nil)
+	require.NotNil(t, err)
+	require.NotEqual(t, "", trace.Error)
+
+	trace, err = EvalExprTrace(expr, getDarc, true, nil, id1.String(), outer.GetIdentityString())
+	require.Nil(t, err)
+	require.True(t, trace.Result)
+	require.Equal(t, "", trace.Failed)
+}
+
 func TestDarc_X509(t *testing.T) {
 	// TODO
 }
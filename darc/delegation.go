@@ -0,0 +1,78 @@
+package darc
+
+import (
+	"errors"
+	"time"
+)
+
+// SetDelegation sets the expiry of the delegation of the rules of d to the
+// darc with the given base ID, replacing the previous expiry. A zero expiry
+// time or height means that the delegation does not expire with it. Like any
+// change of d, it only takes effect once d is evolved.
+func (d *Darc) SetDelegation(baseID ID, expiry time.Time, expiryHeight uint64) {
+	del := Delegation{Darc: copyBytes(baseID), ExpiryHeight: expiryHeight}
+	if !expiry.IsZero() {
+		del.Expiry = expiry.UnixNano()
+	}
+	for i := range d.Delegations {
+		if d.Delegations[i].Darc.Equal(baseID) {
+			d.Delegations[i] = del
+			return
+		}
+	}
+	d.Delegations = append(d.Delegations, del)
+}
+
+// RevokeDelegation revokes the delegation of the rules of d to the darc with
+// the given base ID. Once d is evolved, the darc does not fulfill the rules
+// of d anymore, even when they are evaluated with a Context holding a
+// previous version of d.
+func (d *Darc) RevokeDelegation(baseID ID) {
+	if d.isRevoked(baseID) {
+		return
+	}
+	d.Revocations = append(d.Revocations, copyBytes(baseID))
+}
+
+// ReinstateDelegation removes the darc with the given base ID from the
+// revocations of d.
+func (d *Darc) ReinstateDelegation(baseID ID) error {
+	for i, id := range d.Revocations {
+		if id.Equal(baseID) {
+			d.Revocations = append(d.Revocations[:i], d.Revocations[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("delegation is not revoked")
+}
+
+func (d *Darc) isRevoked(baseID ID) bool {
+	for _, id := range d.Revocations {
+		if id.Equal(baseID) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDelegation returns an error if the delegation of the rules of d to the
+// darc with the given base ID is revoked or expired. The expiries are checked
+// against the time and the height of ctx, a delegation that expires is not
+// valid if they are unknown.
+func (d *Darc) checkDelegation(baseID ID, ctx *Context) error {
+	if d.isRevoked(baseID) {
+		return errors.New("delegation revoked")
+	}
+	for _, del := range d.Delegations {
+		if !del.Darc.Equal(baseID) {
+			continue
+		}
+		if del.Expiry != 0 && (ctx == nil || ctx.Time.IsZero() || ctx.Time.UnixNano() >= del.Expiry) {
+			return errors.New("delegation expired")
+		}
+		if del.ExpiryHeight != 0 && (ctx == nil || ctx.Height == 0 || ctx.Height >= del.ExpiryHeight) {
+			return errors.New("delegation expired")
+		}
+	}
+	return nil
+}
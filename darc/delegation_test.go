@@ -0,0 +1,119 @@
+package darc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegation_Expiry(t *testing.T) {
+	owner := createSigner()
+	contractor := createSigner()
+	child := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{contractor.Identity()}), []byte("contractor"))
+	parent := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{owner.Identity()}), []byte("parent"))
+	require.Nil(t, parent.Rules.AddRule("spawn:x", expression.Expr(child.GetIdentityString())))
+	end := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	parent.SetDelegation(child.GetBaseID(), end, 0)
+	getDarc := DarcsToGetDarcs([]*Darc{parent, child})
+	expr := parent.Rules.Get("spawn:x")
+	id := contractor.Identity().String()
+
+	ctx := &Context{Time: end.Add(-time.Second), Darc: parent}
+	require.Nil(t, EvalExprContext(expr, getDarc, ctx, id))
+	ctx.Time = end
+	require.NotNil(t, EvalExprContext(expr, getDarc, ctx, id))
+	// Without a time the delegation is expired.
+	require.NotNil(t, EvalExprContext(expr, getDarc, &Context{Darc: parent}, id))
+
+	parent.SetDelegation(child.GetBaseID(), time.Time{}, 100)
+	require.Equal(t, 1, len(parent.Delegations))
+	require.Nil(t, EvalExprContext(expr, getDarc, &Context{Height: 99, Darc: parent}, id))
+	trace, err := EvalExprTrace(expr, getDarc, false, &Context{Height: 100, Darc: parent}, id)
+	require.NotNil(t, err)
+	require.Equal(t, "delegation expired", trace.Terms[0].Delegation.Error)
+}
+
+func TestDelegation_Revocation(t *testing.T) {
+	owner := createSigner()
+	contractor := createSigner()
+	child := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{contractor.Identity()}), []byte("contractor"))
+	parent := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{owner.Identity()}), []byte("parent"))
+	require.Nil(t, parent.Rules.AddRule("spawn:x", expression.Expr(child.GetIdentityString())))
+	expr := parent.Rules.Get("spawn:x")
+	id := contractor.Identity().String()
+
+	// The revocation in the latest version applies to the rules of the
+	// previous version.
+	parent2 := parent.Copy()
+	parent2.RevokeDelegation(child.GetBaseID())
+	require.Nil(t, localEvolution(parent2, parent, owner))
+	require.NotEqual(t, parent.GetID(), parent2.GetID())
+	ctx := &Context{Darc: parent}
+	require.Nil(t, EvalExprContext(expr, DarcsToGetDarcs([]*Darc{parent, child}), ctx, id))
+	getDarc := DarcsToGetDarcs([]*Darc{parent, parent2, child})
+	trace, err := EvalExprTrace(expr, getDarc, false, ctx, id)
+	require.NotNil(t, err)
+	require.Equal(t, "delegation revoked", trace.Terms[0].Delegation.Error)
+	// Also if the delegated darc is one of the ids.
+	_, err = EvalExprTrace(expr, getDarc, true, ctx, child.GetIdentityString())
+	require.NotNil(t, err)
+
+	require.Nil(t, parent2.ReinstateDelegation(child.GetBaseID()))
+	require.NotNil(t, parent2.ReinstateDelegation(child.GetBaseID()))
+	require.Nil(t, EvalExprContext(expr, getDarc, ctx, id))
+}
+
+// TestDelegation_Nested checks that the delegations of a delegated darc
+// restrict its sign expression, also without a context.
+func TestDelegation_Nested(t *testing.T) {
+	owner := createSigner()
+	contractor := createSigner()
+	grandchild := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{contractor.Identity()}), []byte("grandchild"))
+	child := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{owner.Identity()}), []byte("child"))
+	require.Nil(t, child.Rules.UpdateSign(expression.Expr(grandchild.GetIdentityString())))
+	getDarc := DarcsToGetDarcs([]*Darc{child, grandchild})
+	expr := expression.Expr(child.GetIdentityString())
+	id := contractor.Identity().String()
+	require.Nil(t, EvalExpr(expr, getDarc, id))
+
+	child2 := child.Copy()
+	child2.RevokeDelegation(grandchild.GetBaseID())
+	require.Nil(t, localEvolution(child2, child, owner))
+	getDarc = DarcsToGetDarcs([]*Darc{child, child2, grandchild})
+	trace, err := EvalExprTrace(expr, getDarc, false, nil, id)
+	require.NotNil(t, err)
+	require.Equal(t, "delegation revoked", trace.Terms[0].Delegation.Trace.Terms[0].Delegation.Error)
+}
+
+// TestDelegation_NoContext checks that the delegations of the darc of a rule
+// are restricted when the rule is evaluated without a context.
+func TestDelegation_NoContext(t *testing.T) {
+	owner := createSigner()
+	contractor := createSigner()
+	child := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{contractor.Identity()}), []byte("contractor"))
+	parent := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{owner.Identity()}), []byte("parent"))
+	require.Nil(t, parent.Rules.AddRule("spawn:x", expression.Expr(child.GetIdentityString())))
+	expr := parent.Rules.Get("spawn:x")
+	id := contractor.Identity().String()
+	require.Nil(t, EvalExprForDarc(expr, parent, DarcsToGetDarcs([]*Darc{parent, child}), false, id))
+
+	// The revocation in the latest version is found with getDarc.
+	parent2 := parent.Copy()
+	parent2.RevokeDelegation(child.GetBaseID())
+	require.Nil(t, localEvolution(parent2, parent, owner))
+	getDarc := DarcsToGetDarcs([]*Darc{parent, parent2, child})
+	require.NotNil(t, EvalExprForDarc(expr, parent, getDarc, false, id))
+	require.NotNil(t, EvalExprForDarc(expr, parent, getDarc, true, child.GetIdentityString()))
+	// Without the darc of the rule, only the delegated darcs are checked.
+	require.Nil(t, EvalExprDarc(expr, getDarc, false, id))
+
+	// A delegation that expires is not valid without a time.
+	require.Nil(t, parent2.ReinstateDelegation(child.GetBaseID()))
+	parent2.SetDelegation(child.GetBaseID(), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), 0)
+	require.NotNil(t, EvalExprForDarc(expr, parent, getDarc, false, id))
+	r, err := InitAndSignRequest(parent.GetBaseID(), "spawn:x", []byte("msg"), contractor)
+	require.Nil(t, err)
+	require.NotNil(t, r.VerifyWithCB(parent2, getDarc))
+}
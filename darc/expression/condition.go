@@ -0,0 +1,179 @@
+package expression
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	parsec "github.com/prataprc/goparsec"
+)
+
+// The names of the conditions.
+const (
+	// CondBefore is true if the request happens before the time.
+	CondBefore = "before"
+	// CondAfter is true if the request happens at or after the time.
+	CondAfter = "after"
+	// CondRate is true if there were less than Count requests for the
+	// same action in the Window before the request.
+	CondRate = "rate"
+	// CondArg compares an argument of the request.
+	CondArg = "arg"
+)
+
+// conditionTimeLayouts are the accepted formats for the time of the before
+// and after conditions.
+var conditionTimeLayouts = []string{"2006-01-02", time.RFC3339}
+
+// Condition is a condition on the context of a request, such as its time or
+// its arguments, as opposed to the ids that signed it.
+type Condition struct {
+	// Name is one of CondBefore, CondAfter, CondRate or CondArg.
+	Name string
+	// Time is the limit of the before and after conditions.
+	Time time.Time
+	// Count is the maximum number of requests in the Window of a rate
+	// condition.
+	Count int
+	// Window is the duration of a rate condition.
+	Window time.Duration
+	// Arg is the name of the argument of an arg condition.
+	Arg string
+	// Op is the operator of an arg condition, one of <, <=, >, >=, ==, !=
+	// or in.
+	Op string
+	// Values are the operands of an arg condition. For all the operators
+	// except in, it is a single unsigned decimal number.
+	Values []string
+}
+
+// String returns the condition in the syntax of the expressions.
+func (c Condition) String() string {
+	switch c.Name {
+	case CondBefore, CondAfter:
+		return c.Name + "(" + c.Time.Format(time.RFC3339) + ")"
+	case CondRate:
+		return c.Name + "(" + strconv.Itoa(c.Count) + "/" + c.Window.String() + ")"
+	case CondArg:
+		if c.Op == "in" {
+			return c.Name + "(" + c.Arg + ") in (" + strings.Join(c.Values, ", ") + ")"
+		}
+		return c.Name + "(" + c.Arg + ") " + c.Op + " " + strings.Join(c.Values, "")
+	}
+	return c.Name
+}
+
+// ConditionCheckFn is a function that will be called when the parser is
+// evaluating a condition.
+type ConditionCheckFn func(Condition) bool
+
+// conditionParser accepts the conditions:
+//
+//	before(2027-01-01) | after(2027-01-01T12:00:00Z) | rate(10/24h) |
+//	arg(coins) <= 1000 | arg(type) in (a, b)
+func conditionParser(cfn ConditionCheckFn) parsec.Parser {
+	var openparan = parsec.Token(`\(`, "OPENPARAN")
+	var closeparan = parsec.Token(`\)`, "CLOSEPARAN")
+	var comma = parsec.Token(`,`, "COMMA")
+	var timeCond = parsec.Token(`(before|after)\([^)\s]+\)`, "TIMECOND")
+	var rateCond = parsec.Token(`rate\([0-9]+/[0-9a-z.]+\)`, "RATECOND")
+	var argRef = parsec.Token(`arg\([^)\s]+\)`, "ARG")
+	var cmpOp = parsec.Token(`(<=|>=|==|!=|<|>)`, "CMP")
+	var inOp = parsec.Token(`in`, "IN")
+	var number = parsec.Token(`[0-9]+`, "NUMBER")
+	var argValue = parsec.Token(`[^,()\s]+`, "VALUE")
+
+	var argCmp = parsec.And(argCmpNode, argRef, cmpOp, number)
+	var argIn = parsec.And(argInNode, argRef, inOp, openparan, argValue,
+		parsec.Kleene(nil, parsec.And(many2many, comma, argValue), nil), closeparan)
+	return parsec.OrdChoice(conditionNode(cfn), timeCond, rateCond, argCmp, argIn)
+}
+
+// conditionNode evaluates a condition with cfn. A condition always
+// evaluates to false if cfn is nil. It returns nil, so that the parsing
+// fails, if the condition is malformed.
+func conditionNode(cfn ConditionCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
+	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
+		if len(ns) == 0 {
+			return nil
+		}
+		var c *Condition
+		switch n := ns[0].(type) {
+		case *parsec.Terminal:
+			c = parseCondition(n.Value)
+		case *Condition:
+			c = n
+		}
+		if c == nil {
+			return nil
+		}
+		if cfn == nil {
+			return false
+		}
+		return cfn(*c)
+	}
+}
+
+// parseCondition parses the before, after and rate conditions.
+func parseCondition(s string) *Condition {
+	open := strings.Index(s, "(")
+	name, arg := s[:open], s[open+1:len(s)-1]
+	switch name {
+	case CondBefore, CondAfter:
+		for _, layout := range conditionTimeLayouts {
+			if t, err := time.Parse(layout, arg); err == nil {
+				return &Condition{Name: name, Time: t}
+			}
+		}
+	case CondRate:
+		parts := strings.SplitN(arg, "/", 2)
+		count, err := strconv.Atoi(parts[0])
+		if err != nil || count < 1 {
+			return nil
+		}
+		window, err := time.ParseDuration(parts[1])
+		if err != nil || window <= 0 {
+			return nil
+		}
+		return &Condition{Name: name, Count: count, Window: window}
+	}
+	return nil
+}
+
+func argName(n parsec.ParsecNode) string {
+	v := n.(*parsec.Terminal).Value
+	return v[len("arg(") : len(v)-1]
+}
+
+func argCmpNode(ns []parsec.ParsecNode) parsec.ParsecNode {
+	if len(ns) != 3 {
+		return nil
+	}
+	value := ns[2].(*parsec.Terminal).Value
+	if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+		return nil
+	}
+	return &Condition{
+		Name:   CondArg,
+		Arg:    argName(ns[0]),
+		Op:     ns[1].(*parsec.Terminal).Value,
+		Values: []string{value},
+	}
+}
+
+func argInNode(ns []parsec.ParsecNode) parsec.ParsecNode {
+	if len(ns) != 6 {
+		return nil
+	}
+	values := []string{ns[3].(*parsec.Terminal).Value}
+	for _, x := range ns[4].([]parsec.ParsecNode) {
+		y := x.([]parsec.ParsecNode)
+		values = append(values, y[1].(*parsec.Terminal).Value)
+	}
+	return &Condition{
+		Name:   CondArg,
+		Arg:    argName(ns[0]),
+		Op:     "in",
+		Values: values,
+	}
+}
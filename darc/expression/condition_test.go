@@ -0,0 +1,96 @@
+package expression
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCondition_Parsing(t *testing.T) {
+	var got []Condition
+	cfn := func(c Condition) bool {
+		got = append(got, c)
+		return c.Name != CondRate
+	}
+	expr := Expr("ed25519:a & before(2027-01-01) & after(2018-10-18T12:00:00Z) & arg(coins) <= 1000 & " +
+		"arg(type) in (gold, silver) | rate(10/24h)")
+	x, err := Evaluate(InitParserWithConditions(trueFn, cfn), expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != true {
+		t.Fatal("wrong result")
+	}
+	if len(got) != 5 {
+		t.Fatalf("wrong number of conditions: %d", len(got))
+	}
+	if got[0].Name != CondBefore || !got[0].Time.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong condition %+v", got[0])
+	}
+	if got[1].Name != CondAfter || !got[1].Time.Equal(time.Date(2018, 10, 18, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong condition %+v", got[1])
+	}
+	if got[2].Name != CondArg || got[2].Arg != "coins" || got[2].Op != "<=" || got[2].Values[0] != "1000" {
+		t.Fatalf("wrong condition %+v", got[2])
+	}
+	if got[3].Name != CondArg || got[3].Arg != "type" || got[3].Op != "in" || len(got[3].Values) != 2 ||
+		got[3].Values[1] != "silver" {
+		t.Fatalf("wrong condition %+v", got[3])
+	}
+	if got[4].Name != CondRate || got[4].Count != 10 || got[4].Window != 24*time.Hour {
+		t.Fatalf("wrong condition %+v", got[4])
+	}
+
+	// Without a ConditionCheckFn the conditions are false.
+	x, err = Evaluate(InitParser(trueFn), Expr("ed25519:a & before(2027-01-01)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != false {
+		t.Fatal("wrong result")
+	}
+}
+
+func TestCondition_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"before(2027-13-01)",
+		"after(tomorrow)",
+		"rate(0/1h)",
+		"rate(10/1y)",
+		"arg(coins) <= -1",
+		"arg(coins) <= 18446744073709551616",
+		"arg(coins) = 1",
+		"arg(coins) in ()",
+		"arg() <= 1",
+		"until(2027-01-01)",
+	} {
+		if _, err := Evaluate(InitParserWithConditions(trueFn, func(Condition) bool { return true }), Expr(expr)); err == nil {
+			t.Fatalf("%s: expect an error", expr)
+		}
+	}
+}
+
+func TestCondition_String(t *testing.T) {
+	for expr, exp := range map[string]string{
+		"before(2027-01-01)":          "before(2027-01-01T00:00:00Z)",
+		"after(2027-01-01T12:00:00Z)": "after(2027-01-01T12:00:00Z)",
+		"rate(10/24h)":                "rate(10/24h0m0s)",
+		"arg(coins)<=1000":            "arg(coins) <= 1000",
+		"arg(type) in (gold,silver)":  "arg(type) in (gold, silver)",
+	} {
+		var got string
+		_, err := Evaluate(InitParserWithConditions(trueFn, func(c Condition) bool {
+			got = c.String()
+			return true
+		}), Expr(expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Fatalf("%s: got %s", expr, got)
+		}
+		// The string is a valid condition.
+		if _, err = Evaluate(InitParser(trueFn), Expr(got)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -5,8 +5,12 @@ the syntax we use is from: https://en.wikipedia.org/wiki/Extended_Backus%E2%80%9
 
 	expr = term, [ '&', term ]*
 	term = factor, [ '|', factor ]*
-	factor = '(', expr, ')' | id | openid
-	typeHex = (darc|ed25519|x509ec):[0-9a-fA-F]
+	factor = '(', expr, ')' | id | openid | thexpr | cond
+	thexpr = '[', id, [ ',', id ]*, ']', '/', digit, [ digit ]*
+	cond = ('before' | 'after'), '(', time, ')' | 'rate', '(', digit, [ digit ]*, '/', duration, ')' |
+		'arg', '(', name, ')', ( cmp, digit, [ digit ]* | 'in', '(', value, [ ',', value ]*, ')' )
+	cmp = '<' | '<=' | '>' | '>=' | '==' | '!='
+	typeHex = (darc|ed25519|x509ec|bls|secp256k1|webauthn:[0-9a-fA-F]+):[0-9a-fA-F]
     proxy = proxy:ed25519-pubkey:associated_data
 
 Examples:
@@ -21,15 +25,30 @@ true.  If the set of valid ids is [a:a, c:c], then the expression will evaluate
 to false. However, the user is able to provide a ValueCheckFn to customise how
 the expressions are evaluated.
 
-EXTENSION - NOT YET IMPLEMENTED:
-To support threshold signatures, we extend the syntax to include the following.
-	thexpr = '[', id, [ ',', id ]*, ']', '/', digit
+A threshold expression [a:a, b:b, c:c]/2 evaluates to true if at least 2 of
+the listed ids are valid. The ids must be distinct, and the threshold must be
+between 1 and the number of ids, otherwise the expression doesn't parse. A
+darc id in the list counts as one, whatever the number of valid ids in its
+delegation.
+
+A condition checks the context of a request instead of its signers, for
+example
+
+	ed25519:a & before(2027-01-01) & arg(coins) <= 1000 & rate(10/24h)
+
+is true if ed25519:a signs a request made before 2027 with an argument coins
+of at most 1000, and if there were less than 10 such requests in the last 24
+hours. The time is either a date or an RFC3339 time, and the duration is in
+the format of time.ParseDuration. The conditions are evaluated by a
+ConditionCheckFn given to InitParserWithConditions, InitParser evaluates them
+to false.
 */
 package expression
 
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	parsec "github.com/prataprc/goparsec"
@@ -47,8 +66,21 @@ type ValueCheckFn func(string) bool
 // Expr represents the unprocess expression of our DSL.
 type Expr []byte
 
-// InitParser creates the root parser
+// InitParser creates the root parser. The conditions evaluate to false, use
+// InitParserWithConditions to evaluate them.
 func InitParser(fn ValueCheckFn) parsec.Parser {
+	return InitParserWithConditions(fn, nil)
+}
+
+// InitParserWithConditions creates the root parser, the ids are evaluated
+// with fn and the conditions with cfn.
+func InitParserWithConditions(fn ValueCheckFn, cfn ConditionCheckFn) parsec.Parser {
+	return initParser(fn, cfn, nil)
+}
+
+// initParser creates the root parser, rec is called, if it is not nil, with
+// every factor that has been evaluated.
+func initParser(fn ValueCheckFn, cfn ConditionCheckFn, rec func(start, end int, v bool)) parsec.Parser {
 	// Y is root Parser, usually called as `s` in CFG theory.
 	var Y parsec.Parser
 	var sum, value parsec.Parser // circular rats
@@ -58,6 +90,11 @@ func InitParser(fn ValueCheckFn) parsec.Parser {
 	var closeparan = parsec.Token(`\)`, "CLOSEPARAN")
 	var andop = parsec.Token(`&`, "AND")
 	var orop = parsec.Token(`\|`, "OR")
+	var openbracket = parsec.Token(`\[`, "OPENBRACKET")
+	var closebracket = parsec.Token(`\]`, "CLOSEBRACKET")
+	var comma = parsec.Token(`,`, "COMMA")
+	var slash = parsec.Token(`/`, "SLASH")
+	var number = parsec.Token(`[0-9]+`, "NUMBER")
 
 	// NonTerminal rats
 	// andop -> "&" |  "|"
@@ -66,14 +103,27 @@ func InitParser(fn ValueCheckFn) parsec.Parser {
 	// value -> "(" expr ")"
 	var groupExpr = parsec.And(exprNode, openparan, &sum, closeparan)
 
+	// id -> typeHex | proxy
+	// The associated data of a proxy in a threshold expression cannot
+	// contain ',' or ']'.
+	var id = parsec.OrdChoice(one2one, typeHex(),
+		parsec.Token(`proxy:[0-9a-fA-F]+:[^ \n\t,\]]*`, "PROXY"))
+	// value -> "[" id ("," id)* "]" "/" number
+	var thresholdExpr = parsec.And(thresholdNode(fn), openbracket, id,
+		parsec.Kleene(nil, parsec.And(many2many, comma, id), nil), closebracket, slash, number)
+
 	// (andop prod)*
 	var prodK = parsec.Kleene(nil, parsec.And(many2many, sumOp, &value), nil)
 
 	// Circular rats come to life
 	// sum -> prod (andop prod)*
 	sum = parsec.And(sumNode(fn), &value, prodK)
-	// value -> id | "(" expr ")"
-	value = parsec.OrdChoice(exprValueNode(fn), typeHex(), proxy(), groupExpr)
+	// value -> id | "(" expr ")" | threshold | condition
+	value = parsec.OrdChoice(exprValueNode(fn), typeHex(), proxy(), groupExpr, thresholdExpr,
+		conditionParser(cfn))
+	if rec != nil {
+		value = tracedParser(value, rec)
+	}
 	// expr  -> sum
 	Y = parsec.OrdChoice(one2one, sum)
 	return Y
@@ -96,6 +146,68 @@ func Evaluate(parser parsec.Parser, expr Expr) (bool, error) {
 	return vv, nil
 }
 
+// SubExpr is a factor of an expression, i.e. an id, a condition, a threshold
+// expression or an expression in parentheses, with its value.
+type SubExpr struct {
+	Expr Expr
+	// Start and End are the position of the factor in the expression.
+	Start int
+	End   int
+	Value bool
+}
+
+// EvaluateTrace evaluates the expression like Evaluate with the parser of
+// InitParserWithConditions. It also returns the factors of the expression in
+// the order they were evaluated, which is the inner ones before the outer
+// ones.
+func EvaluateTrace(expr Expr, fn ValueCheckFn, cfn ConditionCheckFn) (bool, []SubExpr, error) {
+	var subs []SubExpr
+	Y := initParser(fn, cfn, func(start, end int, v bool) {
+		subs = append(subs, SubExpr{
+			Expr:  Expr(strings.TrimSpace(string(expr[start:end]))),
+			Start: start,
+			End:   end,
+			Value: v,
+		})
+	})
+	res, err := Evaluate(Y, expr)
+	return res, subs, err
+}
+
+// FirstFailing returns the leftmost of the outermost factors that evaluate
+// to false, or nil if there are none. A factor covering the whole expression,
+// like "(a & b)", is not returned, but the factors inside it are.
+func FirstFailing(subs []SubExpr) *SubExpr {
+	whole := func(s SubExpr) bool {
+		if len(subs) == 1 {
+			return false
+		}
+		for _, t := range subs {
+			if t.Start < s.Start || t.End > s.End {
+				return false
+			}
+		}
+		return true
+	}
+	var first *SubExpr
+	for i, s := range subs {
+		if s.Value || whole(s) {
+			continue
+		}
+		outer := true
+		for _, t := range subs {
+			if (t.Start < s.Start && t.End >= s.End || t.Start <= s.Start && t.End > s.End) && !whole(t) {
+				outer = false
+				break
+			}
+		}
+		if outer && (first == nil || s.Start < first.Start) {
+			first = &subs[i]
+		}
+	}
+	return first
+}
+
 // DefaultParser creates a parser and evaluates the expression expr, every id
 // in pks will evaluate to true.
 func DefaultParser(expr Expr, ids ...string) (bool, error) {
@@ -121,11 +233,18 @@ func InitOrExpr(ids ...string) Expr {
 	return Expr(strings.Join(ids, " | "))
 }
 
-// Accepts tokens of the form "type:HEX"
+// InitThresholdExpr creates an expression where at least k of the IDs are
+// needed.
+func InitThresholdExpr(k int, ids ...string) Expr {
+	return Expr(fmt.Sprintf("[%s]/%d", strings.Join(ids, ", "), k))
+}
+
+// Accepts tokens of the form "type:HEX", and "webauthn:HEX:HEX" for the
+// relying party and the public key of a WebAuthn identity.
 func typeHex() parsec.Parser {
 	return func(s parsec.Scanner) (parsec.ParsecNode, parsec.Scanner) {
 		_, s = s.SkipAny(`^[ \n\t]+`)
-		p := parsec.Token(`(darc|ed25519|x509ec):[0-9a-fA-F]+`, "HEX")
+		p := parsec.Token(`(darc|ed25519|x509ec|bls|secp256k1|webauthn:[0-9a-fA-F]+):[0-9a-fA-F]+`, "HEX")
 		return p(s)
 	}
 }
@@ -139,6 +258,19 @@ func proxy() parsec.Parser {
 	}
 }
 
+// tracedParser calls rec with the position and the value of what p parsed.
+func tracedParser(p parsec.Parser, rec func(start, end int, v bool)) parsec.Parser {
+	return func(s parsec.Scanner) (parsec.ParsecNode, parsec.Scanner) {
+		_, s = s.SkipWS()
+		start := s.GetCursor()
+		n, news := p(s)
+		if v, ok := n.(bool); ok {
+			rec(start, news.GetCursor(), v)
+		}
+		return n, news
+	}
+}
+
 func sumNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
 	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
 		if len(ns) > 0 {
@@ -159,6 +291,41 @@ func sumNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
 	}
 }
 
+// thresholdNode evaluates a threshold expression. It returns nil, so that
+// the parsing fails, if the ids are not distinct or the threshold is out of
+// range.
+func thresholdNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
+	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
+		if len(ns) != 6 {
+			return nil
+		}
+		ids := []string{ns[1].(*parsec.Terminal).Value}
+		for _, x := range ns[2].([]parsec.ParsecNode) {
+			y := x.([]parsec.ParsecNode)
+			ids = append(ids, y[1].(*parsec.Terminal).Value)
+		}
+		k, err := strconv.Atoi(ns[5].(*parsec.Terminal).Value)
+		if err != nil || k < 1 || k > len(ids) {
+			return nil
+		}
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+		}
+
+		var valid int
+		for _, id := range ids {
+			if fn(id) {
+				valid++
+			}
+		}
+		return valid >= k
+	}
+}
+
 func exprValueNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
 	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
 		if len(ns) == 0 {
@@ -186,6 +186,11 @@ func TestParsing_RealIDs(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	expr = []byte("webauthn:6578616d706c652e636f6d:5764e85642 & ed25519:b")
+	_, err = Evaluate(InitParser(trueFn), expr)
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestParsing_Empty(t *testing.T) {
@@ -218,3 +223,122 @@ func TestEval_DefaultParser(t *testing.T) {
 		t.Fatal("evaluation should return false")
 	}
 }
+
+func TestParsing_Threshold(t *testing.T) {
+	fn := func(s string) bool {
+		return s == "ed25519:a" || s == "x509ec:c"
+	}
+	for expr, exp := range map[string]bool{
+		"[ed25519:a, ed25519:b, x509ec:c]/2":                 true,
+		"[ed25519:a,ed25519:b,x509ec:c]/3":                   false,
+		"[ed25519:b]/1":                                      false,
+		"[ed25519:a, ed25519:b]/1 & ed25519:b":               false,
+		"ed25519:b | [ed25519:a, darc:d]/1":                  true,
+		"([ed25519:a, ed25519:b]/1 & x509ec:c)":              true,
+		"[proxy:ab:user@example.com, ed25519:a, darc:d]/1":   true,
+		"[ed25519:a, ed25519:b, x509ec:c, darc:d, darc:e]/2": true,
+	} {
+		x, err := Evaluate(InitParser(fn), Expr(expr))
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if x != exp {
+			t.Fatalf("%s: wrong result", expr)
+		}
+	}
+
+	// Threshold out of range, duplicate ids, or malformed lists.
+	for _, expr := range []string{
+		"[ed25519:a, ed25519:b]/0",
+		"[ed25519:a, ed25519:b]/3",
+		"[ed25519:a, ed25519:a]/1",
+		"[]/1",
+		"[ed25519:a, ed25519:b]",
+		"[ed25519:a ed25519:b]/1",
+		"[ed25519:a, (ed25519:b)]/1",
+	} {
+		if _, err := Evaluate(InitParser(trueFn), Expr(expr)); err == nil {
+			t.Fatalf("%s: expect an error", expr)
+		}
+	}
+}
+
+func TestInitThreshold(t *testing.T) {
+	keys := []string{"ed25519:a", "ed25519:b", "x509ec:c"}
+	expr := InitThresholdExpr(2, keys...)
+	if string(expr) != "[ed25519:a, ed25519:b, x509ec:c]/2" {
+		t.Fatalf("wrong expression %s", expr)
+	}
+	ok, err := DefaultParser(expr, keys[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != true {
+		t.Fatal("evaluation should return true")
+	}
+	ok, err = DefaultParser(expr, keys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != false {
+		t.Fatal("evaluation should return false")
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	fn := func(s string) bool {
+		return s == "ed25519:a" || s == "ed25519:c"
+	}
+	x, subs, err := EvaluateTrace(Expr("ed25519:a & (ed25519:b | x509ec:d) & [ed25519:c, ed25519:b]/1"), fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != false {
+		t.Fatal("wrong result")
+	}
+	exp := []SubExpr{
+		{Expr: "ed25519:a", Start: 0, End: 9, Value: true},
+		{Expr: "ed25519:b", Start: 13, End: 22, Value: false},
+		{Expr: "x509ec:d", Start: 25, End: 33, Value: false},
+		{Expr: "(ed25519:b | x509ec:d)", Start: 12, End: 34, Value: false},
+		{Expr: "[ed25519:c, ed25519:b]/1", Start: 37, End: 61, Value: true},
+	}
+	if len(subs) != len(exp) {
+		t.Fatalf("wrong sub-expressions %v", subs)
+	}
+	for i := range exp {
+		if string(subs[i].Expr) != string(exp[i].Expr) || subs[i].Start != exp[i].Start ||
+			subs[i].End != exp[i].End || subs[i].Value != exp[i].Value {
+			t.Fatalf("wrong sub-expression %d: %v", i, subs[i])
+		}
+	}
+	failing := FirstFailing(subs)
+	if failing == nil || string(failing.Expr) != "(ed25519:b | x509ec:d)" {
+		t.Fatalf("wrong failing sub-expression %v", failing)
+	}
+
+	// A group covering the whole expression is not returned.
+	_, subs, err = EvaluateTrace(Expr("(ed25519:a & ed25519:b)"), fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing = FirstFailing(subs)
+	if failing == nil || string(failing.Expr) != "ed25519:b" {
+		t.Fatalf("wrong failing sub-expression %v", failing)
+	}
+	_, subs, err = EvaluateTrace(Expr("ed25519:b"), fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing = FirstFailing(subs)
+	if failing == nil || string(failing.Expr) != "ed25519:b" {
+		t.Fatalf("wrong failing sub-expression %v", failing)
+	}
+	_, subs, err = EvaluateTrace(Expr("ed25519:a | ed25519:b"), fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FirstFailing(subs) == nil {
+		t.Fatal("ed25519:b is false")
+	}
+}
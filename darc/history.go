@@ -0,0 +1,73 @@
+package darc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/darc/expression"
+)
+
+// RuleDiff is the difference of the rule of an action between two versions
+// of a darc. Old is empty if the rule has been added, New is empty if it has
+// been removed.
+type RuleDiff struct {
+	Action Action
+	Old    expression.Expr
+	New    expression.Expr
+}
+
+// String returns the difference prefixed by + if the rule has been added, -
+// if it has been removed and ~ if its expression changed.
+func (rd RuleDiff) String() string {
+	switch {
+	case len(rd.Old) == 0:
+		return fmt.Sprintf("+ %s: %s", rd.Action, rd.New)
+	case len(rd.New) == 0:
+		return fmt.Sprintf("- %s: %s", rd.Action, rd.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", rd.Action, rd.Old, rd.New)
+	}
+}
+
+// DiffRules returns the rules that changed from the rules from to the rules
+// to: first the changed and removed rules in the order of from, then the
+// added rules in the order of to.
+func DiffRules(from, to Rules) []RuleDiff {
+	var diffs []RuleDiff
+	for _, rule := range from.List {
+		if !to.Contains(rule.Action) {
+			diffs = append(diffs, RuleDiff{Action: rule.Action, Old: rule.Expr})
+			continue
+		}
+		if expr := to.Get(rule.Action); string(expr) != string(rule.Expr) {
+			diffs = append(diffs, RuleDiff{Action: rule.Action, Old: rule.Expr, New: expr})
+		}
+	}
+	for _, rule := range to.List {
+		if !from.Contains(rule.Action) {
+			diffs = append(diffs, RuleDiff{Action: rule.Action, New: rule.Expr})
+		}
+	}
+	return diffs
+}
+
+// Restore returns the evolution of d that has the rules of prev, a previous
+// version of d. Like any evolution, it must be signed by the evolve rule of
+// d, which is not necessarily the one of prev.
+func (d *Darc) Restore(prev *Darc) (*Darc, error) {
+	if prev == nil {
+		return nil, errors.New("prev darc cannot be nil")
+	}
+	if !prev.GetBaseID().Equal(d.GetBaseID()) {
+		return nil, errors.New("not a version of the same darc")
+	}
+	if prev.Version >= d.Version {
+		return nil, errors.New("can only restore a previous version")
+	}
+	d2 := d.Copy()
+	if err := d2.EvolveFrom(d); err != nil {
+		return nil, err
+	}
+	d2.Rules = prev.Rules.Copy()
+	return d2, nil
+}
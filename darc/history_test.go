@@ -0,0 +1,51 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRules(t *testing.T) {
+	from := NewRules()
+	require.Nil(t, from.AddRule("spawn:a", []byte("ed25519:a")))
+	require.Nil(t, from.AddRule("spawn:b", []byte("ed25519:b")))
+	require.Nil(t, from.AddRule("spawn:c", []byte("ed25519:c")))
+	to := from.Copy()
+	require.Nil(t, to.UpdateRule("spawn:a", []byte("ed25519:a | ed25519:b")))
+	require.Nil(t, to.DeleteRules("spawn:b"))
+	require.Nil(t, to.AddRule("spawn:d", []byte("ed25519:d")))
+
+	diffs := DiffRules(from, to)
+	require.Equal(t, 3, len(diffs))
+	require.Equal(t, "~ spawn:a: ed25519:a -> ed25519:a | ed25519:b", diffs[0].String())
+	require.Equal(t, "- spawn:b: ed25519:b", diffs[1].String())
+	require.Equal(t, "+ spawn:d: ed25519:d", diffs[2].String())
+	require.Equal(t, 0, len(DiffRules(to, to)))
+}
+
+func TestDarc_Restore(t *testing.T) {
+	td := createDarc(1, "restore")
+	d0 := td.darc
+	d1 := d0.Copy()
+	require.Nil(t, d1.Rules.AddRule("spawn:a", []byte("ed25519:a")))
+	require.Nil(t, localEvolution(d1, d0, td.owners[0]))
+	d2 := d1.Copy()
+	require.Nil(t, d2.Rules.UpdateRule("spawn:a", []byte("ed25519:b")))
+	require.Nil(t, localEvolution(d2, d1, td.owners[0]))
+
+	d3, err := d2.Restore(d1)
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), d3.Version)
+	require.True(t, d3.PrevID.Equal(d2.GetID()))
+	require.Equal(t, expression.Expr("ed25519:a"), d3.Rules.Get("spawn:a"))
+	require.Equal(t, 0, len(DiffRules(d1.Rules, d3.Rules)))
+	require.Nil(t, localEvolution(d3, d2, td.owners[0]))
+	require.Nil(t, d3.Verify(true))
+
+	_, err = d1.Restore(d2)
+	require.NotNil(t, err)
+	_, err = d2.Restore(createDarc(1, "other").darc)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,274 @@
+package darc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/pairing"
+	"github.com/dedis/kyber/sign/bls"
+	"github.com/dedis/kyber/util/random"
+	"github.com/dedis/protobuf"
+)
+
+// blsSuite is the suite of the BLS identities, the same as the one of the
+// BLS keys of the conodes.
+var blsSuite = pairing.NewSuiteBn256()
+
+// webAuthnUserPresent is the flag of the authenticator data telling that the
+// user has been present during the assertion.
+const webAuthnUserPresent = 0x01
+
+// NewIdentityBLS creates a new BLS identity struct given a point on the G2
+// group of BN256.
+func NewIdentityBLS(public kyber.Point) Identity {
+	buf, err := public.MarshalBinary()
+	if err != nil {
+		return Identity{}
+	}
+	return Identity{
+		BLS: &IdentityBLS{
+			Public: buf,
+		},
+	}
+}
+
+// Equal returns true if both IdentityBLS point to the same data.
+func (idb IdentityBLS) Equal(idb2 *IdentityBLS) bool {
+	return bytes.Equal(idb.Public, idb2.Public)
+}
+
+// Verify returns nil if the signature is correct, or an error if something
+// fails.
+func (idb IdentityBLS) Verify(msg, sig []byte) error {
+	public := blsSuite.G2().Point()
+	if err := public.UnmarshalBinary(idb.Public); err != nil {
+		return err
+	}
+	return bls.Verify(blsSuite, public, msg, sig)
+}
+
+// NewIdentitySecp256k1 creates a new secp256k1 identity struct given a public
+// key, compressed or not.
+func NewIdentitySecp256k1(public []byte) Identity {
+	pub, err := btcec.ParsePubKey(public, btcec.S256())
+	if err != nil {
+		return Identity{}
+	}
+	return Identity{
+		Secp256k1: &IdentitySecp256k1{
+			Public: pub.SerializeCompressed(),
+		},
+	}
+}
+
+// Equal returns true if both IdentitySecp256k1 point to the same data.
+func (ids IdentitySecp256k1) Equal(ids2 *IdentitySecp256k1) bool {
+	return bytes.Equal(ids.Public, ids2.Public)
+}
+
+// Verify returns nil if the DER encoded ECDSA signature of the SHA256 hash
+// of the message is correct, or an error if something fails.
+func (ids IdentitySecp256k1) Verify(msg, s []byte) error {
+	public, err := btcec.ParsePubKey(ids.Public, btcec.S256())
+	if err != nil {
+		return err
+	}
+	sig, err := btcec.ParseDERSignature(s, btcec.S256())
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(msg)
+	if !sig.Verify(digest[:], public) {
+		return errors.New("Wrong signature")
+	}
+	return nil
+}
+
+// NewIdentityWebAuthn creates a new WebAuthn identity struct given the
+// relying party ID of the credential and its public key in PKIX format.
+func NewIdentityWebAuthn(rpID string, public []byte) Identity {
+	return Identity{
+		WebAuthn: &IdentityWebAuthn{
+			RPID:   rpID,
+			Public: public,
+		},
+	}
+}
+
+// Equal returns true if both IdentityWebAuthn are the same.
+func (idw IdentityWebAuthn) Equal(idw2 *IdentityWebAuthn) bool {
+	return idw.RPID == idw2.RPID && bytes.Equal(idw.Public, idw2.Public)
+}
+
+// Verify returns nil if the signature is a valid WebAuthnAssertion for the
+// message, or an error if something fails. The assertion must have the
+// message as challenge, be created for the relying party of the identity and
+// have the user present flag. The signature counter of the authenticator is
+// not checked, the replay protection is left to the caller.
+func (idw IdentityWebAuthn) Verify(msg, s []byte) error {
+	var a WebAuthnAssertion
+	if err := protobuf.Decode(s, &a); err != nil {
+		return err
+	}
+	var client struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(a.ClientDataJSON, &client); err != nil {
+		return err
+	}
+	if client.Type != "webauthn.get" {
+		return errors.New("client data is not of an assertion")
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(client.Challenge, "="))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(challenge, msg) {
+		return errors.New("wrong challenge")
+	}
+
+	// The authenticator data starts with the hash of the relying party ID,
+	// followed by the flags and the signature counter.
+	if len(a.AuthenticatorData) < 37 {
+		return errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(idw.RPID))
+	if !bytes.Equal(a.AuthenticatorData[:32], rpIDHash[:]) {
+		return errors.New("wrong relying party")
+	}
+	if a.AuthenticatorData[32]&webAuthnUserPresent == 0 {
+		return errors.New("user not present")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(idw.Public)
+	if err != nil {
+		return err
+	}
+	ecPublic, ok := public.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("not an ECDSA public key")
+	}
+	sig := &sigRS{}
+	if _, err = asn1.Unmarshal(a.Signature, sig); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(webAuthnSignedData(a))
+	if ecdsa.Verify(ecPublic, digest[:], sig.R, sig.S) {
+		return nil
+	}
+	return errors.New("Wrong signature")
+}
+
+// webAuthnSignedData returns the data signed by the authenticator for the
+// assertion: the authenticator data followed by the hash of the client data.
+func webAuthnSignedData(a WebAuthnAssertion) []byte {
+	clientHash := sha256.Sum256(a.ClientDataJSON)
+	return append(copyBytes(a.AuthenticatorData), clientHash[:]...)
+}
+
+// NewSignerBLS initializes a new SignerBLS signer given public and private
+// keys on BN256, like the service keys of a conode. If either of the given
+// keys is nil, then a new key pair is generated.
+func NewSignerBLS(public kyber.Point, private kyber.Scalar) Signer {
+	if public == nil || private == nil {
+		private, public = bls.NewKeyPair(blsSuite, random.New())
+	}
+	pub, err := public.MarshalBinary()
+	if err != nil {
+		return Signer{}
+	}
+	priv, err := private.MarshalBinary()
+	if err != nil {
+		return Signer{}
+	}
+	return Signer{BLS: &SignerBLS{
+		Public: pub,
+		Secret: priv,
+	}}
+}
+
+// Sign creates a BLS signature on the message.
+func (bs SignerBLS) Sign(msg []byte) ([]byte, error) {
+	private, err := bs.private()
+	if err != nil {
+		return nil, err
+	}
+	return bls.Sign(blsSuite, private, msg)
+}
+
+func (bs SignerBLS) private() (kyber.Scalar, error) {
+	private := blsSuite.G2().Scalar()
+	if err := private.UnmarshalBinary(bs.Secret); err != nil {
+		return nil, err
+	}
+	return private, nil
+}
+
+// NewSignerSecp256k1 initializes a new SignerSecp256k1 signer given a private
+// key, like the one of a wallet. If the private key is nil, then a new one is
+// generated.
+func NewSignerSecp256k1(private []byte) Signer {
+	var priv *btcec.PrivateKey
+	if private == nil {
+		var err error
+		priv, err = btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			return Signer{}
+		}
+	} else {
+		priv, _ = btcec.PrivKeyFromBytes(btcec.S256(), private)
+	}
+	return Signer{Secp256k1: &SignerSecp256k1{
+		Public: priv.PubKey().SerializeCompressed(),
+		Secret: priv.Serialize(),
+	}}
+}
+
+// Sign creates a DER encoded ECDSA signature on the SHA256 hash of the
+// message.
+func (ss SignerSecp256k1) Sign(msg []byte) ([]byte, error) {
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), ss.Secret)
+	digest := sha256.Sum256(msg)
+	sig, err := priv.Sign(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+// NewSignerWebAuthn creates a new SignerWebAuthn for the credential with the
+// public key in PKIX format, created for the relying party rpID. When Sign is
+// called, the getAssertion callback will be called with the message as
+// challenge, so that the caller can ask the authenticator for an assertion.
+func NewSignerWebAuthn(rpID string, public []byte, getAssertion func([]byte) (*WebAuthnAssertion, error)) Signer {
+	return Signer{
+		WebAuthn: &SignerWebAuthn{
+			RPID:         rpID,
+			Public:       public,
+			getAssertion: getAssertion,
+		},
+	}
+}
+
+// Sign asks the authenticator, via the callback set in the constructor, for
+// an assertion with the message as challenge and returns it encoded.
+func (ws SignerWebAuthn) Sign(msg []byte) ([]byte, error) {
+	if ws.getAssertion == nil {
+		return nil, errors.New("no authenticator to get the assertion from")
+	}
+	a, err := ws.getAssertion(msg)
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.Encode(a)
+}
@@ -0,0 +1,134 @@
+package darc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentity_BLS(t *testing.T) {
+	signer := NewSignerBLS(nil, nil)
+	id := signer.Identity()
+	require.Equal(t, 4, id.Type())
+	require.True(t, strings.HasPrefix(id.String(), "bls:"))
+	require.True(t, id.PrimaryIdentity())
+
+	sig, err := signer.Sign([]byte("message"))
+	require.Nil(t, err)
+	require.Nil(t, id.Verify([]byte("message"), sig))
+	require.NotNil(t, id.Verify([]byte("other message"), sig))
+	require.NotNil(t, NewSignerBLS(nil, nil).Identity().Verify([]byte("message"), sig))
+
+	// The private key is not on the curve of cothority.Suite.
+	_, err = signer.GetPrivate()
+	require.NotNil(t, err)
+	private, err := signer.BLS.private()
+	require.Nil(t, err)
+	public := blsSuite.G2().Point().Mul(private, nil)
+	id2 := NewIdentityBLS(public)
+	require.True(t, id.Equal(&id2))
+}
+
+func TestIdentity_Secp256k1(t *testing.T) {
+	signer := NewSignerSecp256k1(nil)
+	id := signer.Identity()
+	require.Equal(t, 5, id.Type())
+	require.True(t, strings.HasPrefix(id.String(), "secp256k1:"))
+
+	sig, err := signer.Sign([]byte("message"))
+	require.Nil(t, err)
+	require.Nil(t, id.Verify([]byte("message"), sig))
+	require.NotNil(t, id.Verify([]byte("other message"), sig))
+
+	// The same private key gives the same identity.
+	signer2 := NewSignerSecp256k1(signer.Secp256k1.Secret)
+	id2 := signer2.Identity()
+	require.True(t, id.Equal(&id2))
+	require.Equal(t, -1, NewIdentitySecp256k1([]byte("not a key")).Type())
+}
+
+func TestIdentity_WebAuthn(t *testing.T) {
+	auth := newTestAuthenticator(t, "example.com")
+	signer := NewSignerWebAuthn("example.com", auth.public, auth.getAssertion)
+	id := signer.Identity()
+	require.Equal(t, 6, id.Type())
+	require.Equal(t, fmt.Sprintf("webauthn:%x:%x", "example.com", auth.public), id.String())
+	require.Nil(t, checkIdentity(id.String()))
+	require.NotNil(t, checkIdentity(fmt.Sprintf("webauthn:%x", auth.public)))
+
+	// A rule binds the relying party.
+	other := NewIdentityWebAuthn("other.com", auth.public)
+	require.NotEqual(t, id.String(), other.String())
+
+	sig, err := signer.Sign([]byte("message"))
+	require.Nil(t, err)
+	require.Nil(t, id.Verify([]byte("message"), sig))
+	require.NotNil(t, id.Verify([]byte("other message"), sig))
+	require.NotNil(t, NewIdentityWebAuthn("other.com", auth.public).Verify([]byte("message"), sig))
+
+	auth.flags = 0
+	sig, err = signer.Sign([]byte("message"))
+	require.Nil(t, err)
+	require.NotNil(t, id.Verify([]byte("message"), sig))
+
+	_, err = NewSignerWebAuthn("example.com", auth.public, nil).Sign([]byte("message"))
+	require.NotNil(t, err)
+}
+
+// TestIdentity_Request signs a request with the new identities and verifies
+// it against a rule that needs all of them.
+func TestIdentity_Request(t *testing.T) {
+	auth := newTestAuthenticator(t, "example.com")
+	signers := []Signer{NewSignerBLS(nil, nil), NewSignerSecp256k1(nil),
+		NewSignerWebAuthn("example.com", auth.public, auth.getAssertion)}
+	owner := createSigner()
+	d := NewDarc(InitRules([]Identity{owner.Identity()}, []Identity{owner.Identity()}), []byte("identities"))
+	expr := signers[0].Identity().String() + " & " + signers[1].Identity().String() + " & " +
+		signers[2].Identity().String()
+	require.Nil(t, d.Rules.AddRule("spawn:test", expression.Expr(expr)))
+
+	r, err := InitAndSignRequest(d.GetBaseID(), "spawn:test", []byte("msg"), signers...)
+	require.Nil(t, err)
+	require.Nil(t, r.Verify(d))
+	r, err = InitAndSignRequest(d.GetBaseID(), "spawn:test", []byte("msg"), signers[:2]...)
+	require.Nil(t, err)
+	require.NotNil(t, r.Verify(d))
+}
+
+// testAuthenticator is a software WebAuthn authenticator.
+type testAuthenticator struct {
+	rpID    string
+	private *ecdsa.PrivateKey
+	public  []byte
+	flags   byte
+}
+
+func newTestAuthenticator(t *testing.T, rpID string) *testAuthenticator {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	require.Nil(t, err)
+	return &testAuthenticator{rpID: rpID, private: private, public: public, flags: webAuthnUserPresent}
+}
+
+func (ta *testAuthenticator) getAssertion(challenge []byte) (*WebAuthnAssertion, error) {
+	rpIDHash := sha256.Sum256([]byte(ta.rpID))
+	a := WebAuthnAssertion{
+		AuthenticatorData: append(rpIDHash[:], ta.flags, 0, 0, 0, 1),
+		ClientDataJSON: []byte(`{"type":"webauthn.get","challenge":"` +
+			base64.RawURLEncoding.EncodeToString(challenge) + `","origin":"https://` + ta.rpID + `"}`),
+	}
+	digest := sha256.Sum256(webAuthnSignedData(a))
+	var err error
+	a.Signature, err = ta.private.Sign(rand.Reader, digest[:], nil)
+	return &a, err
+}
@@ -0,0 +1,279 @@
+package darc
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/darc/expression"
+)
+
+// LintKind is the kind of a problem found by Lint.
+type LintKind int
+
+const (
+	// LintUnreachable is a rule that no set of identities can satisfy.
+	LintUnreachable LintKind = iota
+	// LintCycle is a delegation that comes back to a darc whose sign rule
+	// is already being evaluated.
+	LintCycle
+	// LintUnknownIdentity is a term that is not a valid identity, or a
+	// darc that cannot be found.
+	LintUnknownIdentity
+	// LintSingleKey is an evolution rule that a single identity can
+	// satisfy alone.
+	LintSingleKey
+)
+
+// String returns the name of the kind.
+func (k LintKind) String() string {
+	switch k {
+	case LintUnreachable:
+		return "unreachable"
+	case LintCycle:
+		return "cycle"
+	case LintUnknownIdentity:
+		return "unknown identity"
+	case LintSingleKey:
+		return "single key"
+	default:
+		return "unknown"
+	}
+}
+
+// LintIssue is a problem found in the rule of an action.
+type LintIssue struct {
+	Kind    LintKind
+	Action  Action
+	Message string
+}
+
+// String returns the issue in the form "action: kind: message".
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", li.Action, li.Kind, li.Message)
+}
+
+// Severe returns true if the issue makes the rule unusable or unsafe to
+// evaluate. An evolution rule with a single key is only a warning, because
+// it is the default for new darcs.
+func (li LintIssue) Severe() bool {
+	return li.Kind != LintSingleKey
+}
+
+// knownTypes are the types of the identities the expressions accept.
+var knownTypes = []string{"darc", "ed25519", "x509ec", "proxy", "bls", "secp256k1", "webauthn"}
+
+// typeTerm finds the terms that look like identities in an expression that
+// cannot be parsed.
+var typeTerm = regexp.MustCompile(`\b([a-z][a-z0-9]*):[0-9a-fA-F]+\b`)
+
+// Lint checks the rules of d without evaluating them against signatures,
+// and returns the problems found:
+//   - the rules that no set of identities can satisfy,
+//   - the delegations that form a cycle,
+//   - the terms that are not valid identities and the darcs that cannot be
+//     found,
+//   - the evolution rules, the actions whose name contains "evolve", that a
+//     single identity can satisfy.
+//
+// The conditions are supposed to be fulfilled. getDarc resolves the
+// delegated darcs, the references to d itself are resolved to d so that a
+// darc can be checked before it is stored. If getDarc is nil, only d is
+// resolved.
+func Lint(d *Darc, getDarc GetDarc) []LintIssue {
+	l := &linter{
+		darc:     d,
+		getDarc:  getDarc,
+		reported: make(map[string]bool),
+	}
+	for _, r := range d.Rules.List {
+		l.lintRule(r)
+	}
+	return l.issues
+}
+
+type linter struct {
+	darc     *Darc
+	getDarc  GetDarc
+	action   Action
+	issues   []LintIssue
+	reported map[string]bool
+}
+
+func (l *linter) report(kind LintKind, msg string) {
+	issue := LintIssue{Kind: kind, Action: l.action, Message: msg}
+	if l.reported[issue.String()] {
+		return
+	}
+	l.reported[issue.String()] = true
+	l.issues = append(l.issues, issue)
+}
+
+func (l *linter) lintRule(r Rule) {
+	l.action = r.Action
+	// The sign rule of the darc is evaluated when the darc is
+	// delegated to, so the darc is already on the stack.
+	var stack []string
+	if r.Action == sign {
+		stack = []string{NewIdentityDarc(l.darc.GetBaseID()).String()}
+	}
+	ok, err := l.satisfiable(r.Expr, nil, stack)
+	if err != nil {
+		for _, m := range typeTerm.FindAllStringSubmatch(string(r.Expr), -1) {
+			if !isKnownType(m[1]) {
+				l.report(LintUnknownIdentity, fmt.Sprintf("%s has an unknown type", m[0]))
+			}
+		}
+		l.report(LintUnreachable, "cannot parse the expression: "+err.Error())
+		return
+	}
+	if !ok {
+		l.report(LintUnreachable, fmt.Sprintf("no set of identities can satisfy '%s'", r.Expr))
+		return
+	}
+	if !strings.Contains(string(r.Action), "evolve") {
+		return
+	}
+	for _, id := range l.identities(r.Expr, stack) {
+		if ok, _ := l.satisfiable(r.Expr, map[string]bool{id: true}, stack); ok {
+			l.report(LintSingleKey, id+" can evolve the darc alone")
+		}
+	}
+}
+
+// satisfiable evaluates expr with the given identities, or with all the
+// valid identities if ids is nil. The stack holds the darcs whose sign rule
+// is being evaluated.
+func (l *linter) satisfiable(expr expression.Expr, ids map[string]bool, stack []string) (bool, error) {
+	fn := func(s string) bool {
+		if strings.HasPrefix(s, "darc:") {
+			d := l.delegated(s, stack)
+			if d == nil {
+				return false
+			}
+			ok, err := l.satisfiable(d.Rules.GetSignExpr(), ids, append(stack[:len(stack):len(stack)], s))
+			if err != nil {
+				l.report(LintUnreachable, fmt.Sprintf("cannot parse the sign expression of %s: %v", s, err))
+			}
+			return ok
+		}
+		if err := checkIdentity(s); err != nil {
+			l.report(LintUnknownIdentity, err.Error())
+			return false
+		}
+		return ids == nil || ids[s]
+	}
+	cfn := func(expression.Condition) bool {
+		return true
+	}
+	return expression.Evaluate(expression.InitParserWithConditions(fn, cfn), expr)
+}
+
+// identities returns the valid identities that appear in expr or in the sign
+// expressions of the darcs it delegates to.
+func (l *linter) identities(expr expression.Expr, stack []string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	var collect func(expr expression.Expr, stack []string)
+	collect = func(expr expression.Expr, stack []string) {
+		fn := func(s string) bool {
+			if strings.HasPrefix(s, "darc:") {
+				if d := l.delegated(s, stack); d != nil {
+					collect(d.Rules.GetSignExpr(), append(stack[:len(stack):len(stack)], s))
+				}
+			} else if !seen[s] && checkIdentity(s) == nil {
+				seen[s] = true
+				ids = append(ids, s)
+			}
+			return true
+		}
+		expression.Evaluate(expression.InitParserWithConditions(fn, func(expression.Condition) bool {
+			return true
+		}), expr)
+	}
+	collect(expr, stack)
+	return ids
+}
+
+// delegated returns the darc of the term s, or nil if it cannot be found,
+// has no sign rule or is already on the stack.
+func (l *linter) delegated(s string, stack []string) *Darc {
+	for i, id := range stack {
+		if id == s {
+			cycle := append(append([]string{}, stack[i:]...), s)
+			l.report(LintCycle, "delegation cycle "+strings.Join(cycle, " -> "))
+			return nil
+		}
+	}
+	var d *Darc
+	if s == NewIdentityDarc(l.darc.GetBaseID()).String() {
+		d = l.darc
+	} else if l.getDarc != nil {
+		d = l.getDarc(s, true)
+	}
+	if d == nil {
+		l.report(LintUnknownIdentity, s+" cannot be found")
+		return nil
+	}
+	if !d.Rules.Contains(sign) {
+		l.report(LintUnreachable, s+" has no sign rule")
+		return nil
+	}
+	return d
+}
+
+// checkIdentity returns an error if s is not the string of a valid primary
+// identity.
+func checkIdentity(s string) error {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 || !isKnownType(kv[0]) {
+		return fmt.Errorf("%s has an unknown type", s)
+	}
+	if kv[0] == "proxy" {
+		return nil
+	}
+	if kv[0] == "webauthn" {
+		// The public key follows the relying party.
+		rp := strings.SplitN(kv[1], ":", 2)
+		if len(rp) != 2 {
+			return fmt.Errorf("%s misses the relying party", s)
+		}
+		if _, err := hex.DecodeString(rp[0]); err != nil {
+			return fmt.Errorf("%s is not hex encoded", s)
+		}
+		kv[1] = rp[1]
+	}
+	buf, err := hex.DecodeString(kv[1])
+	if err != nil {
+		return fmt.Errorf("%s is not hex encoded", s)
+	}
+	switch kv[0] {
+	case "ed25519":
+		err = cothority.Suite.Point().UnmarshalBinary(buf)
+	case "x509ec", "webauthn":
+		_, err = x509.ParsePKIXPublicKey(buf)
+	case "bls":
+		err = blsSuite.G2().Point().UnmarshalBinary(buf)
+	case "secp256k1":
+		if NewIdentitySecp256k1(buf).Type() == -1 {
+			err = errors.New("invalid public key")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not a valid %s identity", s, kv[0])
+	}
+	return nil
+}
+
+func isKnownType(t string) bool {
+	for _, k := range knownTypes {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
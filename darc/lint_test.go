@@ -0,0 +1,100 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	td := createLintDarc(2, "lint")
+	require.Nil(t, td.darc.Rules.AddRule("spawn:a", expression.Expr(td.ids[1].String()+" & before(2027-01-01)")))
+	require.Equal(t, 0, len(Lint(td.darc, nil)))
+
+	// A single owner can evolve the darc.
+	issues := Lint(createLintDarc(1, "single").darc, nil)
+	require.Equal(t, 1, len(issues))
+	require.Equal(t, LintSingleKey, issues[0].Kind)
+	require.Equal(t, Action("_evolve"), issues[0].Action)
+	require.False(t, issues[0].Severe())
+
+	// So can a single key of a threshold, but not a key that also needs
+	// a delegated darc.
+	other := createLintDarc(1, "other")
+	d := td.darc.Copy()
+	require.Nil(t, d.Rules.UpdateEvolution(expression.InitThresholdExpr(1, td.ids[0].String(), td.ids[1].String())))
+	require.Nil(t, d.Rules.AddRule("invoke:evolve", expression.InitAndExpr(other.darc.GetIdentityString(),
+		td.ids[1].String())))
+	issues = Lint(d, DarcsToGetDarcs([]*Darc{other.darc}))
+	require.Equal(t, 2, len(issues), "%v", issues)
+	for i, issue := range issues {
+		require.Equal(t, LintSingleKey, issue.Kind)
+		require.Equal(t, Action("_evolve"), issue.Action)
+		require.Equal(t, td.ids[i].String()+" can evolve the darc alone", issue.Message)
+	}
+
+	// A single key behind a delegation is found too.
+	require.Nil(t, d.Rules.UpdateRule("invoke:evolve", expression.Expr(other.darc.GetIdentityString())))
+	issues = Lint(d, DarcsToGetDarcs([]*Darc{other.darc}))
+	require.Equal(t, 3, len(issues), "%v", issues)
+	require.Equal(t, Action("invoke:evolve"), issues[2].Action)
+	require.Equal(t, other.ids[0].String()+" can evolve the darc alone", issues[2].Message)
+}
+
+func TestLint_Unreachable(t *testing.T) {
+	td := createLintDarc(2, "lint")
+	for _, expr := range []string{"rsa:abcd", "ed25519:abcd", td.ids[0].String() + " & darc:abcd"} {
+		d := td.darc.Copy()
+		require.Nil(t, d.Rules.AddRule("spawn:a", expression.Expr(expr)))
+		issues := Lint(d, nil)
+		require.Equal(t, 2, len(issues), "%s: %v", expr, issues)
+		require.Equal(t, LintUnknownIdentity, issues[0].Kind, expr)
+		require.Equal(t, LintUnreachable, issues[1].Kind, expr)
+		require.Equal(t, Action("spawn:a"), issues[1].Action)
+		require.True(t, issues[1].Severe())
+	}
+
+	// A rule that can be satisfied without the invalid identity is only
+	// reported for it.
+	d := td.darc.Copy()
+	require.Nil(t, d.Rules.AddRule("spawn:a", expression.InitOrExpr(td.ids[0].String(), "ed25519:abcd")))
+	issues := Lint(d, nil)
+	require.Equal(t, 1, len(issues))
+	require.Equal(t, LintUnknownIdentity, issues[0].Kind)
+}
+
+func TestLint_Cycle(t *testing.T) {
+	// The ID of a darc depends on its rules, so the cycle needs an
+	// evolution.
+	a := createLintDarc(2, "a").darc
+	aID := NewIdentityDarc(a.GetBaseID()).String()
+	b := createLintDarc(2, "b").darc
+	require.Nil(t, b.Rules.UpdateSign(expression.Expr(aID)))
+	bID := NewIdentityDarc(b.GetBaseID()).String()
+	a1 := a.Copy()
+	require.Nil(t, a1.EvolveFrom(a))
+	require.Nil(t, a1.Rules.UpdateSign(expression.Expr(bID)))
+	getDarc := DarcsToGetDarcs([]*Darc{a1, b})
+
+	issues := Lint(a1, getDarc)
+	require.Equal(t, 2, len(issues), "%v", issues)
+	require.Equal(t, LintCycle, issues[0].Kind)
+	require.Equal(t, "delegation cycle "+aID+" -> "+bID+" -> "+aID, issues[0].Message)
+	require.Equal(t, LintUnreachable, issues[1].Kind)
+
+	// The cycle is found from the other rules too.
+	c := createLintDarc(2, "c")
+	require.Nil(t, c.darc.Rules.AddRule("spawn:a", expression.InitOrExpr(aID, c.ids[0].String())))
+	issues = Lint(c.darc, getDarc)
+	require.Equal(t, 1, len(issues), "%v", issues)
+	require.Equal(t, LintCycle, issues[0].Kind)
+	require.Equal(t, Action("spawn:a"), issues[0].Action)
+}
+
+// createLintDarc creates a darc whose owners are also its signers.
+func createLintDarc(nbrOwners int, desc string) testDarc {
+	td := createDarc(nbrOwners, desc)
+	td.darc = NewDarc(InitRules(td.ids, td.ids), []byte(desc))
+	return td
+}
@@ -51,10 +51,31 @@ type Darc struct {
 	// verify this darc. It is not needed in online verification where the
 	// verifier stores all darcs.
 	VerificationDarcs []*Darc
+	// Delegations are the expiries of the delegations of the rules of this
+	// darc to other darcs.
+	Delegations []Delegation
+	// Revocations are the base IDs of the darcs whose delegations are
+	// revoked: they never fulfill the rules of this darc.
+	Revocations []ID
 }
 
-// Identity is a generic structure can be either an Ed25519 public key, a Darc
-// or a X509 Identity.
+// Delegation is the expiry of the delegation of the rules of a darc to
+// another darc. Once expired, the "darc:" id of the other darc evaluates to
+// false in the expressions of the rules.
+type Delegation struct {
+	// Darc is the base ID of the delegated darc.
+	Darc ID
+	// Expiry is the time, in nanoseconds since the epoch, at which the
+	// delegation expires, or 0 if it does not expire in time.
+	Expiry int64
+	// ExpiryHeight is the block height at which the delegation expires,
+	// or 0 if it does not expire with the height.
+	ExpiryHeight uint64
+}
+
+// Identity is a generic structure can be either an Ed25519 public key, a Darc,
+// a X509 Identity, a proxy claim, a BLS or secp256k1 public key or a WebAuthn
+// credential.
 type Identity struct {
 	// Darc identity
 	Darc *IdentityDarc
@@ -64,6 +85,14 @@ type Identity struct {
 	X509EC *IdentityX509EC
 	// A claim which has been signed by a proxy or proxies.
 	Proxy *IdentityProxy
+	// Public-key identity on the BN256 curve, like the keys of the
+	// conodes.
+	BLS *IdentityBLS
+	// Public-key identity on the secp256k1 curve, like the keys of the
+	// wallets.
+	Secp256k1 *IdentitySecp256k1
+	// Credential of a WebAuthn/FIDO2 authenticator.
+	WebAuthn *IdentityWebAuthn
 }
 
 // IdentityEd25519 holds a Ed25519 public key (Point)
@@ -83,6 +112,36 @@ type IdentityProxy struct {
 	Public kyber.Point
 }
 
+// IdentityBLS holds a marshalled BLS public key on the BN256 curve. It is
+// not a kyber.Point, as it cannot be decoded with the default suite.
+type IdentityBLS struct {
+	Public []byte
+}
+
+// IdentitySecp256k1 holds a compressed secp256k1 public key.
+type IdentitySecp256k1 struct {
+	Public []byte
+}
+
+// IdentityWebAuthn holds the credential of a WebAuthn authenticator: the
+// relying party it has been created for and its ECDSA P-256 public key in
+// PKIX format.
+type IdentityWebAuthn struct {
+	RPID   string
+	Public []byte
+}
+
+// WebAuthnAssertion is the signature of a WebAuthn identity. It is the
+// assertion returned by the authenticator for a challenge that is the
+// signed message.
+type WebAuthnAssertion struct {
+	AuthenticatorData []byte
+	ClientDataJSON    []byte
+	// Signature is the ASN.1 encoded ECDSA signature of the
+	// AuthenticatorData and the hash of the ClientDataJSON.
+	Signature []byte
+}
+
 // IdentityDarc is a structure that points to a Darc with a given ID on a
 // skipchain. The signer should belong to the Darc.
 type IdentityDarc struct {
@@ -101,9 +160,12 @@ type Signature struct {
 
 // Signer is a generic structure that can hold different types of signers
 type Signer struct {
-	Ed25519 *SignerEd25519
-	X509EC  *SignerX509EC
-	Proxy   *SignerProxy
+	Ed25519   *SignerEd25519
+	X509EC    *SignerX509EC
+	Proxy     *SignerProxy
+	BLS       *SignerBLS
+	Secp256k1 *SignerSecp256k1
+	WebAuthn  *SignerWebAuthn
 }
 
 // SignerEd25519 holds a public and private keys necessary to sign Darcs
@@ -127,6 +189,29 @@ type SignerProxy struct {
 	getSignature func([]byte) ([]byte, error)
 }
 
+// SignerBLS holds the marshalled public and private keys of a BLS signer on
+// the BN256 curve.
+type SignerBLS struct {
+	Public []byte
+	Secret []byte
+}
+
+// SignerSecp256k1 holds the compressed public key and the private key of a
+// secp256k1 signer.
+type SignerSecp256k1 struct {
+	Public []byte
+	Secret []byte
+}
+
+// SignerWebAuthn holds the credential of a WebAuthn authenticator. The
+// private key never leaves the authenticator, which is asked for an
+// assertion when signing.
+type SignerWebAuthn struct {
+	RPID         string
+	Public       []byte
+	getAssertion func([]byte) (*WebAuthnAssertion, error)
+}
+
 // Request is the structure that the client must provide to be verified
 type Request struct {
 	BaseID     ID
@@ -146,3 +231,44 @@ type Rule struct {
 	Action Action
 	Expr   expression.Expr
 }
+
+// EvalTrace is the trace of the evaluation of an expression.
+type EvalTrace struct {
+	// Expr is the evaluated expression.
+	Expr expression.Expr
+	// Result is the result of the evaluation.
+	Result bool
+	// Terms are the ids and the conditions of the expression, in the
+	// order they were evaluated.
+	Terms []TermTrace
+	// Failed is the first sub-expression that evaluated to false, if the
+	// result is false.
+	Failed string
+	// Error is set if the expression could not be evaluated.
+	Error string
+}
+
+// TermTrace is an id or a condition of an expression.
+type TermTrace struct {
+	// Term is the id or the condition.
+	Term string
+	// Match is true if the id signed or the condition is fulfilled.
+	Match bool
+	// Delegation is set if the term is a darc that has been followed.
+	Delegation *DelegationTrace
+}
+
+// DelegationTrace is the evaluation of the sign expression of a delegated
+// darc.
+type DelegationTrace struct {
+	// BaseID is the base ID of the darc.
+	BaseID ID
+	// Version is the version of the darc whose sign expression has been
+	// evaluated.
+	Version uint64
+	// Trace is the trace of the sign expression, it is not set if the
+	// darc has not been found or has no sign rule.
+	Trace *EvalTrace
+	// Error is set if the sign expression could not be evaluated.
+	Error string
+}
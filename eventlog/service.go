@@ -30,6 +30,7 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.ErrFatal(byzcoin.RegisterGlobalContract(contractName, contractFromBytes))
 }
 
 // Service is the EventLog service.
@@ -321,8 +322,6 @@ func newService(c *onet.Context) (onet.Service, error) {
 	if err := s.RegisterHandlers(s.Search); err != nil {
 		log.ErrFatal(err, "Couldn't register messages")
 	}
-
-	byzcoin.RegisterContract(s, contractName, contractFromBytes)
 	return s, nil
 }
 
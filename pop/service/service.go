@@ -73,6 +73,7 @@ func init() {
 		checkConfigReplyID = network.RegisterMessage(CheckConfigReply{})
 		mergeConfigID = network.RegisterMessage(MergeConfig{})
 		mergeConfigReplyID = network.RegisterMessage(MergeConfigReply{})
+		log.ErrFatal(byzcoin.RegisterGlobalContract(ContractPopParty, contractPopPartyFromBytes))
 	}
 }
 
@@ -1207,7 +1208,5 @@ func newService(c *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 
-	byzcoin.RegisterContract(c, ContractPopParty, contractPopPartyFromBytes)
-
 	return s, nil
 }
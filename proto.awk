@@ -5,6 +5,7 @@ BEGIN {
 	tr[ar"byte"]="bytes"
 	tr["abstract.Point"]="bytes"
 	tr["StateAction"]="int"
+	tr["ReplayProtection"]="int"
 	tr["byzcoin.InstanceID"]="bytes"
 	tr["Nonce"]="bytes"
 	print "syntax = \"proto2\";"
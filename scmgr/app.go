@@ -37,6 +37,8 @@ var bucketName = []byte("skipblocks")
 type config struct {
 	// The database holding all skipblocks
 	Db *skipchain.SkipBlockDB
+	// boltDB is the file of Db, which also holds the configuration values
+	boltDB *bolt.DB
 	// Values holds the different configuration values needed for scmgr
 	Values *values
 }
@@ -710,7 +712,11 @@ func loadConfig(c *cli.Context) (*config, error) {
 				}
 				return nil
 			})
-			cfg.Db = skipchain.NewSkipBlockDB(db, bucketName)
+			cfg.Db, err = skipchain.NewSkipBlockDB(db, bucketName)
+			if err != nil {
+				return nil, err
+			}
+			cfg.boltDB = db
 			return cfg, nil
 		}
 		return nil, fmt.Errorf("Could not open file %s", cfgPath)
@@ -719,8 +725,12 @@ func loadConfig(c *cli.Context) (*config, error) {
 	if err != nil {
 		return nil, err
 	}
-	cfg.Db = skipchain.NewSkipBlockDB(db, bucketName)
-	err = cfg.Db.View(func(tx *bolt.Tx) error {
+	cfg.Db, err = skipchain.NewSkipBlockDB(db, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	cfg.boltDB = db
+	err = cfg.boltDB.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("config"))
 		v := b.Get([]byte("values"))
 		if v != nil {
@@ -746,7 +756,7 @@ func (cfg *config) save(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	err = cfg.Db.Update(func(tx *bolt.Tx) error {
+	err = cfg.boltDB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("config"))
 		err := b.Put([]byte("values"), buf)
 		return err
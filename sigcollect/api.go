@@ -0,0 +1,67 @@
+package sigcollect
+
+import (
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// Client is a structure to communicate with the signature collection
+// service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient instantiates a new sigcollect.Client
+func NewClient() *Client {
+	return &Client{Client: onet.NewClient(cothority.Suite, ServiceName)}
+}
+
+// ExpectSigners sets the identities that are expected to sign the
+// instruction, in the order of its signer counters, before it is proposed.
+func ExpectSigners(instr *byzcoin.Instruction, ids ...darc.Identity) {
+	instr.Signatures = make([]darc.Signature, len(ids))
+	for i, id := range ids {
+		instr.Signatures[i] = darc.Signature{Signer: id}
+	}
+}
+
+// Propose sends a transaction whose instructions have their expected signers
+// set to the conode si, which collects the signatures. The ID of the returned
+// status is the message the signers have to sign.
+func (c *Client) Propose(si *network.ServerIdentity, byzcoinID skipchain.SkipBlockID, tx byzcoin.ClientTransaction) (*Status, error) {
+	reply := &Status{}
+	err := c.SendProtobuf(si, &Propose{ByzCoinID: byzcoinID, Transaction: tx}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Sign signs the pending transaction with the given ID with signer and sends
+// the signature to the conode si.
+func (c *Client) Sign(si *network.ServerIdentity, id []byte, signer darc.Signer) (*Status, error) {
+	sig, err := signer.Sign(id)
+	if err != nil {
+		return nil, err
+	}
+	reply := &Status{}
+	err = c.SendProtobuf(si, &Sign{ID: id, Signer: signer.Identity(), Signature: sig}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetStatus returns the status of the pending transaction with the given ID.
+func (c *Client) GetStatus(si *network.ServerIdentity, id []byte) (*Status, error) {
+	reply := &Status{}
+	err := c.SendProtobuf(si, &GetStatus{ID: id}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,65 @@
+package sigcollect
+
+import (
+	"sync"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+const dbVersion = 1
+
+var storageKey = []byte("storage")
+
+func init() {
+	network.RegisterMessage(&storage1{})
+}
+
+// saves all data. The storage must be locked.
+func (s *Service) save() error {
+	return s.Save(storageKey, s.storage)
+}
+
+// Tries to load the configuration and updates the data in the service
+// if it finds a valid config-file.
+func (s *Service) tryLoad() error {
+	s.storage = &storage1{}
+	ver, err := s.LoadVersion()
+	if err != nil {
+		return err
+	}
+	if ver < dbVersion {
+		// There is no version 0. Save empty storage and update version number.
+		if err = s.save(); err != nil {
+			return err
+		}
+		return s.SaveVersion(dbVersion)
+	}
+	buf, err := s.LoadRaw(storageKey)
+	if err != nil {
+		return err
+	}
+	return protobuf.DecodeWithConstructors(buf[16:], s.storage,
+		network.DefaultConstructors(cothority.Suite))
+}
+
+type storage1 struct {
+	// Pending are the transactions indexed by their ID.
+	Pending map[string]*pending
+
+	sync.Mutex
+}
+
+// pending is a transaction with the signatures collected so far.
+type pending struct {
+	ByzCoinID   skipchain.SkipBlockID
+	Transaction byzcoin.ClientTransaction
+	Submitted   bool
+	Error       string
+	// Created is the time of the proposal in nanoseconds, the transaction
+	// expires pendingExpiry later.
+	Created int64
+}
@@ -0,0 +1,85 @@
+package sigcollect
+
+import (
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+)
+
+func init() {
+	network.RegisterMessages(
+		&Propose{}, &Sign{}, &GetStatus{}, &Status{},
+	)
+}
+
+// PROTOSTART
+// type :skipchain.SkipBlockID:bytes
+// package sigcollect;
+//
+// import "byzcoin.proto";
+// import "darc.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "SigCollectProto";
+
+// Propose stores a transaction that needs the signatures of several
+// identities. In every instruction, the signatures list the identities that
+// are expected to sign it, in the order of the signer counters, and have an
+// empty Signature. Signatures that are already set are verified and kept.
+type Propose struct {
+	// ByzCoinID is the ledger the transaction will be sent to.
+	ByzCoinID skipchain.SkipBlockID
+	// Transaction is the transaction to sign.
+	Transaction byzcoin.ClientTransaction
+}
+
+// Sign adds the signature of an identity to a pending transaction. The
+// signature is on the ID, the hash of the instructions of the transaction,
+// and is added to all the instructions the identity is expected to sign.
+type Sign struct {
+	// ID of the pending transaction.
+	ID []byte
+	// Signer is the identity that signed.
+	Signer darc.Identity
+	// Signature on the ID.
+	Signature []byte
+}
+
+// GetStatus asks for the status of a pending transaction.
+type GetStatus struct {
+	// ID of the pending transaction.
+	ID []byte
+}
+
+// Status is the status of a pending transaction. It is returned by all the
+// calls of the service.
+type Status struct {
+	// ID is the hash of the instructions of the transaction.
+	ID []byte
+	// Instructions are the statuses of the instructions, in the order of
+	// the transaction.
+	Instructions []InstructionStatus
+	// Submitted is true once the transaction has been sent to ByzCoin.
+	Submitted bool
+	// Error is set if ByzCoin refused the transaction. It is submitted
+	// again when its status is asked for.
+	Error string
+}
+
+// InstructionStatus tells which of the expected identities signed an
+// instruction, and which signatures are still missing.
+type InstructionStatus struct {
+	// Action of the instruction.
+	Action string
+	// Signed are the identities that signed the instruction.
+	Signed []darc.Identity
+	// Missing are the identities whose signature is still needed before
+	// the transaction can be submitted.
+	Missing []darc.Identity
+	// Satisfied is true if the rule of the action in the darc of the
+	// instance evaluates to true with the identities that signed.
+	Satisfied bool
+	// Trace is the evaluation of the rule with the identities that signed.
+	Trace *darc.EvalTrace
+}
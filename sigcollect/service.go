@@ -0,0 +1,267 @@
+package sigcollect
+
+/*
+The service.go collects the signatures of the pending transactions and sends
+them to ByzCoin once they are complete.
+*/
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// Used for tests
+var sigCollectID onet.ServiceID
+
+// ServiceName of the signature collection service
+var ServiceName = "SigCollect"
+
+func init() {
+	var err error
+	sigCollectID, err = onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+}
+
+// pendingExpiry is how long a pending transaction is kept after it has been
+// proposed. As anybody can propose transactions, they are removed once they
+// expire, submitted or not.
+const pendingExpiry = 7 * 24 * time.Hour
+
+// Service stores the pending transactions and collects their signatures.
+type Service struct {
+	*onet.ServiceProcessor
+	omni *byzcoin.Service
+
+	storage *storage1
+}
+
+// Propose stores a new pending transaction and returns its status. If the
+// signatures given in the proposal are already enough, the transaction is
+// submitted right away.
+func (s *Service) Propose(req *Propose) (*Status, error) {
+	if len(req.ByzCoinID) == 0 {
+		return nil, errors.New("byzcoin ID required")
+	}
+	instrs := req.Transaction.Instructions
+	if len(instrs) == 0 {
+		return nil, errors.New("no instructions to sign")
+	}
+	id := instrs.Hash()
+	for i, instr := range instrs {
+		if len(instr.Signatures) == 0 {
+			return nil, errors.New("instruction without expected signers")
+		}
+		if len(instr.SignerCounter) > 0 && len(instr.SignerCounter) != len(instr.Signatures) {
+			return nil, errors.New("the number of signer counters and signers is different")
+		}
+		for _, sig := range instr.Signatures {
+			if !sig.Signer.PrimaryIdentity() {
+				return nil, errors.New("expected signers must be primary identities")
+			}
+			if len(sig.Signature) == 0 {
+				continue
+			}
+			if err := sig.Signer.Verify(id, sig.Signature); err != nil {
+				return nil, errors.New("wrong signature of " + sig.Signer.String() + ": " + err.Error())
+			}
+		}
+		log.Lvlf2("%s: proposed instruction %d: %s", s.ServerIdentity(), i, instr.Action())
+	}
+
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	s.removeExpired()
+	if _, ok := s.storage.Pending[string(id)]; ok {
+		return nil, errors.New("transaction already proposed")
+	}
+	p := &pending{
+		ByzCoinID:   req.ByzCoinID,
+		Transaction: req.Transaction,
+		Created:     time.Now().UnixNano(),
+	}
+	s.storage.Pending[string(id)] = p
+	return s.update(id, p)
+}
+
+// Sign adds the signature of an identity to all the instructions of a
+// pending transaction it is expected to sign. It returns the new status of
+// the transaction, which is submitted if the signature completes it.
+func (s *Service) Sign(req *Sign) (*Status, error) {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	s.removeExpired()
+	p, ok := s.storage.Pending[string(req.ID)]
+	if !ok {
+		return nil, errors.New("unknown transaction")
+	}
+	if p.Submitted {
+		return nil, errors.New("transaction already submitted")
+	}
+	if err := req.Signer.Verify(req.ID, req.Signature); err != nil {
+		return nil, errors.New("wrong signature: " + err.Error())
+	}
+	var found bool
+	for i := range p.Transaction.Instructions {
+		sigs := p.Transaction.Instructions[i].Signatures
+		for j := range sigs {
+			if sigs[j].Signer.Equal(&req.Signer) {
+				sigs[j].Signature = req.Signature
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, errors.New(req.Signer.String() + " is not an expected signer")
+	}
+	return s.update(req.ID, p)
+}
+
+// GetStatus returns the status of a pending transaction. If the transaction
+// is complete but ByzCoin refused it, it is submitted again.
+func (s *Service) GetStatus(req *GetStatus) (*Status, error) {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	s.removeExpired()
+	p, ok := s.storage.Pending[string(req.ID)]
+	if !ok {
+		return nil, errors.New("unknown transaction")
+	}
+	if p.Error != "" {
+		return s.update(req.ID, p)
+	}
+	return s.status(req.ID, p)
+}
+
+// removeExpired removes the pending transactions that have expired. The
+// storage must be locked.
+func (s *Service) removeExpired() {
+	limit := time.Now().Add(-pendingExpiry).UnixNano()
+	for id, p := range s.storage.Pending {
+		if p.Created < limit {
+			log.Lvlf2("%s: removing expired transaction %x", s.ServerIdentity(), id)
+			delete(s.storage.Pending, id)
+		}
+	}
+}
+
+// update computes the status of the pending transaction, submits it to
+// ByzCoin if no signature is missing anymore and saves the storage. The
+// transaction is only marked as submitted if ByzCoin accepts it, otherwise
+// the error is kept and it can be submitted again. The storage must be
+// locked.
+func (s *Service) update(id []byte, p *pending) (*Status, error) {
+	st, err := s.status(id, p)
+	if err != nil {
+		return nil, err
+	}
+	if complete(st) {
+		log.Lvlf2("%s: submitting transaction %x", s.ServerIdentity(), id)
+		_, err = s.omni.AddTransaction(&byzcoin.AddTxRequest{
+			Version:     byzcoin.CurrentVersion,
+			SkipchainID: p.ByzCoinID,
+			Transaction: p.signedTransaction(),
+		})
+		if err != nil {
+			p.Error = err.Error()
+		} else {
+			p.Submitted = true
+			p.Error = ""
+		}
+		st.Submitted = p.Submitted
+		st.Error = p.Error
+	}
+	return st, s.save()
+}
+
+// status evaluates the rules of the actions of the instructions with the
+// identities that signed them, against the context of the instructions, so
+// that the conditions on their arguments and rates are checked like ByzCoin
+// does.
+func (s *Service) status(id []byte, p *pending) (*Status, error) {
+	st := &Status{
+		ID:        id,
+		Submitted: p.Submitted,
+		Error:     p.Error,
+	}
+	trie, err := s.omni.GetReadOnlyStateTrie(p.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	for _, instr := range p.Transaction.Instructions {
+		is := InstructionStatus{Action: instr.Action()}
+		var missing []darc.Identity
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) > 0 {
+				is.Signed = append(is.Signed, sig.Signer)
+			} else {
+				missing = append(missing, sig.Signer)
+			}
+		}
+		trace, err := instr.ExplainAuthorization(trie, is.Signed...)
+		if trace == nil {
+			return nil, err
+		}
+		is.Trace = trace
+		is.Satisfied = trace.Result
+		// The signer counters are part of the signed hash, so every
+		// expected signer has to sign. Without counters, the signatures
+		// that are not needed by the rule can be left out.
+		if !is.Satisfied || len(instr.SignerCounter) > 0 {
+			is.Missing = missing
+		}
+		st.Instructions = append(st.Instructions, is)
+	}
+	return st, nil
+}
+
+// complete returns true if the transaction of the status can be submitted.
+func complete(st *Status) bool {
+	if st.Submitted {
+		return false
+	}
+	for _, is := range st.Instructions {
+		if !is.Satisfied || len(is.Missing) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// signedTransaction returns the transaction with only the signatures that
+// have been collected.
+func (p *pending) signedTransaction() byzcoin.ClientTransaction {
+	instrs := make(byzcoin.Instructions, len(p.Transaction.Instructions))
+	for i, instr := range p.Transaction.Instructions {
+		instrs[i] = instr
+		instrs[i].Signatures = nil
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) > 0 {
+				instrs[i].Signatures = append(instrs[i].Signatures, sig)
+			}
+		}
+	}
+	return byzcoin.ClientTransaction{Instructions: instrs}
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		omni:             c.Service(byzcoin.ServiceName).(*byzcoin.Service),
+	}
+	if err := s.RegisterHandlers(s.Propose, s.Sign, s.GetStatus); err != nil {
+		return nil, errors.New("couldn't register messages")
+	}
+	if err := s.tryLoad(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if len(s.storage.Pending) == 0 {
+		s.storage.Pending = make(map[string]*pending)
+	}
+	return s, nil
+}
@@ -0,0 +1,213 @@
+package sigcollect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin"
+	_ "github.com/dedis/cothority/byzcoin/contracts"
+	"github.com/dedis/cothority/darc"
+	"github.com/dedis/cothority/darc/expression"
+	"github.com/dedis/kyber/suites"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+// Proposes a spawn that needs two signatures and collects them one by one,
+// until the service submits it.
+func TestService_Counters(t *testing.T) {
+	s := newSer(t, byzcoin.ReplaySignerCounters, "&")
+	defer s.local.CloseAll()
+
+	instr := s.spawnInstr()
+	instr.SignerCounter = []uint64{1, 1}
+	ExpectSigners(&instr, s.signers[0].Identity(), s.signers[1].Identity())
+	tx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{instr}}
+	st, err := NewClient().Propose(s.roster.List[0], s.cl.ID, tx)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(st.Instructions))
+	require.Equal(t, "spawn:value", st.Instructions[0].Action)
+	require.Equal(t, 2, len(st.Instructions[0].Missing))
+	require.False(t, st.Instructions[0].Satisfied)
+	id := st.ID
+	require.Equal(t, tx.Instructions.Hash(), id)
+	_, err = NewClient().Propose(s.roster.List[0], s.cl.ID, tx)
+	require.NotNil(t, err)
+
+	// Only the expected signers with a correct signature are accepted.
+	other := darc.NewSignerEd25519(nil, nil)
+	_, err = NewClient().Sign(s.roster.List[0], id, other)
+	require.NotNil(t, err)
+	sig, err := s.signers[1].Sign([]byte("wrong message"))
+	require.Nil(t, err)
+	_, err = s.service.Sign(&Sign{ID: id, Signer: s.signers[1].Identity(), Signature: sig})
+	require.NotNil(t, err)
+
+	sigs := s.sign(id, s.signers...)
+	st, err = s.service.Sign(&Sign{ID: id, Signer: s.signers[0].Identity(), Signature: sigs[0]})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(st.Instructions[0].Signed))
+	require.Equal(t, 1, len(st.Instructions[0].Missing))
+	require.True(t, st.Instructions[0].Missing[0].Equal(&instr.Signatures[1].Signer))
+	require.False(t, st.Instructions[0].Satisfied)
+	require.NotNil(t, st.Instructions[0].Trace)
+	require.False(t, st.Submitted)
+
+	st, err = s.service.Sign(&Sign{ID: id, Signer: s.signers[1].Identity(), Signature: sigs[1]})
+	require.Nil(t, err)
+	require.True(t, st.Instructions[0].Satisfied)
+	require.Equal(t, 0, len(st.Instructions[0].Missing))
+	require.True(t, st.Submitted)
+	require.Equal(t, "", st.Error)
+
+	instr.Signatures[0].Signature = sigs[0]
+	instr.Signatures[1].Signature = sigs[1]
+	_, err = s.cl.WaitProof(instr.DeriveID(""), s.interval, nil)
+	require.Nil(t, err)
+
+	st, err = NewClient().GetStatus(s.roster.List[0], id)
+	require.Nil(t, err)
+	require.True(t, st.Submitted)
+	_, err = s.service.Sign(&Sign{ID: id, Signer: s.signers[1].Identity(), Signature: sigs[1]})
+	require.NotNil(t, err)
+}
+
+// With nonces, the transaction is submitted as soon as the rule is
+// fulfilled, without the signatures that are not needed.
+func TestService_Nonce(t *testing.T) {
+	s := newSer(t, byzcoin.ReplayNonce, "|")
+	defer s.local.CloseAll()
+
+	instr := s.spawnInstr()
+	instr.SetNonce(100)
+	ExpectSigners(&instr, s.signers[0].Identity(), s.signers[1].Identity())
+	tx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{instr}}
+	st, err := s.service.Propose(&Propose{ByzCoinID: s.cl.ID, Transaction: tx})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(st.Instructions[0].Missing))
+
+	sigs := s.sign(st.ID, s.signers[1])
+	st, err = s.service.Sign(&Sign{ID: st.ID, Signer: s.signers[1].Identity(), Signature: sigs[0]})
+	require.Nil(t, err)
+	require.True(t, st.Instructions[0].Satisfied)
+	require.Equal(t, 0, len(st.Instructions[0].Missing))
+	require.True(t, st.Submitted)
+
+	instr.Signatures = []darc.Signature{{Signer: s.signers[1].Identity(), Signature: sigs[0]}}
+	_, err = s.cl.WaitProof(instr.DeriveID(""), s.interval, nil)
+	require.Nil(t, err)
+
+	// Saving and loading keeps the submitted transaction.
+	require.Nil(t, s.service.tryLoad())
+	st, err = s.service.GetStatus(&GetStatus{ID: st.ID})
+	require.Nil(t, err)
+	require.True(t, st.Submitted)
+}
+
+// The conditions on the arguments of the instruction are evaluated.
+func TestService_Conditions(t *testing.T) {
+	s := newSer(t, byzcoin.ReplayNonce, "& arg(value) in (value) &")
+	defer s.local.CloseAll()
+
+	instr := s.spawnInstr()
+	instr.SetNonce(100)
+	ExpectSigners(&instr, s.signers[0].Identity(), s.signers[1].Identity())
+	tx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{instr}}
+	st, err := s.service.Propose(&Propose{ByzCoinID: s.cl.ID, Transaction: tx})
+	require.Nil(t, err)
+
+	sigs := s.sign(st.ID, s.signers...)
+	st, err = s.service.Sign(&Sign{ID: st.ID, Signer: s.signers[0].Identity(), Signature: sigs[0]})
+	require.Nil(t, err)
+	require.False(t, st.Instructions[0].Satisfied)
+	st, err = s.service.Sign(&Sign{ID: st.ID, Signer: s.signers[1].Identity(), Signature: sigs[1]})
+	require.Nil(t, err)
+	require.True(t, st.Instructions[0].Satisfied)
+	require.True(t, st.Submitted)
+}
+
+// The pending transactions are removed once they expire.
+func TestService_Expiry(t *testing.T) {
+	s := newSer(t, byzcoin.ReplayNonce, "|")
+	defer s.local.CloseAll()
+
+	instr := s.spawnInstr()
+	instr.SetNonce(100)
+	ExpectSigners(&instr, s.signers[0].Identity(), s.signers[1].Identity())
+	tx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{instr}}
+	st, err := s.service.Propose(&Propose{ByzCoinID: s.cl.ID, Transaction: tx})
+	require.Nil(t, err)
+	_, err = s.service.GetStatus(&GetStatus{ID: st.ID})
+	require.Nil(t, err)
+
+	s.service.storage.Lock()
+	s.service.storage.Pending[string(st.ID)].Created -= int64(pendingExpiry)
+	s.service.storage.Unlock()
+	_, err = s.service.GetStatus(&GetStatus{ID: st.ID})
+	require.NotNil(t, err)
+	// Once removed, it can be proposed again.
+	_, err = s.service.Propose(&Propose{ByzCoinID: s.cl.ID, Transaction: tx})
+	require.Nil(t, err)
+}
+
+type ser struct {
+	local    *onet.LocalTest
+	roster   *onet.Roster
+	service  *Service
+	cl       *byzcoin.Client
+	gDarc    darc.Darc
+	signers  []darc.Signer
+	interval time.Duration
+}
+
+// newSer creates a ledger whose genesis darc needs the signatures of the
+// two signers, combined with op, to spawn a value.
+func newSer(t *testing.T, rp byzcoin.ReplayProtection, op string) *ser {
+	s := &ser{
+		local:    onet.NewTCPTest(tSuite),
+		signers:  []darc.Signer{darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil)},
+		interval: 500 * time.Millisecond,
+	}
+	hosts, roster, _ := s.local.GenTree(3, true)
+	s.roster = roster
+	s.service = s.local.GetServices(hosts, sigCollectID)[0].(*Service)
+
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster, []string{"spawn:value"},
+		s.signers[0].Identity())
+	require.Nil(t, err)
+	expr := expression.Expr(s.signers[0].Identity().String() + " " + op + " " + s.signers[1].Identity().String())
+	require.Nil(t, msg.GenesisDarc.Rules.UpdateRule("spawn:value", expr))
+	msg.BlockInterval = s.interval
+	msg.ReplayProtection = rp
+	s.gDarc = msg.GenesisDarc
+	s.cl, _, err = byzcoin.NewLedger(msg, false)
+	require.Nil(t, err)
+	return s
+}
+
+func (s *ser) spawnInstr() byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(s.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: "value",
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte("value")}},
+		},
+	}
+}
+
+func (s *ser) sign(id []byte, signers ...darc.Signer) [][]byte {
+	sigs := make([][]byte, len(signers))
+	for i, signer := range signers {
+		sig, err := signer.Sign(id)
+		log.ErrFatal(err)
+		sigs[i] = sig
+	}
+	return sigs
+}
@@ -349,6 +349,32 @@ func (c *Client) GetSingleBlockByIndex(roster *onet.Roster, genesis SkipBlockID,
 	return nil, errors.New("all nodes failed to return block: " + strings.Join(errs, " :: "))
 }
 
+// GetCompactProof returns the compact proof from the genesis-block to the
+// latest block of the skipchain. The proof is verified before it is returned.
+func (c *Client) GetCompactProof(roster *onet.Roster, genesis SkipBlockID) (*CompactProof, error) {
+	reply := &GetCompactProofReply{}
+	perms := rand.Perm(len(roster.List))
+	var errs []string
+	for _, ind := range perms {
+		err := c.SendProtobuf(roster.List[ind],
+			&GetCompactProof{Genesis: genesis}, reply)
+		if err == nil {
+			if reply.Proof == nil {
+				err = errors.New("empty proof")
+			} else if !reply.Proof.SkipChainID().Equal(genesis) {
+				err = errors.New("proof of another skipchain")
+			} else {
+				err = reply.Proof.Verify()
+			}
+			if err == nil {
+				return reply.Proof, nil
+			}
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, errors.New("all nodes failed to return proof: " + strings.Join(errs, " :: "))
+}
+
 // CreateLinkPrivate asks the conode to create a link by sending a public
 // key of the client, signed by the private key of the conode. The reasoning is
 // that an administrator should well be able to copy the private.toml-file from
@@ -142,6 +142,76 @@ func TestClient_GetUpdateChain(t *testing.T) {
 	}
 }
 
+func TestClient_GetCompactProof(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(4, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	ro3 := onet.NewRoster(roster.List[:3])
+	genesis, err := c.CreateGenesis(ro3, 2, 3, VerificationNone, nil, nil)
+	require.Nil(t, err)
+	latest := genesis
+	for i := 1; i < 8; i++ {
+		// Add the fourth conode to the roster halfway.
+		ro := ro3
+		if i >= 4 {
+			ro = roster
+		}
+		reply, err := c.StoreSkipBlock(latest, ro, []byte{byte(i)})
+		require.Nil(t, err)
+		latest = reply.Latest
+	}
+
+	proof, err := c.GetCompactProof(roster, genesis.Hash)
+	require.Nil(t, err)
+	require.True(t, proof.SkipChainID().Equal(genesis.Hash))
+	require.True(t, proof.Latest().Equal(latest.Hash))
+	require.Nil(t, proof.Genesis.ForwardLink)
+	lb, err := proof.LatestBlock()
+	require.Nil(t, err)
+	require.True(t, lb.Hash.Equal(latest.Hash))
+	require.Equal(t, latest.Index, lb.Index)
+	require.Equal(t, latest.Height, lb.Height)
+	require.Equal(t, latest.BackLinkIDs, lb.BackLinkIDs)
+	require.True(t, lb.Roster.ID.Equal(roster.ID))
+	for _, cl := range proof.Links {
+		require.Nil(t, cl.Block.Roster)
+	}
+	var delta *RosterDelta
+	for _, cl := range proof.Links {
+		if cl.Delta != nil {
+			delta = cl.Delta
+		}
+	}
+	require.NotNil(t, delta)
+	require.Equal(t, []int{0, 1, 2, 3}, delta.Indexes)
+	require.Equal(t, 1, len(delta.Added))
+
+	// The proof of the update chain from the genesis block leads to the
+	// same block.
+	guc, err := c.GetUpdateChain(ro3, genesis.Hash)
+	require.Nil(t, err)
+	cp, err := Proof(guc.Update).Compact()
+	require.Nil(t, err)
+	require.Nil(t, cp.Verify())
+	require.True(t, cp.Latest().Equal(latest.Hash))
+
+	// A wrong roster or a wrong block must be detected.
+	delta.Indexes[0], delta.Indexes[3] = delta.Indexes[3], delta.Indexes[0]
+	require.NotNil(t, proof.Verify())
+	delta.Indexes[0], delta.Indexes[3] = delta.Indexes[3], delta.Indexes[0]
+	require.Nil(t, proof.Verify())
+	proof.Links[0].Block.Index++
+	require.NotNil(t, proof.Verify())
+	proof.Links[0].Block.Index--
+	require.Nil(t, proof.Verify())
+	proof.Links[0].To = latest.Hash
+	require.NotNil(t, proof.Verify())
+	proof.Genesis.Data = []byte{1}
+	require.NotNil(t, proof.Verify())
+}
+
 func TestClient_StoreSkipBlock(t *testing.T) {
 	nbrHosts := 3
 	l := onet.NewTCPTest(cothority.Suite)
@@ -0,0 +1,217 @@
+package skipchain
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/kyber/pairing"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// CompactProof proves that a block is part of a skipchain, like a Proof, but
+// without sending all the blocks on the path. For every forward-link, it
+// holds its signature, the changes of the roster and the header of its
+// target: the block without its payload, forward-links and children, and
+// without its roster, which is given by the changes.
+type CompactProof struct {
+	// Genesis is the genesis block without its forward-links, children and
+	// payload. Its data and roster are kept because they are part of its
+	// hash.
+	Genesis *SkipBlock
+	// Links are the forward-links from the genesis block to the latest
+	// block, each one starting at the target of the previous one.
+	Links []*CompactLink
+}
+
+// CompactLink is a forward-link whose source is the target of the previous
+// link, and whose new roster is given as a change of the current roster.
+type CompactLink struct {
+	// To is the block the link points to.
+	To SkipBlockID
+	// Delta is the change of the roster, or nil if the roster stays the same.
+	Delta *RosterDelta `protobuf:"opt"`
+	// Signature of the link by the current roster.
+	Signature byzcoinx.FinalSignature
+	// Block is the header of the block the link points to, without its
+	// roster. Its data is kept because it is part of its hash, the
+	// payload of the block is not.
+	Block *SkipBlockFix
+}
+
+// RosterDelta describes a new roster by the changes to the previous roster.
+type RosterDelta struct {
+	// ID of the new roster, it is part of the signed hash of the link.
+	ID onet.RosterID
+	// Indexes are the servers of the new roster in order: an index lower than
+	// the length of the previous roster points into the previous roster,
+	// the others point into Added, after the previous roster.
+	Indexes []int
+	// Added are the servers that are not in the previous roster.
+	Added []*network.ServerIdentity
+}
+
+// Compact returns the compact form of the proof, which must start at the
+// genesis block. The links between two blocks need not be the highest ones.
+func (sbs Proof) Compact() (*CompactProof, error) {
+	if len(sbs) == 0 {
+		return nil, errors.New("Empty list of blocks")
+	}
+	if sbs[0].Index != 0 {
+		return nil, errors.New("First element must be a genesis")
+	}
+	genesis := sbs[0].Copy()
+	genesis.ForwardLink = nil
+	genesis.ChildSL = nil
+	genesis.Payload = nil
+	cp := &CompactProof{Genesis: genesis}
+
+	roster := genesis.Roster
+	for i, sb := range sbs[:len(sbs)-1] {
+		var fl *ForwardLink
+		for _, l := range sb.ForwardLink {
+			if l != nil && l.To.Equal(sbs[i+1].Hash) {
+				fl = l
+			}
+		}
+		if fl == nil {
+			return nil, errors.New("Missing forward links")
+		}
+		cl := &CompactLink{
+			To:        fl.To,
+			Signature: fl.Signature,
+			Block:     sbs[i+1].SkipBlockFix.Copy(),
+		}
+		cl.Block.Roster = nil
+		if fl.NewRoster != nil {
+			cl.Delta = NewRosterDelta(roster, fl.NewRoster)
+			roster = fl.NewRoster
+		}
+		cp.Links = append(cp.Links, cl)
+	}
+	return cp, nil
+}
+
+// Verify checks that the genesis block is correct and that every link is
+// signed by the roster of the block it starts from and points to a block
+// with the header of the link, which links back to the source of the link.
+// It returns nil if the latest block is part of the skipchain.
+func (cp *CompactProof) Verify() error {
+	_, err := cp.LatestBlock()
+	return err
+}
+
+// SkipChainID returns the ID of the skipchain of the proof.
+func (cp *CompactProof) SkipChainID() SkipBlockID {
+	return cp.Genesis.Hash
+}
+
+// Latest returns the ID of the block the proof leads to.
+func (cp *CompactProof) Latest() SkipBlockID {
+	if len(cp.Links) == 0 {
+		return cp.Genesis.Hash
+	}
+	return cp.Links[len(cp.Links)-1].To
+}
+
+// LatestBlock verifies the proof and returns the block it leads to, with its
+// roster but without its payload, forward-links and children.
+func (cp *CompactProof) LatestBlock() (*SkipBlock, error) {
+	if cp.Genesis == nil || cp.Genesis.SkipBlockFix == nil {
+		return nil, errors.New("Missing genesis block")
+	}
+	if cp.Genesis.Index != 0 {
+		return nil, errors.New("First element must be a genesis")
+	}
+	if !cp.Genesis.CalculateHash().Equal(cp.Genesis.Hash) {
+		return nil, errors.New("Wrong hash")
+	}
+	if cp.Genesis.Roster == nil {
+		return nil, errors.New("Missing roster of the genesis block")
+	}
+
+	suite := pairing.NewSuiteBn256()
+	latest := &SkipBlock{SkipBlockFix: cp.Genesis.SkipBlockFix.Copy(), Hash: cp.Genesis.Hash}
+	for _, cl := range cp.Links {
+		if cl.Block == nil {
+			return nil, errors.New("Missing block of a link")
+		}
+		roster := latest.Roster
+		fl := &ForwardLink{
+			From:      latest.Hash,
+			To:        cl.To,
+			Signature: cl.Signature,
+		}
+		next := roster
+		if cl.Delta != nil {
+			var err error
+			next, err = cl.Delta.Apply(roster)
+			if err != nil {
+				return nil, err
+			}
+			fl.NewRoster = next
+		}
+		if err := fl.Verify(suite, roster.ServicePublics(ServiceName)); err != nil {
+			return nil, err
+		}
+
+		sbf := cl.Block.Copy()
+		sbf.Roster = next
+		if !sbf.CalculateHash().Equal(cl.To) {
+			return nil, errors.New("Wrong hash of a linked block")
+		}
+		if sbf.Index <= latest.Index || !sbf.GenesisID.Equal(cp.Genesis.Hash) {
+			return nil, errors.New("Linked block is not a later block of the skipchain")
+		}
+		hit := false
+		for _, bl := range sbf.BackLinkIDs {
+			if bl.Equal(latest.Hash) {
+				hit = true
+			}
+		}
+		if !hit {
+			return nil, errors.New("Missing backlink")
+		}
+		latest = &SkipBlock{SkipBlockFix: sbf, Hash: cl.To}
+	}
+	return latest, nil
+}
+
+// NewRosterDelta returns the changes from the roster prev to the roster next.
+func NewRosterDelta(prev, next *onet.Roster) *RosterDelta {
+	rd := &RosterDelta{ID: next.ID}
+	for _, si := range next.List {
+		i, _ := prev.Search(si.ID)
+		if i < 0 {
+			i = len(prev.List) + len(rd.Added)
+			rd.Added = append(rd.Added, si)
+		}
+		rd.Indexes = append(rd.Indexes, i)
+	}
+	return rd
+}
+
+// Apply returns the new roster from the previous roster. As the ID of a
+// roster is derived from its servers, an error is returned if the new
+// roster doesn't have the ID of the delta.
+func (rd *RosterDelta) Apply(prev *onet.Roster) (*onet.Roster, error) {
+	if len(rd.Indexes) == 0 {
+		return nil, errors.New("empty roster in delta")
+	}
+	list := make([]*network.ServerIdentity, len(rd.Indexes))
+	for i, idx := range rd.Indexes {
+		switch {
+		case idx >= 0 && idx < len(prev.List):
+			list[i] = prev.List[idx]
+		case idx >= len(prev.List) && idx < len(prev.List)+len(rd.Added):
+			list[i] = rd.Added[idx-len(prev.List)]
+		default:
+			return nil, errors.New("index of the delta is out of range")
+		}
+	}
+	roster := onet.NewRoster(list)
+	if roster == nil || !roster.ID.Equal(rd.ID) {
+		return nil, errors.New("roster of the delta doesn't match its ID")
+	}
+	return roster, nil
+}
@@ -15,6 +15,8 @@ func init() {
 		// Requests for data
 		&GetUpdateChain{},
 		&GetUpdateChainReply{},
+		&GetCompactProof{},
+		&GetCompactProofReply{},
 		// Request updated block
 		&GetSingleBlock{},
 		// Fetch all skipchains
@@ -106,6 +108,18 @@ type GetUpdateChainReply struct {
 	Update []*SkipBlock
 }
 
+// GetCompactProof - the client sends the ID of a skipchain and will get
+// back the compact proof from the genesis block to the latest block, using
+// the highest forward-links.
+type GetCompactProof struct {
+	Genesis SkipBlockID
+}
+
+// GetCompactProofReply - returns the compact proof of the skipchain
+type GetCompactProofReply struct {
+	Proof *CompactProof
+}
+
 // GetAllSkipchains - erronously returns all blocks. Deprecated.
 type GetAllSkipchains struct {
 }
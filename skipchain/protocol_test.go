@@ -64,12 +64,16 @@ func TestGB(t *testing.T) {
 	sb1.ForwardLink = []*ForwardLink{sig12, sig13}
 
 	db, bucket := ts0.GetAdditionalBucket([]byte("skipblocks"))
-	ts0.Db = NewSkipBlockDB(db, bucket)
+	var err error
+	ts0.Db, err = NewSkipBlockDB(db, bucket)
+	require.Nil(t, err)
 	db, bucket = ts1.GetAdditionalBucket([]byte("skipblocks"))
-	ts1.Db = NewSkipBlockDB(db, bucket)
-	ts2.Db = NewSkipBlockDB(db, bucket)
+	ts1.Db, err = NewSkipBlockDB(db, bucket)
+	require.Nil(t, err)
+	ts2.Db, err = NewSkipBlockDB(db, bucket)
+	require.Nil(t, err)
 	blocks := []*SkipBlock{sb0, sb1, sb2, sb3}
-	_, err := ts0.Db.StoreBlocks(blocks)
+	_, err = ts0.Db.StoreBlocks(blocks)
 	require.Nil(t, err)
 	_, err = ts1.Db.StoreBlocks(blocks)
 	require.Nil(t, err)
@@ -15,6 +15,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -423,6 +424,24 @@ func (s *Service) GetUpdateChain(guc *GetUpdateChain) (*GetUpdateChainReply, err
 	return reply, nil
 }
 
+// GetCompactProof returns the compact proof from the genesis block to the
+// latest block of a skipchain. It is much smaller than the blocks returned by
+// GetUpdateChain, as it holds only the genesis block and the forward-links.
+func (s *Service) GetCompactProof(gcp *GetCompactProof) (*GetCompactProofReply, error) {
+	sb := s.db.GetByID(gcp.Genesis)
+	if sb == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+	if sb.Index != 0 {
+		return nil, errors.New("Not a genesis-block")
+	}
+	proof, err := s.db.GetCompactProof(gcp.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	return &GetCompactProofReply{Proof: proof}, nil
+}
+
 // RegisterStoreSkipblockCallback sets a callback function in SkipBlockDB,
 // which is called just before a skipblock is added/updated.
 func (s *Service) RegisterStoreSkipblockCallback(f func(SkipBlockID) error) {
@@ -546,6 +565,11 @@ func (s *Service) GetSingleBlock(id *GetSingleBlock) (*SkipBlock, error) {
 
 // GetSingleBlockByIndex searches for the given block and returns it. If no such block is
 // found, a nil is returned.
+//
+// The index of the db finds the block directly, but the reply also holds
+// the forward-links from the genesis block to it, which prove to the client
+// that the block is part of the skipchain. They are collected by following
+// the highest forward-links, so only the blocks on that path are read.
 func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*GetSingleBlockByIndexReply, error) {
 	sb := s.db.GetByID(id.Genesis)
 	if sb == nil {
@@ -558,18 +582,26 @@ func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*GetSingleBl
 	if sb.Index == id.Index {
 		return &GetSingleBlockByIndexReply{sb, links}, nil
 	}
+	// The index of the db tells whether the block exists, before the path
+	// to it is followed.
+	if s.db.GetByIndex(id.Genesis, id.Index) == nil {
+		return nil, errors.New("No block with this index found")
+	}
 	for len(sb.ForwardLink) > 0 {
 		// Search for the highest ForwardLink that doesn't shoot over the target
 		sb = func() *SkipBlock {
 			for i := len(sb.ForwardLink) - 1; i >= 0; i-- {
 				to := sb.ForwardLink[i].To
-				// We can have holes in the forward links
-				if to != nil {
-					tmp := s.db.GetByID(to)
-					if tmp != nil && tmp.Index <= id.Index {
-						links = append(links, sb.ForwardLink[i])
-						return tmp
-					}
+				// We can have holes in the forward links, and the links
+				// that are too high can be skipped without reading their
+				// target.
+				if to == nil || sb.Index+pow(sb.BaseHeight, i) > id.Index {
+					continue
+				}
+				tmp := s.db.GetByID(to)
+				if tmp != nil && tmp.Index <= id.Index {
+					links = append(links, sb.ForwardLink[i])
+					return tmp
 				}
 			}
 			return nil
@@ -584,6 +616,16 @@ func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*GetSingleBl
 	return nil, errors.New("No block with this index found")
 }
 
+// pow returns base^exp, the distance covered by a forward-link of height
+// exp+1. It stops growing once it is bigger than any index.
+func pow(base, exp int) int {
+	res := 1
+	for ; exp > 0 && res <= math.MaxInt32; exp-- {
+		res *= base
+	}
+	return res
+}
+
 // GetAllSkipchains currently returns a list of all the known blocks.
 // This is a bug, but for backwards compatibility it is being left as is.
 //
@@ -1677,9 +1719,13 @@ func sliceToArr(msg []byte) [32]byte {
 
 func newSkipchainService(c *onet.Context) (onet.Service, error) {
 	db, bucket := c.GetAdditionalBucket([]byte("skipblocks"))
+	sbDB, err := NewSkipBlockDB(db, bucket)
+	if err != nil {
+		return nil, err
+	}
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
-		db:               NewSkipBlockDB(db, bucket),
+		db:               sbDB,
 		Storage:          &Storage{},
 		verifiers:        map[VerifierID]SkipBlockVerifier{},
 		propTimeout:      defaultPropagateTimeout,
@@ -1692,7 +1738,7 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 	}
 	log.ErrFatal(s.RegisterHandlers(s.StoreSkipBlock, s.GetUpdateChain,
 		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetAllSkipchains,
-		s.GetAllSkipChainIDs,
+		s.GetAllSkipChainIDs, s.GetCompactProof,
 		s.CreateLinkPrivate, s.Unlink, s.AddFollow, s.ListFollow,
 		s.DelFollow, s.Listlink))
 	s.ServiceProcessor.RegisterStatusReporter("Skipblock", s.db)
@@ -10,7 +10,6 @@ import (
 	"testing"
 	"time"
 
-	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/schnorr"
@@ -1306,8 +1305,8 @@ func nukeBlocksFrom(t *testing.T, db *SkipBlockDB, where SkipBlockID) {
 
 		// nuke it
 		log.Lvl2("nuking block", sb.Index)
-		err := db.Update(func(tx *bolt.Tx) error {
-			err := tx.Bucket([]byte(db.bucketName)).Delete(where)
+		err := db.Backend().Update(func(tx SkipBlockTx) error {
+			err := tx.Delete(where)
 			if err != nil {
 				log.Fatal("delete error", err)
 			}
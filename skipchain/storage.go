@@ -0,0 +1,303 @@
+package skipchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/network"
+)
+
+// SkipBlockStore is the interface for the storage backend of a SkipBlockDB.
+// Besides the blocks, it keeps two indexes: the ID of the block of a
+// skipchain at a given index, and the ID of the block with the highest index
+// of a skipchain.
+type SkipBlockStore interface {
+	// Update executes a function within the context of a read-write
+	// transaction. If no error is returned from the function then every
+	// operation performed in the transaction is committed. If an error is
+	// returned then nothing gets committed.
+	Update(func(SkipBlockTx) error) error
+	// View executes a function within the context of a read-only
+	// transaction. Any error that is returned from the function is
+	// returned from the method.
+	View(func(SkipBlockTx) error) error
+	// Stats returns the number of blocks and the number of bytes they use.
+	Stats() (blocks int, bytes int)
+	// Close closes the storage, it must not be used afterwards.
+	Close() error
+}
+
+// SkipBlockTx gives access to the blocks and the indexes of a
+// SkipBlockStore. It is invalid if it is used outside of a transaction.
+type SkipBlockTx interface {
+	// Get returns a copy of the block with the given ID, or nil if it does
+	// not exist.
+	Get(id SkipBlockID) (*SkipBlock, error)
+	// Put stores the block, overwriting an existing block with the same ID,
+	// and updates the indexes.
+	Put(sb *SkipBlock) error
+	// Delete removes the block and its entries in the indexes. Nothing is
+	// done if the block does not exist.
+	Delete(id SkipBlockID) error
+	// GetByIndex returns the block of the skipchain with the given index,
+	// or nil if it does not exist.
+	GetByIndex(genesis SkipBlockID, index int) (*SkipBlock, error)
+	// GetLatest returns the block with the highest index of the skipchain,
+	// or nil if the skipchain does not exist.
+	GetLatest(genesis SkipBlockID) (*SkipBlock, error)
+	// ForEach calls f with every block, and stops at the first error.
+	ForEach(f func(*SkipBlock) error) error
+	// ForEachLatest calls f with the latest block of every skipchain, and
+	// stops at the first error.
+	ForEachLatest(f func(*SkipBlock) error) error
+}
+
+// boltStore is the SkipBlockStore implementation for boltdb. The blocks are
+// stored by ID in the bucket, the indexes in two other buckets named after
+// it.
+type boltStore struct {
+	db           *bolt.DB
+	bucket       []byte
+	indexBucket  []byte
+	latestBucket []byte
+}
+
+// NewBoltSkipBlockStore returns a SkipBlockStore that stores the blocks in
+// the given bucket of db, which must exist. The buckets of the indexes are
+// created if they don't exist yet, and filled with the blocks that are
+// already stored.
+func NewBoltSkipBlockStore(db *bolt.DB, bucket []byte) (SkipBlockStore, error) {
+	s := &boltStore{
+		db:           db,
+		bucket:       bucket,
+		indexBucket:  append(append([]byte{}, bucket...), []byte("_index")...),
+		latestBucket: append(append([]byte{}, bucket...), []byte("_latest")...),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(s.indexBucket) != nil && tx.Bucket(s.latestBucket) != nil {
+			return nil
+		}
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+		index, err := tx.CreateBucketIfNotExists(s.indexBucket)
+		if err != nil {
+			return err
+		}
+		latest, err := tx.CreateBucketIfNotExists(s.latestBucket)
+		if err != nil {
+			return err
+		}
+		btx := &boltTx{blocks: b, index: index, latest: latest}
+		return b.ForEach(func(k, v []byte) error {
+			sb, err := decodeSkipBlock(v)
+			if err != nil {
+				return err
+			}
+			return btx.addToIndexes(sb)
+		})
+	})
+	return s, err
+}
+
+func (s *boltStore) Update(f func(SkipBlockTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		btx, err := s.newTx(tx)
+		if err != nil {
+			return err
+		}
+		return f(btx)
+	})
+}
+
+func (s *boltStore) View(f func(SkipBlockTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		btx, err := s.newTx(tx)
+		if err != nil {
+			return err
+		}
+		return f(btx)
+	})
+}
+
+func (s *boltStore) Stats() (blocks int, bytes int) {
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		st := b.Stats()
+		blocks = st.KeyN
+		bytes = st.BranchInuse + st.LeafInuse
+		return nil
+	})
+	return
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltStore) newTx(tx *bolt.Tx) (*boltTx, error) {
+	btx := &boltTx{
+		blocks: tx.Bucket(s.bucket),
+		index:  tx.Bucket(s.indexBucket),
+		latest: tx.Bucket(s.latestBucket),
+	}
+	if btx.blocks == nil || btx.index == nil || btx.latest == nil {
+		return nil, errors.New("bucket does not exist")
+	}
+	return btx, nil
+}
+
+type boltTx struct {
+	blocks *bolt.Bucket
+	index  *bolt.Bucket
+	latest *bolt.Bucket
+}
+
+func (t *boltTx) Get(id SkipBlockID) (*SkipBlock, error) {
+	val := t.blocks.Get(id)
+	if val == nil {
+		return nil, nil
+	}
+	return decodeSkipBlock(val)
+}
+
+func (t *boltTx) Put(sb *SkipBlock) error {
+	val, err := network.Marshal(sb)
+	if err != nil {
+		return err
+	}
+	if err := t.blocks.Put(sb.Hash, val); err != nil {
+		return err
+	}
+	return t.addToIndexes(sb)
+}
+
+func (t *boltTx) Delete(id SkipBlockID) error {
+	sb, err := t.Get(id)
+	if err != nil || sb == nil {
+		return err
+	}
+	if err := t.blocks.Delete(id); err != nil {
+		return err
+	}
+	genesis := sb.SkipChainID()
+	if len(genesis) == 0 {
+		return nil
+	}
+	key := indexKey(genesis, sb.Index)
+	if bytes.Equal(t.index.Get(key), id) {
+		if err := t.index.Delete(key); err != nil {
+			return err
+		}
+	}
+	cur := t.latest.Get(genesis)
+	if cur == nil || !bytes.Equal(cur[8:], id) {
+		return nil
+	}
+
+	// Look for the block with the highest index that is left, the keys
+	// of the index are sorted by skipchain and then by index.
+	c := t.index.Cursor()
+	k, v := c.Seek(indexKey(genesis, -1))
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	if k == nil || !bytes.HasPrefix(k, genesis) || len(k) != len(genesis)+8 {
+		return t.latest.Delete(genesis)
+	}
+	return t.latest.Put(genesis, append(append([]byte{}, k[len(genesis):]...), v...))
+}
+
+func (t *boltTx) GetByIndex(genesis SkipBlockID, index int) (*SkipBlock, error) {
+	id := t.index.Get(indexKey(genesis, index))
+	if id == nil {
+		return nil, nil
+	}
+	return t.Get(id)
+}
+
+func (t *boltTx) GetLatest(genesis SkipBlockID) (*SkipBlock, error) {
+	cur := t.latest.Get(genesis)
+	if cur == nil {
+		return nil, nil
+	}
+	return t.Get(cur[8:])
+}
+
+func (t *boltTx) ForEach(f func(*SkipBlock) error) error {
+	return t.blocks.ForEach(func(k, v []byte) error {
+		sb, err := decodeSkipBlock(v)
+		if err != nil {
+			return err
+		}
+		return f(sb)
+	})
+}
+
+func (t *boltTx) ForEachLatest(f func(*SkipBlock) error) error {
+	return t.latest.ForEach(func(k, v []byte) error {
+		sb, err := t.Get(v[8:])
+		if err != nil {
+			return err
+		}
+		if sb == nil {
+			return errors.New("missing latest block")
+		}
+		return f(sb)
+	})
+}
+
+// addToIndexes adds the block to the index of its skipchain, and makes it
+// the latest block if its index is the highest. A block that doesn't know its
+// skipchain is not indexed.
+func (t *boltTx) addToIndexes(sb *SkipBlock) error {
+	genesis := sb.SkipChainID()
+	if len(genesis) == 0 {
+		return nil
+	}
+	if err := t.index.Put(indexKey(genesis, sb.Index), sb.Hash); err != nil {
+		return err
+	}
+	cur := t.latest.Get(genesis)
+	if cur != nil && binary.BigEndian.Uint64(cur[:8]) > uint64(sb.Index) {
+		return nil
+	}
+	val := make([]byte, 8, 8+len(sb.Hash))
+	binary.BigEndian.PutUint64(val, uint64(sb.Index))
+	return t.latest.Put(genesis, append(val, sb.Hash...))
+}
+
+// indexKey returns the key of the block with the given index in the index of
+// the skipchain. The index is big-endian so that the keys of a skipchain are
+// sorted by index, -1 gives a key after all of them.
+func indexKey(genesis SkipBlockID, index int) []byte {
+	key := make([]byte, len(genesis)+8)
+	copy(key, genesis)
+	binary.BigEndian.PutUint64(key[len(genesis):], uint64(index))
+	return key
+}
+
+// decodeSkipBlock returns a copy of the block stored in val.
+func decodeSkipBlock(val []byte) (*SkipBlock, error) {
+	// For some reason boltdb changes the val before Unmarshal finishes. When
+	// copying the value into a buffer, there is no SIGSEGV anymore.
+	buf := make([]byte, len(val))
+	copy(buf, val)
+	_, sbMsg, err := network.Unmarshal(buf, suite)
+	if err != nil {
+		return nil, err
+	}
+	sb, ok := sbMsg.(*SkipBlock)
+	if !ok {
+		return nil, errors.New("stored value is not a skipblock")
+	}
+	return sb.Copy(), nil
+}
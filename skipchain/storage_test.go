@@ -0,0 +1,95 @@
+package skipchain
+
+import (
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltSkipBlockStore(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer os.Remove(fname)
+
+	blocks := createIndexedBlocks(5)
+	_, err := db.StoreBlocks(blocks)
+	require.Nil(t, err)
+
+	genesis := blocks[0].Hash
+	for i, sb := range blocks {
+		require.True(t, db.GetByIndex(genesis, i).Hash.Equal(sb.Hash))
+	}
+	require.Nil(t, db.GetByIndex(genesis, 5))
+	latest, err := db.GetLatestByID(genesis)
+	require.Nil(t, err)
+	require.Equal(t, 4, latest.Index)
+
+	// Deleting the latest block makes the previous one the latest.
+	err = db.Backend().Update(func(tx SkipBlockTx) error {
+		return tx.Delete(blocks[4].Hash)
+	})
+	require.Nil(t, err)
+	require.Nil(t, db.GetByIndex(genesis, 4))
+	// The forward-link of the previous block to the deleted one is not
+	// followed.
+	latest, err = db.GetLatestByID(genesis)
+	require.Nil(t, err)
+	require.Equal(t, 3, latest.Index)
+
+	scs, err := db.getAllSkipchains()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(scs))
+	require.Equal(t, 3, scs[string(genesis)].Index)
+}
+
+func TestBoltSkipBlockStore_Rebuild(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer os.Remove(fname)
+	_, err := db.StoreBlocks(createIndexedBlocks(3))
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+	// Remove the indexes, as in a database of an older version.
+	bdb, err := bolt.Open(fname, 0600, nil)
+	require.Nil(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte("skipblock-test_index")); err != nil {
+			return err
+		}
+		return tx.DeleteBucket([]byte("skipblock-test_latest"))
+	})
+	require.Nil(t, err)
+
+	store, err := NewBoltSkipBlockStore(bdb, []byte("skipblock-test"))
+	require.Nil(t, err)
+	db = NewSkipBlockDBWithStore(store)
+	defer db.Close()
+	scs, err := db.getAllSkipchains()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(scs))
+	for id, sb := range scs {
+		require.Equal(t, 2, sb.Index)
+		require.NotNil(t, db.GetByIndex(SkipBlockID(id), 1))
+	}
+}
+
+// createIndexedBlocks returns a chain of n linked blocks of height 1.
+func createIndexedBlocks(n int) []*SkipBlock {
+	blocks := make([]*SkipBlock, n)
+	for i := range blocks {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Height = 1
+		if i > 0 {
+			sb.GenesisID = blocks[0].Hash
+			sb.BackLinkIDs = []SkipBlockID{blocks[i-1].Hash}
+		}
+		sb.updateHash()
+		blocks[i] = sb
+	}
+	for i := 0; i < n-1; i++ {
+		blocks[i].ForwardLink = []*ForwardLink{{From: blocks[i].Hash, To: blocks[i+1].Hash}}
+	}
+	return blocks
+}
@@ -624,45 +624,73 @@ func (fl *ForwardLink) IsEmpty() bool {
 
 // SkipBlockDB holds the database to the skipblocks.
 // This is used for verification, so that all links can be followed.
-// It is a wrapper to embed bolt.DB.
+// The blocks are kept in a SkipBlockStore, which also indexes them by
+// skipchain and index.
 type SkipBlockDB struct {
-	*bolt.DB
-	bucketName []byte
-	// latestBlocks is used as a simple caching mechanism
-	latestBlocks map[string]SkipBlockID
-	latestMutex  sync.Mutex
-	callback     func(SkipBlockID) error
+	store    SkipBlockStore
+	callback func(SkipBlockID) error
 }
 
-// NewSkipBlockDB returns an initialized SkipBlockDB structure.
-func NewSkipBlockDB(db *bolt.DB, bn []byte) *SkipBlockDB {
-	return &SkipBlockDB{
-		DB:           db,
-		bucketName:   bn,
-		latestBlocks: map[string]SkipBlockID{},
+// NewSkipBlockDB returns an initialized SkipBlockDB structure that stores
+// the blocks in the bucket bn of db. An error is returned if the indexes of
+// the blocks cannot be built.
+func NewSkipBlockDB(db *bolt.DB, bn []byte) (*SkipBlockDB, error) {
+	store, err := NewBoltSkipBlockStore(db, bn)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the indexes of the skipblocks: %s", err)
 	}
+	return NewSkipBlockDBWithStore(store), nil
+}
+
+// NewSkipBlockDBWithStore returns an initialized SkipBlockDB structure using
+// the given storage backend.
+func NewSkipBlockDBWithStore(store SkipBlockStore) *SkipBlockDB {
+	return &SkipBlockDB{store: store}
+}
+
+// Backend returns the storage backend of the db.
+func (db *SkipBlockDB) Backend() SkipBlockStore {
+	return db.store
+}
+
+// Close closes the storage backend of the db.
+func (db *SkipBlockDB) Close() error {
+	return db.store.Close()
 }
 
 // GetStatus is a function that returns the status report of the db.
 func (db *SkipBlockDB) GetStatus() *onet.Status {
 	out := make(map[string]string)
-	db.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.bucketName))
-		s := b.Stats()
-		out["Blocks"] = strconv.Itoa(s.KeyN)
-
-		total := s.BranchInuse + s.LeafInuse
-		out["Bytes"] = strconv.Itoa(total)
-		return nil
-	})
+	blocks, total := db.store.Stats()
+	out["Blocks"] = strconv.Itoa(blocks)
+	out["Bytes"] = strconv.Itoa(total)
 	return &onet.Status{Field: out}
 }
 
 // GetByID returns a new copy of the skip-block or nil if it doesn't exist
 func (db *SkipBlockDB) GetByID(sbID SkipBlockID) *SkipBlock {
 	var result *SkipBlock
-	err := db.View(func(tx *bolt.Tx) error {
-		sb, err := db.getFromTx(tx, sbID)
+	err := db.store.View(func(tx SkipBlockTx) error {
+		sb, err := tx.Get(sbID)
+		if err != nil {
+			return err
+		}
+		result = sb
+		return nil
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+	return result
+}
+
+// GetByIndex returns a new copy of the block of the skipchain genesis with
+// the given index, or nil if it doesn't exist.
+func (db *SkipBlockDB) GetByIndex(genesis SkipBlockID, index int) *SkipBlock {
+	var result *SkipBlock
+	err := db.store.View(func(tx SkipBlockTx) error {
+		sb, err := tx.GetByIndex(genesis, index)
 		if err != nil {
 			return err
 		}
@@ -676,13 +704,13 @@ func (db *SkipBlockDB) GetByID(sbID SkipBlockID) *SkipBlock {
 	return result
 }
 
-// StoreBlocks stores the set of blocks in the boltdb in a transaction,
+// StoreBlocks stores the set of blocks in the db in a transaction,
 // so that the db is consistent at every moment.
 func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 	var result []SkipBlockID
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.store.Update(func(tx SkipBlockTx) error {
 		for i, sb := range blocks {
-			sbOld, err := db.getFromTx(tx, sb.Hash)
+			sbOld, err := tx.Get(sb.Hash)
 			if err != nil {
 				return errors.New("failed to get skipblock with error: " + err.Error())
 			}
@@ -710,12 +738,16 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 				if len(sb.ChildSL) > len(sbOld.ChildSL) {
 					sbOld.ChildSL = append(sbOld.ChildSL, sb.ChildSL[len(sbOld.ChildSL):]...)
 				}
-				err := db.storeToTx(tx, sbOld)
+				err := tx.Put(sbOld)
 				if err != nil {
 					return err
 				}
 			} else {
-				if !db.HasForwardLink(sb) {
+				ok, err := hasForwardLinkTx(tx, sb)
+				if err != nil {
+					return err
+				}
+				if !ok {
 					found := false
 					for j := 0; j < i; j++ {
 						for _, fl := range blocks[j].ForwardLink {
@@ -728,11 +760,10 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 						return fmt.Errorf("Tried to store unlinkable block: %+v", sb.SkipBlockFix)
 					}
 				}
-				err := db.storeToTx(tx, sb)
+				err = tx.Put(sb)
 				if err != nil {
 					return err
 				}
-				db.latestUpdate(sb)
 			}
 			result = append(result, sb.Hash)
 		}
@@ -740,7 +771,7 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 	})
 
 	// Run the callback if it exists, we have to do this outside of the
-	// boltdb transaction because the callback might also make updates to
+	// transaction because the callback might also make updates to
 	// the database. Otherwise there will be a deadlock.
 	if db.callback != nil {
 		for _, r := range result {
@@ -768,50 +799,46 @@ func (db *SkipBlockDB) Store(sb *SkipBlock) SkipBlockID {
 // HasForwardLink verififes if sb can be accepted in the database by searching
 // for a forwardlink of any level.
 func (db *SkipBlockDB) HasForwardLink(sb *SkipBlock) bool {
+	var ok bool
+	err := db.store.View(func(tx SkipBlockTx) error {
+		var err error
+		ok, err = hasForwardLinkTx(tx, sb)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return ok
+}
+
+// hasForwardLinkTx is HasForwardLink within a transaction.
+func hasForwardLinkTx(tx SkipBlockTx, sb *SkipBlock) (bool, error) {
 	if sb.Index == 0 {
 		// Genesis blocks never have a reference to them.
-		return true
+		return true, nil
 	}
 
 	// Any non-genesis blocks need to be referenced by a previous block.
 	for i, bl := range sb.BackLinkIDs {
-		prev := db.GetByID(bl)
+		prev, err := tx.Get(bl)
+		if err != nil {
+			return false, err
+		}
 		if prev != nil {
 			if len(prev.ForwardLink) > i {
 				if prev.ForwardLink[i].To.Equal(sb.Hash) {
-					return true
+					return true, nil
 				}
 			}
 		}
 	}
-	return false
-}
-
-func (db *SkipBlockDB) latestUpdate(sb *SkipBlock) {
-	db.latestMutex.Lock()
-	defer db.latestMutex.Unlock()
-	idStr := string(sb.SkipChainID())
-	latest, exists := db.latestBlocks[idStr]
-	if !exists {
-		db.latestBlocks[idStr] = sb.Hash
-	} else {
-		old := db.GetByID(latest)
-		if old == nil || old.Index < sb.Index {
-			log.Lvlf3("updating sc %x: storing index %d", idStr, sb.Index)
-			db.latestBlocks[idStr] = sb.Hash
-		}
-	}
+	return false, nil
 }
 
 // Length returns the actual length using mutexes
 func (db *SkipBlockDB) Length() int {
-	var i int
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.bucketName))
-		i = b.Stats().KeyN
-		return nil
-	})
-	return i
+	blocks, _ := db.store.Stats()
+	return blocks
 }
 
 // GetResponsible searches for the block that is responsible for sb
@@ -900,41 +927,55 @@ func (db *SkipBlockDB) VerifyLinks(sb *SkipBlock) error {
 }
 
 // GetLatestByID returns the latest skipblock of a skipchain
-// given its ID.
+// given its ID. It is read from the index of the latest blocks.
 func (db *SkipBlockDB) GetLatestByID(genID SkipBlockID) (*SkipBlock, error) {
-	gen := db.GetByID(genID)
-	if gen == nil {
+	var latest *SkipBlock
+	err := db.store.View(func(tx SkipBlockTx) error {
+		var err error
+		latest, err = tx.GetLatest(genID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
 		return nil, fmt.Errorf("cannot find genesis block %x", genID)
 	}
-	return db.GetLatest(gen)
+	return latest, nil
 }
 
-// GetLatest searches for the latest available block for that skipblock.
+// GetLatest searches for the latest available block for that skipblock. It
+// is read from the index of the latest blocks, unless sb is more recent: then
+// the forward-links of sb are followed, as far as their targets are stored.
 func (db *SkipBlockDB) GetLatest(sb *SkipBlock) (*SkipBlock, error) {
 	if sb == nil {
 		return nil, errors.New("got nil skipblock")
 	}
-	latest := sb
-	db.latestMutex.Lock()
-	latestID, exists := db.latestBlocks[string(sb.SkipChainID())]
-	if exists {
-		latest = db.GetByID(latestID)
-		if latest == nil {
-			latest = sb
+	var latest *SkipBlock
+	err := db.store.View(func(tx SkipBlockTx) error {
+		var err error
+		latest, err = tx.GetLatest(sb.SkipChainID())
+		if err != nil {
+			return err
+		}
+		if latest != nil && latest.Index >= sb.Index {
+			return nil
 		}
-	}
-	db.latestMutex.Unlock()
 
-	// TODO this can be optimised by using multiple bucket.Get in a single transaction
-	for latest.GetForwardLen() > 0 {
-		next := db.GetByID(latest.GetForward(latest.GetForwardLen() - 1).To)
-		if next == nil {
-			return latest, errors.New("missing block")
+		latest = sb
+		for latest.GetForwardLen() > 0 {
+			next, err := tx.Get(latest.GetForward(latest.GetForwardLen() - 1).To)
+			if err != nil {
+				return err
+			}
+			if next == nil {
+				return errors.New("missing block")
+			}
+			latest = next
 		}
-		latest = next
-	}
-	db.latestUpdate(latest)
-	return latest, nil
+		return nil
+	})
+	return latest, err
 }
 
 // GetFuzzy searches for a block that resembles the given ID.
@@ -954,32 +995,25 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 		return nil, errors.New("id is empty")
 	}
 
-	var sb *SkipBlock
-	db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket([]byte(db.bucketName)).Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if bytes.HasPrefix(k, match) {
-				_, msg, err := network.Unmarshal(v, suite)
-				if err != nil {
-					return errors.New("Unmarshal failed with error: " + err.Error())
-				}
-				sb = msg.(*SkipBlock).Copy()
-				return nil
+	var prefix, suffix *SkipBlock
+	err = db.store.View(func(tx SkipBlockTx) error {
+		return tx.ForEach(func(sb *SkipBlock) error {
+			if prefix == nil && bytes.HasPrefix(sb.Hash, match) {
+				prefix = sb
 			}
-		}
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if bytes.HasSuffix(k, match) {
-				_, msg, err := network.Unmarshal(v, suite)
-				if err != nil {
-					return errors.New("Unmarshal failed with error: " + err.Error())
-				}
-				sb = msg.(*SkipBlock).Copy()
-				return nil
+			if suffix == nil && bytes.HasSuffix(sb.Hash, match) {
+				suffix = sb
 			}
-		}
-		return nil
+			return nil
+		})
 	})
-	return sb, nil
+	if err != nil {
+		return nil, errors.New("Unmarshal failed with error: " + err.Error())
+	}
+	if prefix != nil {
+		return prefix, nil
+	}
+	return suffix, nil
 }
 
 // GetProof returns the shortest chain from the genesis to the latest block
@@ -987,8 +1021,8 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 func (db *SkipBlockDB) GetProof(sid SkipBlockID) (sbs []*SkipBlock, err error) {
 	sbs = make([]*SkipBlock, 0)
 
-	err = db.View(func(tx *bolt.Tx) error {
-		sb, err := db.getFromTx(tx, sid)
+	err = db.store.View(func(tx SkipBlockTx) error {
+		sb, err := tx.Get(sid)
 		if err != nil {
 			return err
 		}
@@ -997,7 +1031,7 @@ func (db *SkipBlockDB) GetProof(sid SkipBlockID) (sbs []*SkipBlock, err error) {
 
 		for len(sb.ForwardLink) > 0 {
 			id := sb.ForwardLink[len(sb.ForwardLink)-1].To
-			sb, err = db.getFromTx(tx, id)
+			sb, err = tx.Get(id)
 
 			if err != nil {
 				return err
@@ -1015,43 +1049,19 @@ func (db *SkipBlockDB) GetProof(sid SkipBlockID) (sbs []*SkipBlock, err error) {
 	return
 }
 
-// GetSkipchains returns all latest skipblocks from all skipchains.
-func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
-	return db.getAll()
-}
-
-// storeToTx stores the skipblock into the database.
-// An error is returned on failure.
-// The caller must ensure that this function is called from within a valid transaction.
-func (db *SkipBlockDB) storeToTx(tx *bolt.Tx, sb *SkipBlock) error {
-	key := sb.Hash
-	val, err := network.Marshal(sb)
-	if err != nil {
-		return err
-	}
-	return tx.Bucket([]byte(db.bucketName)).Put(key, val)
-}
-
-// getFromTx returns the skipblock identified by sbID.
-// nil is returned if the key does not exist.
-// An error is thrown if marshalling fails.
-// The caller must ensure that this function is called from within a valid transaction.
-func (db *SkipBlockDB) getFromTx(tx *bolt.Tx, sbID SkipBlockID) (*SkipBlock, error) {
-	val := tx.Bucket([]byte(db.bucketName)).Get(sbID)
-	if val == nil {
-		return nil, nil
-	}
-
-	// For some reason boltdb changes the val before Unmarshal finishes. When
-	// copying the value into a buffer, there is no SIGSEGV anymore.
-	buf := make([]byte, len(val))
-	copy(buf, val)
-	_, sbMsg, err := network.Unmarshal(buf, suite)
+// GetCompactProof returns the proof of GetProof in its compact form. sid
+// must be the ID of a genesis block.
+func (db *SkipBlockDB) GetCompactProof(sid SkipBlockID) (*CompactProof, error) {
+	sbs, err := db.GetProof(sid)
 	if err != nil {
 		return nil, err
 	}
+	return Proof(sbs).Compact()
+}
 
-	return sbMsg.(*SkipBlock).Copy(), nil
+// GetSkipchains returns all latest skipblocks from all skipchains.
+func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
+	return db.getAll()
 }
 
 // getAll returns all the data in the database as a map
@@ -1060,17 +1070,9 @@ func (db *SkipBlockDB) getFromTx(tx *bolt.Tx, sbID SkipBlockID) (*SkipBlock, err
 // database that is consistent at the time of the function call.
 func (db *SkipBlockDB) getAll() (map[string]*SkipBlock, error) {
 	data := map[string]*SkipBlock{}
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.bucketName))
-		return b.ForEach(func(k, v []byte) error {
-			_, sbMsg, err := network.Unmarshal(v, suite)
-			if err != nil {
-				return err
-			}
-			sb, ok := sbMsg.(*SkipBlock)
-			if ok {
-				data[string(sb.Hash)] = sb
-			}
+	err := db.store.View(func(tx SkipBlockTx) error {
+		return tx.ForEach(func(sb *SkipBlock) error {
+			data[string(sb.Hash)] = sb
 			return nil
 		})
 	})
@@ -1085,28 +1087,9 @@ func (db *SkipBlockDB) getAll() (map[string]*SkipBlock, error) {
 // in the form of a map from skipblock ID to the latest block.
 func (db *SkipBlockDB) getAllSkipchains() (map[string]*SkipBlock, error) {
 	gen := make(map[string]*SkipBlock)
-
-	// Loop over all blocks. If we see a new genesis block we
-	// have not seen, remember it. If we see a higher Index than what
-	// we have, replace it.
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.bucketName))
-		return b.ForEach(func(k, v []byte) error {
-			_, sbMsg, err := network.Unmarshal(v, suite)
-			if err != nil {
-				return err
-			}
-			sb, ok := sbMsg.(*SkipBlock)
-			if ok {
-				k := string(sb.SkipChainID())
-				if cur, ok := gen[k]; ok {
-					if cur.Index < sb.Index {
-						gen[k] = sb
-					}
-				} else {
-					gen[k] = sb
-				}
-			}
+	err := db.store.View(func(tx SkipBlockTx) error {
+		return tx.ForEachLatest(func(sb *SkipBlock) error {
+			gen[string(sb.SkipChainID())] = sb
 			return nil
 		})
 	})
@@ -151,11 +151,11 @@ func TestSkipBlock_GetFuzzy(t *testing.T) {
 	sb1.Data = []byte{1}
 	sb1.Hash = []byte{2, 3, 4, 1, 5}
 
-	db.Update(func(tx *bolt.Tx) error {
-		err := db.storeToTx(tx, sb0)
+	db.Backend().Update(func(tx SkipBlockTx) error {
+		err := tx.Put(sb0)
 		require.Nil(t, err)
 
-		err = db.storeToTx(tx, sb1)
+		err = tx.Put(sb1)
 		require.Nil(t, err)
 		return nil
 	})
@@ -229,8 +229,8 @@ func TestGetProof(t *testing.T) {
 	require.Equal(t, 2, len(blocks))
 	require.True(t, blocks[1].Hash.Equal(sb2.Hash))
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(db.bucketName).Delete(sb2.Hash)
+	err = db.Backend().Update(func(tx SkipBlockTx) error {
+		return tx.Delete(sb2.Hash)
 	})
 	require.Nil(t, err)
 
@@ -255,7 +255,9 @@ func setupSkipBlockDB(t *testing.T) (*SkipBlockDB, string) {
 	})
 	require.Nil(t, err)
 
-	return NewSkipBlockDB(db, []byte("skipblock-test")), fname
+	sbDB, err := NewSkipBlockDB(db, []byte("skipblock-test"))
+	require.Nil(t, err)
+	return sbDB, fname
 }
 
 // Checks if the buffer api works as expected